@@ -1,14 +1,21 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/bytetopia/BlankoBlog/backend/internal/database"
 	"github.com/bytetopia/BlankoBlog/backend/internal/handlers"
 	"github.com/bytetopia/BlankoBlog/backend/internal/services"
+	"github.com/bytetopia/BlankoBlog/backend/internal/storage"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func main() {
@@ -18,9 +25,29 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	// Set up storage for uploads, on disk unless UPLOAD_STORAGE says otherwise
+	store, err := storage.FromEnv()
+	if err != nil {
+		log.Fatal("Failed to set up upload storage:", err)
+	}
+
+	// Run a maintenance command instead of the server when one is given
+	if len(os.Args) > 1 {
+		if err := runCommand(db, store, os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Set up Gin router
 	r := gin.Default()
 
+	// Only proxies listed in TRUSTED_PROXIES may set the client IP through X-Forwarded-For,
+	// otherwise clients could pick their own address to get around rate limits and IP rules
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
 	// Configure CORS
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"http://localhost:3000", "http://localhost:5173"} // React dev servers
@@ -33,23 +60,65 @@ func main() {
 	userService := services.NewUserService(db)
 	configService := services.NewConfigService(db)
 	tagService := services.NewTagService(db)
-	commentService := services.NewCommentService(db)
+	spamClassifier := services.NewSpamClassifier(db, configService)
+	mailService := services.NewMailService(db, configService)
+	commentNotificationService := services.NewCommentNotificationService(db, configService, mailService, os.Getenv("BASE_URL"))
+	commentService := services.NewCommentService(db, spamClassifier, commentNotificationService)
 	rssService := services.NewRSSService(db, configService)
+	sitemapService := services.NewSitemapService(db, configService)
+	commentGuardService := services.NewCommentGuardService(db, configService)
+	commentRuleService := services.NewCommentRuleService(db)
+	commentSubmissionService := services.NewCommentSubmissionService(db, configService, commentGuardService, spamClassifier, commentRuleService, commentNotificationService)
+	postService := services.NewPostService(db)
+	commentMigrationService := services.NewCommentMigrationService(db)
+	avatarService := services.NewAvatarService(db, configService)
+	fileService := services.NewFileService(db, configService, store)
+	imageService := services.NewImageService(db, configService, fileService)
 
 	// Initialize default configurations
 	if err := configService.InitializeDefaultConfigs(); err != nil {
 		log.Printf("Warning: Failed to initialize default configs: %v", err)
 	}
 
+	// Record which files existing posts use, once after upgrading to usage tracking
+	if err := fileService.BackfillFileUsage(); err != nil {
+		log.Printf("Warning: Failed to record file usage: %v", err)
+	}
+
+	// Render comments stored before Markdown support, once after upgrading
+	if _, err := commentService.BackfillContentHTML(); err != nil {
+		log.Printf("Warning: Failed to render comment HTML: %v", err)
+	}
+
+	// Start background publisher for scheduled posts
+	publishScheduler := services.NewPublishScheduler(postService, time.Minute)
+	publishScheduler.Start()
+	defer publishScheduler.Stop()
+
+	// Start background sender for queued email
+	mailOutboxWorker := services.NewMailOutboxWorker(mailService, time.Minute)
+	mailOutboxWorker.Start()
+	defer mailOutboxWorker.Stop()
+
+	// Links in notification emails use the configured site address, never the request's Host header
+	if os.Getenv("BASE_URL") == "" {
+		log.Printf("Warning: BASE_URL is not set, comment notification emails are turned off")
+	}
+
 	// Initialize handlers
 	postHandler := handlers.NewPostHandler(db)
 	authHandler := handlers.NewAuthHandler(db)
 	settingsHandler := handlers.NewSettingsHandler(configService, userService, db)
 	tagHandler := handlers.NewTagHandler(tagService)
-	commentHandler := handlers.NewCommentHandler(commentService)
+	commentHandler := handlers.NewCommentHandler(commentService, commentGuardService, spamClassifier, commentSubmissionService, postService)
+	commentRuleHandler := handlers.NewCommentRuleHandler(commentRuleService)
+	mailHandler := handlers.NewMailHandler(mailService)
+	commentMigrationHandler := handlers.NewCommentMigrationHandler(commentMigrationService)
 	rssHandler := handlers.NewRSSHandler(rssService)
-	fileHandler := handlers.NewFileHandler(db)
-	templateHandler := handlers.NewTemplateHandler(db, configService)
+	sitemapHandler := handlers.NewSitemapHandler(sitemapService)
+	avatarHandler := handlers.NewAvatarHandler(avatarService)
+	templateHandler := handlers.NewTemplateHandler(db, configService, commentSubmissionService, commentService, commentNotificationService, imageService)
+	fileHandler := handlers.NewFileHandler(fileService, imageService, templateHandler.Render404)
 
 	// API routes
 	api := r.Group("/api")
@@ -57,6 +126,10 @@ func main() {
 		// Auth routes (public, for login)
 		api.POST("/auth/login", authHandler.Login)
 
+		// Public comment routes, for the SPA and headless themes
+		api.GET("/posts/:slug/comments", commentHandler.GetPostComments)
+		api.POST("/posts/:slug/comments", commentHandler.CreatePostComment)
+
 		// Protected admin routes
 		admin := api.Group("/admin")
 		admin.Use(authHandler.AuthMiddleware())
@@ -67,6 +140,10 @@ func main() {
 			admin.POST("/posts", postHandler.CreatePost)
 			admin.PUT("/posts/:id", postHandler.UpdatePost)
 			admin.DELETE("/posts/:id", postHandler.DeletePost)
+			admin.GET("/posts/:id/revisions", postHandler.GetPostRevisions)
+			admin.GET("/posts/:id/revisions/diff", postHandler.DiffPostRevisions)
+			admin.GET("/posts/:id/revisions/:revisionId", postHandler.GetPostRevision)
+			admin.POST("/posts/:id/revisions/:revisionId/restore", postHandler.RestorePostRevision)
 			
 			// Tag management routes
 			admin.GET("/tags", tagHandler.GetAllTags)
@@ -77,13 +154,33 @@ func main() {
 			// Comment management routes (admin only)
 			admin.GET("/comments/list", commentHandler.GetAllCommentsForAdmin)
 			admin.GET("/comments/stats", commentHandler.GetCommentStats)
+			admin.GET("/comments/rejections", commentHandler.GetCommentRejections)
+			admin.GET("/comments/classifier", commentHandler.GetSpamClassifierStats)
+			admin.POST("/comments/classifier/retrain", commentHandler.RetrainSpamClassifier)
+			admin.POST("/comments/bulk", commentHandler.BulkModerateComments)
+			admin.POST("/comments/import", commentMigrationHandler.ImportComments)
+			admin.GET("/comments/export", commentMigrationHandler.ExportComments)
 			admin.GET("/comments/:id", commentHandler.GetCommentForAdmin)
 			admin.PUT("/comments/:id/status", commentHandler.UpdateCommentStatus)
+			admin.POST("/comments/:id/reply", commentHandler.ReplyToComment)
 			admin.DELETE("/comments/:id", commentHandler.DeleteComment)
+
+			// Comment moderation rules (admin only)
+			admin.GET("/comment-rules", commentRuleHandler.GetRules)
+			admin.POST("/comment-rules", commentRuleHandler.CreateRule)
+			admin.GET("/comment-rules/:id", commentRuleHandler.GetRule)
+			admin.PUT("/comment-rules/:id", commentRuleHandler.UpdateRule)
+			admin.DELETE("/comment-rules/:id", commentRuleHandler.DeleteRule)
+
+			// Email outbox and SMTP test (admin only)
+			admin.GET("/mail/outbox", mailHandler.GetOutbox)
+			admin.POST("/mail/outbox/:id/retry", mailHandler.RetryMessage)
+			admin.POST("/mail/test", mailHandler.SendTestMail)
 			
 			// File management routes (admin only)
 			admin.POST("/files", fileHandler.UploadFile)
 			admin.GET("/files", fileHandler.GetFiles)
+			admin.GET("/files/folders", fileHandler.GetFolders)
 			admin.GET("/files/:id", fileHandler.GetFile)
 			admin.PUT("/files/:id", fileHandler.UpdateFile)
 			admin.DELETE("/files/:id", fileHandler.DeleteFile)
@@ -95,11 +192,21 @@ func main() {
 		}
 	}
 
-	// RSS feed endpoints (outside of /api to follow standard RSS conventions)
+	// Feed endpoints (outside of /api to follow standard RSS conventions)
 	r.GET("/rss", rssHandler.GetRSSFeed)
 	r.GET("/rss.xml", rssHandler.GetRSSFeed)
 	r.GET("/feed", rssHandler.GetRSSFeed)
 	r.GET("/feed.xml", rssHandler.GetRSSFeed)
+	r.GET("/atom.xml", rssHandler.GetAtomFeed)
+	r.GET("/feed.json", rssHandler.GetJSONFeed)
+
+	// Sitemap and robots.txt for search engines
+	r.GET("/sitemap.xml", sitemapHandler.GetSitemap)
+	r.GET("/sitemaps/:page", sitemapHandler.GetSitemapPage)
+	r.GET("/robots.txt", sitemapHandler.GetRobotsTxt)
+
+	// Commenter avatars, generated here or proxied from Gravatar
+	r.GET("/avatars/:id", avatarHandler.GetAvatar)
 
 	// Serve uploaded files
 	r.GET("/uploads/*filepath", fileHandler.ServeFile)
@@ -108,8 +215,17 @@ func main() {
 	r.GET("/", templateHandler.RenderPostList)
 	r.GET("/posts/:slug", templateHandler.RenderPostDetail)
 	r.POST("/posts/:slug/comments", templateHandler.HandleCommentSubmit)
+	r.GET("/comments/:id/moderate", templateHandler.RenderCommentModeration)
+	r.POST("/comments/:id/moderate", templateHandler.HandleCommentModeration)
+	r.GET("/comments/:id/unsubscribe", templateHandler.RenderCommentUnsubscribe)
+	r.POST("/comments/:id/unsubscribe", templateHandler.HandleCommentUnsubscribe)
 	r.GET("/tags", templateHandler.RenderTagList)
 	r.GET("/tags/:id/posts", templateHandler.RenderTagPosts)
+	r.GET("/tags/:id/feed.xml", rssHandler.GetRSSFeed)
+	r.GET("/tags/:id/atom.xml", rssHandler.GetAtomFeed)
+	r.GET("/tags/:id/feed.json", rssHandler.GetJSONFeed)
+	r.GET("/search", templateHandler.RenderSearch)
+	r.GET("/highlight.css", templateHandler.ServeHighlightCSS)
 
 	// Serve static files (CSS, JS, images)
 	r.Static("/static", "./static")
@@ -158,4 +274,127 @@ func main() {
 	if err := r.Run(":" + port); err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
-}
\ No newline at end of file
+}
+
+// trustedProxies returns the comma separated addresses and CIDR ranges in TRUSTED_PROXIES, nil when empty
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// runCommand runs a command-line subcommand such as import-comments
+func runCommand(db *gorm.DB, store storage.Storage, name string, args []string) error {
+	migrationService := services.NewCommentMigrationService(db)
+
+	switch name {
+	case "import-comments":
+		flags := flag.NewFlagSet(name, flag.ExitOnError)
+		format := flags.String("format", "", "export format: disqus or wordpress (detected when empty)")
+		dryRun := flags.Bool("dry-run", false, "report what would be imported without importing")
+		flags.Usage = func() {
+			fmt.Fprintf(flags.Output(), "Usage: %s import-comments [-format disqus|wordpress] [-dry-run] FILE\n", os.Args[0])
+			flags.PrintDefaults()
+		}
+		flags.Parse(args)
+		if flags.NArg() != 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		report, err := migrationService.Import(*format, file, *dryRun)
+		if err != nil {
+			return err
+		}
+
+		output, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(output))
+		return nil
+
+	case "export-comments":
+		defaultBaseURL := os.Getenv("BASE_URL")
+		if defaultBaseURL == "" {
+			defaultBaseURL = "http://localhost:8080"
+		}
+
+		flags := flag.NewFlagSet(name, flag.ExitOnError)
+		baseURL := flags.String("base-url", defaultBaseURL, "site URL used for the post links")
+		outputPath := flags.String("o", "", "file to write the Disqus XML to (standard output when empty)")
+		flags.Parse(args)
+
+		if *outputPath == "" {
+			return migrationService.ExportDisqus(os.Stdout, *baseURL)
+		}
+
+		file, err := os.Create(*outputPath)
+		if err != nil {
+			return err
+		}
+		if err := migrationService.ExportDisqus(file, *baseURL); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+
+	case "process-images":
+		flags := flag.NewFlagSet(name, flag.ExitOnError)
+		all := flags.Bool("all", false, "process every image again, e.g. after changing the image widths")
+		flags.Parse(args)
+
+		configService := services.NewConfigService(db)
+		imageService := services.NewImageService(db, configService, services.NewFileService(db, configService, store))
+		processed, err := imageService.ProcessImages(*all)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Processed %d images\n", processed)
+		return nil
+
+	case "dedupe-uploads":
+		configService := services.NewConfigService(db)
+		fileService := services.NewFileService(db, configService, store)
+		report, err := fileService.DedupeUploads()
+		if err != nil {
+			return err
+		}
+
+		// Resized copies now belong to blobs and are made for those that have none
+		imageService := services.NewImageService(db, configService, fileService)
+		report.Processed, err = imageService.ProcessImages(false)
+		if err != nil {
+			return err
+		}
+
+		output, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(output))
+		return nil
+
+	case "scan-file-usage":
+		fileService := services.NewFileService(db, services.NewConfigService(db), store)
+		scanned, err := fileService.RescanFileUsage()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Scanned %d posts\n", scanned)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown command %q (available: import-comments, export-comments, process-images, dedupe-uploads, scan-file-usage)", name)
+	}
+}
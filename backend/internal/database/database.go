@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/bytetopia/BlankoBlog/backend/internal/models"
 	"golang.org/x/crypto/bcrypt"
@@ -30,9 +31,16 @@ func Initialize() (*gorm.DB, error) {
 		logLevel = logger.Info
 	}
 
+	// Log to stderr like the log package, so commands can write their output to stdout
+	gormLogger := logger.New(log.New(os.Stderr, "\r\n", log.LstdFlags), logger.Config{
+		SlowThreshold: 200 * time.Millisecond,
+		LogLevel:      logLevel,
+		Colorful:      true,
+	})
+
 	// Open database connection
 	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logLevel),
+		Logger: gormLogger,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
@@ -43,6 +51,11 @@ func Initialize() (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	// Set up full-text search (optional, requires FTS5 support in SQLite)
+	if err := setupSearchIndex(db); err != nil {
+		log.Printf("Warning: full-text search index unavailable, falling back to simple search: %v", err)
+	}
+
 	// Always seed admin user data for all environments
 	if err := seedAdminUser(db); err != nil {
 		log.Printf("Warning: failed to seed admin user: %v", err)
@@ -64,16 +77,66 @@ func Initialize() (*gorm.DB, error) {
 
 // runMigrations applies database schema migrations
 func runMigrations(db *gorm.DB) error {
+	if err := migrateFileBlobs(db); err != nil {
+		return err
+	}
+
+	// Files and the posts using them are linked through PostFile
+	if err := db.SetupJoinTable(&models.File{}, "UsedIn", &models.PostFile{}); err != nil {
+		return err
+	}
+
 	return db.AutoMigrate(
 		&models.User{},
 		&models.Post{},
+		&models.PostRevision{},
 		&models.Config{},
 		&models.Tag{},
 		&models.Comment{},
+		&models.CommentRejection{},
+		&models.CommentRule{},
+		&models.SpamToken{},
+		&models.SpamTrainingLabel{},
 		&models.File{},
+		&models.PostFile{},
+		&models.Blob{},
+		&models.FileVariant{},
+		&models.MailOutbox{},
 	)
 }
 
+// migrateFileBlobs prepares the file tables for deduplicated uploads. Server paths are no longer
+// unique, as files with the same content share a blob, and resized copies belong to blobs rather
+// than files. The copies are dropped and made again by the dedupe-uploads command.
+func migrateFileBlobs(db *gorm.DB) error {
+	migrator := db.Migrator()
+
+	if migrator.HasTable(&models.File{}) {
+		indexes, err := migrator.GetIndexes(&models.File{})
+		if err != nil {
+			return err
+		}
+		for _, index := range indexes {
+			if unique, _ := index.Unique(); unique && index.Name() == "idx_files_server_path" {
+				if err := migrator.DropIndex(&models.File{}, index.Name()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if migrator.HasTable(&models.FileVariant{}) && migrator.HasColumn(&models.FileVariant{}, "file_id") {
+		if err := migrator.DropTable(&models.FileVariant{}); err != nil {
+			return err
+		}
+		if err := db.Exec("UPDATE files SET width = 0, height = 0").Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // seedAdminUser creates the default admin user if no users exist
 func seedAdminUser(db *gorm.DB) error {
 	// Check if admin user already exists
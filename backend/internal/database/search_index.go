@@ -0,0 +1,133 @@
+package database
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// postTagNamesSQL returns the space separated tag names of the post identified by the given column
+func postTagNamesSQL(postIDColumn string) string {
+	return fmt.Sprintf(`COALESCE((SELECT group_concat(tags.name, ' ') FROM tags
+		JOIN post_tags ON post_tags.tag_id = tags.id
+		WHERE post_tags.post_id = %s AND tags.deleted_at IS NULL), '')`, postIDColumn)
+}
+
+// searchTextSQL returns a text column without the private use characters U+E000 and U+E001,
+// which search results use to mark matches, so text can't add unbalanced marks of its own
+func searchTextSQL(column string) string {
+	return fmt.Sprintf("replace(replace(%s, char(57344), ''), char(57345), '')", column)
+}
+
+// setupSearchIndex creates the full-text search table and the triggers keeping it in sync with posts.
+// It requires SQLite built with FTS5 (the sqlite_fts5 build tag); without it search falls back to LIKE queries.
+func setupSearchIndex(db *gorm.DB) error {
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+			title, summary, content, tags,
+			tokenize = 'unicode61 remove_diacritics 2'
+		)`,
+
+		// Posts: the FTS rowid is the post ID, soft-deleted posts are dropped from the index.
+		// Only text changes and soft deletes touch the index, not view counts. Earlier versions
+		// indexed text as is and updated on every change, so both triggers are always replaced.
+		`DROP TRIGGER IF EXISTS posts_fts_after_insert`,
+		`CREATE TRIGGER posts_fts_after_insert AFTER INSERT ON posts
+		WHEN NEW.deleted_at IS NULL BEGIN
+			INSERT INTO posts_fts(rowid, title, summary, content, tags)
+			VALUES (NEW.id, ` + searchTextSQL("NEW.title") + `, ` + searchTextSQL("NEW.summary") + `, ` + searchTextSQL("NEW.content") + `, ` + postTagNamesSQL("NEW.id") + `);
+		END`,
+		`DROP TRIGGER IF EXISTS posts_fts_after_update`,
+		`CREATE TRIGGER posts_fts_after_update AFTER UPDATE OF title, summary, content, deleted_at ON posts BEGIN
+			DELETE FROM posts_fts WHERE rowid = OLD.id;
+			INSERT INTO posts_fts(rowid, title, summary, content, tags)
+			SELECT NEW.id, ` + searchTextSQL("NEW.title") + `, ` + searchTextSQL("NEW.summary") + `, ` + searchTextSQL("NEW.content") + `, ` + postTagNamesSQL("NEW.id") + `
+			WHERE NEW.deleted_at IS NULL;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS posts_fts_after_delete AFTER DELETE ON posts BEGIN
+			DELETE FROM posts_fts WHERE rowid = OLD.id;
+		END`,
+
+		// Tag associations and tag renames refresh the tags column of affected posts
+		`CREATE TRIGGER IF NOT EXISTS posts_fts_post_tags_after_insert AFTER INSERT ON post_tags BEGIN
+			UPDATE posts_fts SET tags = ` + postTagNamesSQL("NEW.post_id") + ` WHERE rowid = NEW.post_id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS posts_fts_post_tags_after_delete AFTER DELETE ON post_tags BEGIN
+			UPDATE posts_fts SET tags = ` + postTagNamesSQL("OLD.post_id") + ` WHERE rowid = OLD.post_id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS posts_fts_tags_after_update AFTER UPDATE ON tags BEGIN
+			UPDATE posts_fts SET tags = ` + postTagNamesSQL("posts_fts.rowid") + `
+			WHERE rowid IN (SELECT post_id FROM post_tags WHERE tag_id = NEW.id);
+		END`,
+	}
+
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			dropSearchIndexTriggers(db)
+			return err
+		}
+	}
+
+	if err := rebuildSearchIndexIfStale(db); err != nil {
+		dropSearchIndexTriggers(db)
+		return err
+	}
+
+	return nil
+}
+
+// dropSearchIndexTriggers removes the sync triggers so post writes keep working
+// when the index cannot be used (e.g. a binary built without FTS5 on an indexed database)
+func dropSearchIndexTriggers(db *gorm.DB) {
+	triggers := []string{
+		"posts_fts_after_insert",
+		"posts_fts_after_update",
+		"posts_fts_after_delete",
+		"posts_fts_post_tags_after_insert",
+		"posts_fts_post_tags_after_delete",
+		"posts_fts_tags_after_update",
+	}
+	for _, trigger := range triggers {
+		if err := db.Exec("DROP TRIGGER IF EXISTS " + trigger).Error; err != nil {
+			log.Printf("Warning: failed to drop search trigger %s: %v", trigger, err)
+		}
+	}
+}
+
+// rebuildSearchIndexIfStale repopulates the index when it is out of sync with posts,
+// e.g. on first start, after a migration recreated the posts table and its triggers, or when
+// it holds match markers indexed by earlier versions
+func rebuildSearchIndexIfStale(db *gorm.DB) error {
+	var indexed, posts, marked int64
+	if err := db.Table("posts_fts").Count(&indexed).Error; err != nil {
+		return err
+	}
+	if err := db.Table("posts").Where("deleted_at IS NULL").Count(&posts).Error; err != nil {
+		return err
+	}
+	err := db.Table("posts_fts").
+		Where("instr(title || summary || content, char(57344)) > 0 OR instr(title || summary || content, char(57345)) > 0").
+		Count(&marked).Error
+	if err != nil {
+		return err
+	}
+	if indexed == posts && marked == 0 {
+		return nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM posts_fts").Error; err != nil {
+			return err
+		}
+		return tx.Exec(`INSERT INTO posts_fts(rowid, title, summary, content, tags)
+			SELECT posts.id, ` + searchTextSQL("posts.title") + `, ` + searchTextSQL("posts.summary") + `, ` + searchTextSQL("posts.content") + `, ` + postTagNamesSQL("posts.id") + `
+			FROM posts WHERE posts.deleted_at IS NULL`).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Rebuilt search index for %d posts", posts)
+	return nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestSearchIndexDropsHighlightMarkers(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Post{}, &models.Tag{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if err := db.Exec("CREATE VIRTUAL TABLE posts_fts USING fts5(title, summary, content, tags)").Error; err != nil {
+		t.Skip("SQLite was built without FTS5, run with -tags sqlite_fts5")
+	}
+
+	// A post indexed with markers by an earlier version is rebuilt on setup
+	marked := models.Post{Title: "Old \uE000title", Summary: "summary\uE001", Content: "old content", Slug: "old"}
+	if err := db.Create(&marked).Error; err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	if err := db.Exec("INSERT INTO posts_fts(rowid, title, summary, content, tags) VALUES (?, ?, ?, ?, '')",
+		marked.ID, marked.Title, marked.Summary, marked.Content).Error; err != nil {
+		t.Fatalf("failed to index post: %v", err)
+	}
+	if err := setupSearchIndex(db); err != nil {
+		t.Fatalf("setupSearchIndex() error: %v", err)
+	}
+
+	inserted := models.Post{Title: "New", Summary: "\uE001", Content: "new \uE000content\uE001", Slug: "new"}
+	if err := db.Create(&inserted).Error; err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	updated := models.Post{Title: "Updated", Content: "plain", Slug: "updated"}
+	if err := db.Create(&updated).Error; err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	if err := db.Model(&updated).Update("content", "\uE000updated\uE001").Error; err != nil {
+		t.Fatalf("failed to update post: %v", err)
+	}
+
+	var rows []struct {
+		Title, Summary, Content string
+	}
+	if err := db.Raw("SELECT title, summary, content FROM posts_fts").Scan(&rows).Error; err != nil {
+		t.Fatalf("failed to read index: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("index has %d rows, want 3", len(rows))
+	}
+	for _, row := range rows {
+		if text := row.Title + row.Summary + row.Content; strings.ContainsAny(text, "\uE000\uE001") {
+			t.Errorf("indexed text %q keeps highlight markers", text)
+		}
+	}
+}
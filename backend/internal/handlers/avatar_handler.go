@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type AvatarHandler struct {
+	avatarService *services.AvatarService
+}
+
+func NewAvatarHandler(avatarService *services.AvatarService) *AvatarHandler {
+	return &AvatarHandler{
+		avatarService: avatarService,
+	}
+}
+
+// GetAvatar serves the avatar of a comment's author, as PNG or with a .svg suffix as SVG.
+// Query parameters: s (size in pixels, rounded to a few fixed sizes).
+// GET /avatars/:id
+func (h *AvatarHandler) GetAvatar(c *gin.Context) {
+	id := c.Param("id")
+	format := "png"
+	if strings.HasSuffix(id, ".svg") {
+		id, format = strings.TrimSuffix(id, ".svg"), "svg"
+	} else {
+		id = strings.TrimSuffix(id, ".png")
+	}
+
+	commentID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avatar not found"})
+		return
+	}
+
+	size, err := strconv.Atoi(c.DefaultQuery("s", strconv.Itoa(services.DefaultAvatarSize)))
+	if err != nil {
+		size = services.DefaultAvatarSize
+	}
+
+	avatar, err := h.avatarService.Avatar(uint(commentID), format, size)
+	if err != nil {
+		if errors.Is(err, services.ErrAvatarNotFound) || strings.Contains(err.Error(), "invalid") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Avatar not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render avatar"})
+		return
+	}
+
+	// Avatars are cached for a day so a change of avatar settings shows up soon after.
+	// ServeContent answers If-None-Match and If-Modified-Since with 304.
+	c.Header("Content-Type", avatar.ContentType)
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Header("ETag", avatar.ETag)
+	c.Header("X-Content-Type-Options", "nosniff")
+	if format == "svg" {
+		c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	}
+	http.ServeContent(c.Writer, c.Request, "", avatar.ModTime, bytes.NewReader(avatar.Data))
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net"
 	"net/http"
 	"strconv"
@@ -14,12 +16,20 @@ import (
 
 type CommentHandler struct {
 	commentService *services.CommentService
+	guardService   *services.CommentGuardService
+	classifier     *services.SpamClassifier
+	submissions    *services.CommentSubmissionService
+	postService    *services.PostService
 	validator      *validator.Validate
 }
 
-func NewCommentHandler(commentService *services.CommentService) *CommentHandler {
+func NewCommentHandler(commentService *services.CommentService, guardService *services.CommentGuardService, classifier *services.SpamClassifier, submissions *services.CommentSubmissionService, postService *services.PostService) *CommentHandler {
 	return &CommentHandler{
 		commentService: commentService,
+		guardService:   guardService,
+		classifier:     classifier,
+		submissions:    submissions,
+		postService:    postService,
 		validator:      validator.New(),
 	}
 }
@@ -48,6 +58,103 @@ func (h *CommentHandler) getClientIP(c *gin.Context) string {
 	return ip
 }
 
+// GetPostComments returns the approved comments of a published post and a fresh comment form token (public endpoint)
+// GET /api/posts/:slug/comments
+func (h *CommentHandler) GetPostComments(c *gin.Context) {
+	post, err := h.postService.GetPostBySlug(c.Param("slug"), true)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch post"})
+		return
+	}
+
+	mode := h.submissions.CommentMode(post)
+	response := gin.H{
+		"comments":     []models.CommentResponse{},
+		"comment_mode": mode,
+	}
+
+	if mode != services.CommentModeHidden {
+		comments, err := h.commentService.GetApprovedComments(post.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comments"})
+			return
+		}
+
+		commentResponses := make([]models.CommentResponse, len(comments))
+		for i, comment := range comments {
+			commentResponses[i] = comment.ToResponse()
+		}
+		response["comments"] = commentResponses
+	}
+
+	// The form is only offered while the post takes comments
+	if h.submissions.AcceptsComments(post) {
+		form, err := h.submissions.NewForm(post.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare comment form"})
+			return
+		}
+		response["form"] = form
+
+		// Every response carries its own form token
+		c.Header("Cache-Control", "no-store")
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CreatePostComment submits a reader comment through the same moderation pipeline as the HTML form (public endpoint)
+// POST /api/posts/:slug/comments
+func (h *CommentHandler) CreatePostComment(c *gin.Context) {
+	post, err := h.postService.GetPostBySlug(c.Param("slug"), true)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch post"})
+		return
+	}
+
+	var req models.CreateCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	comment, err := h.submissions.Submit(post, req, c.ClientIP(), c.Request.Referer())
+	if err != nil {
+		var invalid *services.CommentValidationError
+		var rejected *services.CommentRejectedError
+		switch {
+		case errors.Is(err, services.ErrCommentsClosed):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Comments are closed for this post"})
+		case errors.As(err, &invalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment", "fields": invalid.Fields})
+		case errors.As(err, &rejected) && (rejected.Reason == services.GuardReasonRateLimitIP || rejected.Reason == services.GuardReasonRateLimitPost):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many comments, please try again later"})
+		case errors.As(err, &rejected):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Comment rejected by the spam filter"})
+		default:
+			log.Printf("Error creating comment: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+		}
+		return
+	}
+
+	// Comments hidden as spam look like any other comment awaiting review
+	response := comment.ToResponse()
+	if response.Status == "hidden" {
+		response.Status = "pending"
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"comment": response})
+}
+
 // GetAllCommentsForAdmin retrieves all comments for admin management (admin endpoint)
 // GET /api/admin/comments
 func (h *CommentHandler) GetAllCommentsForAdmin(c *gin.Context) {
@@ -154,6 +261,85 @@ func (h *CommentHandler) UpdateCommentStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Comment status updated successfully"})
 }
 
+// BulkModerateComments approves, hides or deletes many comments at once (admin endpoint)
+// POST /api/admin/comments/bulk
+func (h *CommentHandler) BulkModerateComments(c *gin.Context) {
+	var req models.BulkCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	// Validate request
+	if err := h.validator.Struct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.commentService.BulkModerate(req)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid bulk request") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to moderate comments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ReplyToComment posts an auto-approved author reply to a comment (admin endpoint)
+// POST /api/admin/comments/:id/reply
+func (h *CommentHandler) ReplyToComment(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+
+	var req models.CreateCommentReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	// Validate request
+	if err := h.validator.Struct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user from context (set by auth middleware)
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	user, ok := userInterface.(*models.User)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user from context"})
+		return
+	}
+
+	reply, err := h.commentService.CreateAdminReply(uint(id), user, req.Content)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			return
+		}
+		if strings.Contains(err.Error(), "hidden comment") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reply"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"comment": reply.ToAdminResponse()})
+}
+
 // DeleteComment deletes a comment (admin endpoint)
 // DELETE /api/admin/comments/:id
 func (h *CommentHandler) DeleteComment(c *gin.Context) {
@@ -186,4 +372,67 @@ func (h *CommentHandler) GetCommentStats(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{"stats": stats})
+}
+
+// GetCommentRejections lists submissions blocked by the comment guards (admin endpoint)
+// GET /api/admin/comments/rejections
+func (h *CommentHandler) GetCommentRejections(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	rejections, totalCount, err := h.guardService.GetRejections(page, limit, c.Query("reason"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rejections"})
+		return
+	}
+
+	stats, err := h.guardService.GetRejectionStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rejection statistics"})
+		return
+	}
+
+	totalPages := (int(totalCount) + limit - 1) / limit
+
+	c.JSON(http.StatusOK, gin.H{
+		"rejections": rejections,
+		"reasons":    stats,
+		"pagination": gin.H{
+			"current_page": page,
+			"total_pages":  totalPages,
+			"total_count":  totalCount,
+			"limit":        limit,
+		},
+	})
+}
+
+// GetSpamClassifierStats returns the training state of the spam classifier (admin endpoint)
+// GET /api/admin/comments/classifier
+func (h *CommentHandler) GetSpamClassifierStats(c *gin.Context) {
+	stats, err := h.classifier.Stats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch classifier statistics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"classifier": stats})
+}
+
+// RetrainSpamClassifier rebuilds the spam classifier from all moderated comments (admin endpoint)
+// POST /api/admin/comments/classifier/retrain
+func (h *CommentHandler) RetrainSpamClassifier(c *gin.Context) {
+	stats, err := h.classifier.Retrain()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrain classifier"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"classifier": stats})
 }
\ No newline at end of file
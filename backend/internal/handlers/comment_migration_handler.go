@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// maxCommentImportSize limits the size of an uploaded Disqus or WordPress export
+const maxCommentImportSize = 50 << 20
+
+type CommentMigrationHandler struct {
+	migrationService *services.CommentMigrationService
+}
+
+func NewCommentMigrationHandler(migrationService *services.CommentMigrationService) *CommentMigrationHandler {
+	return &CommentMigrationHandler{
+		migrationService: migrationService,
+	}
+}
+
+// ImportComments imports comments from a Disqus or WordPress export (admin endpoint).
+// The file goes in the "file" form field. "format" is detected when left out, and "dry_run" reports without importing.
+// POST /api/admin/comments/import
+func (h *CommentMigrationHandler) ImportComments(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCommentImportSize)
+
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		return
+	}
+	defer file.Close()
+
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", "false"))
+
+	report, err := h.migrationService.Import(c.PostForm("format"), file, dryRun)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import comments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ExportComments downloads every comment in the Disqus XML format (admin endpoint)
+// GET /api/admin/comments/export
+func (h *CommentMigrationHandler) ExportComments(c *gin.Context) {
+	// Build the export first so a failure can still be reported as JSON
+	var buf bytes.Buffer
+	if err := h.migrationService.ExportDisqus(&buf, feedBaseURL(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export comments"})
+		return
+	}
+
+	filename := "comments-disqus-" + time.Now().Format("2006-01-02") + ".xml"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", buf.Bytes())
+}
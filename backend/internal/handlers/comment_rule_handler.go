@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"github.com/bytetopia/BlankoBlog/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type CommentRuleHandler struct {
+	ruleService *services.CommentRuleService
+	validator   *validator.Validate
+}
+
+func NewCommentRuleHandler(ruleService *services.CommentRuleService) *CommentRuleHandler {
+	return &CommentRuleHandler{
+		ruleService: ruleService,
+		validator:   validator.New(),
+	}
+}
+
+// GetRules lists all comment moderation rules with their hit counters (admin endpoint)
+// GET /api/admin/comment-rules
+func (h *CommentRuleHandler) GetRules(c *gin.Context) {
+	rules, err := h.ruleService.GetRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comment rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// GetRule retrieves a single comment moderation rule (admin endpoint)
+// GET /api/admin/comment-rules/:id
+func (h *CommentRuleHandler) GetRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	rule, err := h.ruleService.GetRuleByID(uint(id))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment rule not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comment rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rule": rule})
+}
+
+// CreateRule creates a comment moderation rule (admin endpoint)
+// POST /api/admin/comment-rules
+func (h *CommentRuleHandler) CreateRule(c *gin.Context) {
+	var req models.CreateCommentRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	// Validate request
+	if err := h.validator.Struct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.ruleService.CreateRule(req)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid rule") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment rule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"rule": rule})
+}
+
+// UpdateRule updates a comment moderation rule or resets its hit counter (admin endpoint)
+// PUT /api/admin/comment-rules/:id
+func (h *CommentRuleHandler) UpdateRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	var req models.UpdateCommentRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	// Validate request
+	if err := h.validator.Struct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.ruleService.UpdateRule(uint(id), req)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment rule not found"})
+			return
+		}
+		if strings.Contains(err.Error(), "invalid rule") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rule": rule})
+}
+
+// DeleteRule deletes a comment moderation rule (admin endpoint)
+// DELETE /api/admin/comment-rules/:id
+func (h *CommentRuleHandler) DeleteRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	if err := h.ruleService.DeleteRule(uint(id)); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment rule not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment rule deleted successfully"})
+}
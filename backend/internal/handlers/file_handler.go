@@ -1,38 +1,62 @@
 package handlers
 
 import (
+	"errors"
+	"log"
+	"mime"
 	"net/http"
+	"path"
 	"strconv"
+	"strings"
 
 	"github.com/bytetopia/BlankoBlog/backend/internal/models"
 	"github.com/bytetopia/BlankoBlog/backend/internal/services"
+	"github.com/bytetopia/BlankoBlog/backend/internal/storage"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+// maxUploadFormOverhead allows for the form fields sent along with an upload
+const maxUploadFormOverhead = 1 << 20
+
 type FileHandler struct {
-	fileService *services.FileService
+	fileService  *services.FileService
+	imageService *services.ImageService
+	notFound     gin.HandlerFunc // Renders the blog's 404 page for unknown uploads
 }
 
-func NewFileHandler(db *gorm.DB) *FileHandler {
+func NewFileHandler(fileService *services.FileService, imageService *services.ImageService, notFound gin.HandlerFunc) *FileHandler {
 	return &FileHandler{
-		fileService: services.NewFileService(db),
+		fileService:  fileService,
+		imageService: imageService,
+		notFound:     notFound,
 	}
 }
 
 // UploadFile handles POST /api/files
 func (h *FileHandler) UploadFile(c *gin.Context) {
-	// Get post_id from form
-	postIDStr := c.PostForm("post_id")
-	if postIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "post_id is required"})
+	// Refuse bodies larger than any allowed upload before reading them
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.fileService.MaxUploadSize()+maxUploadFormOverhead)
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid upload form"})
 		return
 	}
 	
-	postID, err := strconv.ParseUint(postIDStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post_id"})
-		return
+	// Get the optional post_id from form; files uploaded without one belong to the media library
+	var postID *uint
+	if postIDStr := c.PostForm("post_id"); postIDStr != "" {
+		id, err := strconv.ParseUint(postIDStr, 10, 32)
+		if err != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post_id"})
+			return
+		}
+		uintID := uint(id)
+		postID = &uintID
 	}
 	
 	// Get the file from the request
@@ -50,27 +74,29 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 	}
 	description := c.PostForm("description")
 	
-	// Save file to disk
-	serverPath, fileSize, mimeType, err := h.fileService.SaveUploadedFile(file, header)
-	if err != nil {
+	// Save file to storage, or find the blob already holding the same content, and create its record
+	fileRecord := &models.File{
+		PostID:      postID,
+		DisplayName: displayName,
+		Description: description,
+		Folder:      c.PostForm("folder"),
+	}
+	if err := h.fileService.SaveUploadedFile(file, header, fileRecord); err != nil {
+		switch {
+		case errors.Is(err, services.ErrUploadTypeNotAllowed):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, services.ErrUploadTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file: " + err.Error()})
 		return
 	}
 	
-	// Create file record in database
-	fileRecord := &models.File{
-		PostID:           uint(postID),
-		OriginalFileName: header.Filename,
-		DisplayName:      displayName,
-		Description:      description,
-		ServerPath:       serverPath,
-		FileSize:         fileSize,
-		MimeType:         mimeType,
-	}
-	
-	if err := h.fileService.CreateFile(fileRecord); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create file record"})
-		return
+	// Make resized copies of images; the original is still served if that fails
+	if err := h.imageService.ProcessImage(fileRecord); err != nil {
+		log.Printf("Warning: failed to process image %s: %v", fileRecord.ServerPath, err)
 	}
 	
 	// Return the created file
@@ -84,13 +110,36 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 }
 
 // GetFiles handles GET /api/files
+// Optional filters: type (image/png or image), folder ("" for the top level), usage (used or unused),
+// post_id (files used in a post) and q (search on the display name)
 func (h *FileHandler) GetFiles(c *gin.Context) {
 	// Parse query parameters
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
 	
+	filter := models.FileFilter{
+		Type:  c.Query("type"),
+		Usage: c.Query("usage"),
+		Query: strings.TrimSpace(c.Query("q")),
+	}
+	if folder, ok := c.GetQuery("folder"); ok {
+		filter.Folder = &folder
+	}
+	if filter.Usage != "" && filter.Usage != "used" && filter.Usage != "unused" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "usage must be used or unused"})
+		return
+	}
+	if postIDStr := c.Query("post_id"); postIDStr != "" {
+		postID, err := strconv.ParseUint(postIDStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post_id"})
+			return
+		}
+		filter.PostID = uint(postID)
+	}
+	
 	// Get files with pagination
-	files, total, err := h.fileService.GetFiles(page, limit)
+	files, total, err := h.fileService.GetFiles(page, limit, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch files"})
 		return
@@ -113,6 +162,17 @@ func (h *FileHandler) GetFiles(c *gin.Context) {
 	})
 }
 
+// GetFolders handles GET /api/files/folders
+func (h *FileHandler) GetFolders(c *gin.Context) {
+	folders, err := h.fileService.GetFolders()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch folders"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{"folders": folders})
+}
+
 // GetFile handles GET /api/files/:id
 func (h *FileHandler) GetFile(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -195,9 +255,48 @@ func (h *FileHandler) ServeFile(c *gin.Context) {
 		filepath = filepath[1:]
 	}
 	
-	// Get the full path on disk
-	fullPath := h.fileService.GetFullPath(filepath)
+	// Uploads are named after their detected type, so the extension gives the type to serve.
+	// Anything a browser could run, such as HTML or SVG, is sent as a sandboxed download.
+	contentType := mime.TypeByExtension(path.Ext(filepath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	
+	// Object storage can serve the file itself; the redirect is cached for less than the URL lasts
+	if h.fileService.RedirectUploads() {
+		signedURL, err := h.fileService.SignedUploadURL(filepath, contentType)
+		if err == nil {
+			c.Header("Cache-Control", "private, max-age=600")
+			c.Redirect(http.StatusFound, signedURL)
+			return
+		}
+		if errors.Is(err, storage.ErrNotExist) || errors.Is(err, storage.ErrInvalidKey) {
+			h.notFound(c)
+			return
+		}
+		if !errors.Is(err, storage.ErrSignedURLUnsupported) {
+			log.Printf("Warning: failed to sign URL for %s: %v", filepath, err)
+		}
+	}
+	
+	object, info, err := h.fileService.OpenUpload(filepath)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotExist) || errors.Is(err, storage.ErrInvalidKey) {
+			h.notFound(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer object.Close()
+	
+	c.Header("Content-Type", contentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	if !services.IsInlineType(contentType) {
+		c.Header("Content-Disposition", "attachment")
+		c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	}
 	
-	// Serve the file
-	c.File(fullPath)
+	// Serve the file, with support for range and conditional requests
+	http.ServeContent(c.Writer, c.Request, filepath, info.ModTime, object)
 }
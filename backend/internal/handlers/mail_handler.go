@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"github.com/bytetopia/BlankoBlog/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type MailHandler struct {
+	mailService *services.MailService
+	validator   *validator.Validate
+}
+
+func NewMailHandler(mailService *services.MailService) *MailHandler {
+	return &MailHandler{
+		mailService: mailService,
+		validator:   validator.New(),
+	}
+}
+
+// GetOutbox lists queued, sent and failed email (admin endpoint)
+// GET /api/admin/mail/outbox
+func (h *MailHandler) GetOutbox(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	messages, totalCount, err := h.mailService.GetOutbox(page, limit, c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch outbox"})
+		return
+	}
+
+	totalPages := (int(totalCount) + limit - 1) / limit
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages":   messages,
+		"configured": h.mailService.IsConfigured(),
+		"pagination": gin.H{
+			"current_page": page,
+			"total_pages":  totalPages,
+			"total_count":  totalCount,
+			"limit":        limit,
+		},
+	})
+}
+
+// RetryMessage puts a failed email back in the queue (admin endpoint)
+// POST /api/admin/mail/outbox/:id/retry
+func (h *MailHandler) RetryMessage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email ID"})
+		return
+	}
+
+	if err := h.mailService.RetryMessage(uint(id)); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unsent email not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email queued for retry"})
+}
+
+// SendTestMail sends an email right away to check the SMTP settings (admin endpoint)
+// POST /api/admin/mail/test
+func (h *MailHandler) SendTestMail(c *gin.Context) {
+	var req models.TestMailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	// Validate request
+	if err := h.validator.Struct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.mailService.SendTest(req.To); err != nil {
+		if errors.Is(err, services.ErrMailNotConfigured) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// The SMTP error is what the admin needs to fix their settings
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Test email sent"})
+}
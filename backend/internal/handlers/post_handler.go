@@ -12,26 +12,48 @@ import (
 )
 
 type PostHandler struct {
-	postService *services.PostService
+	postService     *services.PostService
+	revisionService *services.RevisionService
+	searchService   *services.SearchService
 }
 
 func NewPostHandler(db *gorm.DB) *PostHandler {
 	return &PostHandler{
-		postService: services.NewPostService(db),
+		postService:     services.NewPostService(db),
+		revisionService: services.NewRevisionService(db),
+		searchService:   services.NewSearchService(db),
 	}
 }
 
-// GetPosts handles GET /api/posts
+// GetPosts handles GET /api/posts (optional q parameter searches posts)
 func (h *PostHandler) GetPosts(c *gin.Context) {
 	// Parse query parameters
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 	publishedOnly := c.DefaultQuery("published", "true") == "true"
+	query := strings.TrimSpace(c.Query("q"))
 
-	posts, total, err := h.postService.GetPosts(page, limit, publishedOnly)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch posts"})
-		return
+	var posts []models.Post
+	var total int64
+	if query != "" {
+		// Full-text search, ranked by relevance
+		results, count, err := h.searchService.SearchPosts(query, page, limit, publishedOnly)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search posts"})
+			return
+		}
+		posts = make([]models.Post, len(results))
+		for i, result := range results {
+			posts[i] = result.Post
+		}
+		total = count
+	} else {
+		var err error
+		posts, total, err = h.postService.GetPosts(page, limit, publishedOnly)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch posts"})
+			return
+		}
 	}
 
 	// Convert to response format
@@ -86,6 +108,10 @@ func (h *PostHandler) CreatePost(c *gin.Context) {
 			c.JSON(http.StatusConflict, gin.H{"error": "A post with this title already exists"})
 			return
 		}
+		if strings.Contains(err.Error(), "cover file") || strings.Contains(err.Error(), "invalid comment mode") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create post"})
 		return
 	}
@@ -113,6 +139,10 @@ func (h *PostHandler) UpdatePost(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
 			return
 		}
+		if strings.Contains(err.Error(), "cover file") || strings.Contains(err.Error(), "invalid comment mode") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post"})
 		return
 	}
@@ -138,4 +168,117 @@ func (h *PostHandler) DeletePost(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
-}
\ No newline at end of file
+}
+
+// GetPostRevisions handles GET /api/admin/posts/:id/revisions (admin only)
+func (h *PostHandler) GetPostRevisions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	revisions, err := h.revisionService.GetRevisions(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch revisions"})
+		return
+	}
+
+	revisionResponses := make([]models.PostRevisionResponse, 0, len(revisions))
+	for _, revision := range revisions {
+		revisionResponses = append(revisionResponses, revision.ToResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revisions": revisionResponses})
+}
+
+// GetPostRevision handles GET /api/admin/posts/:id/revisions/:revisionId (admin only)
+func (h *PostHandler) GetPostRevision(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	revisionID, err := strconv.ParseUint(c.Param("revisionId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision ID"})
+		return
+	}
+
+	revision, err := h.revisionService.GetRevision(uint(id), uint(revisionID))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch revision"})
+		return
+	}
+
+	c.JSON(http.StatusOK, revision)
+}
+
+// DiffPostRevisions handles GET /api/admin/posts/:id/revisions/diff?from=&to= (admin only)
+// Both from and to accept a revision ID or "current" (the default for to).
+func (h *PostHandler) DiffPostRevisions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	from := c.Query("from")
+	if from == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from is required"})
+		return
+	}
+	to := c.DefaultQuery("to", "current")
+
+	diff, err := h.revisionService.DiffRevisions(uint(id), from, to)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post or revision not found"})
+			return
+		}
+		if strings.Contains(err.Error(), "invalid revision") || strings.Contains(err.Error(), "too large") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to diff revisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// RestorePostRevision handles POST /api/admin/posts/:id/revisions/:revisionId/restore (admin only)
+func (h *PostHandler) RestorePostRevision(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	revisionID, err := strconv.ParseUint(c.Param("revisionId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision ID"})
+		return
+	}
+
+	post, err := h.revisionService.RestoreRevision(uint(id), uint(revisionID))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post or revision not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore revision"})
+		return
+	}
+
+	c.JSON(http.StatusOK, post.ToResponse())
+}
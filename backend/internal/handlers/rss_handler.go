@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"net/http"
+	"os"
 	"strconv"
 
 	"github.com/bytetopia/BlankoBlog/backend/internal/services"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type RSSHandler struct {
@@ -19,26 +21,21 @@ func NewRSSHandler(rssService *services.RSSService) *RSSHandler {
 }
 
 // GetRSSFeed generates and returns RSS XML feed
+// GET /feed.xml, GET /tags/:id/feed.xml
 func (h *RSSHandler) GetRSSFeed(c *gin.Context) {
-	// Get limit parameter (default 20, max 50)
-	limitStr := c.DefaultQuery("limit", "20")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 {
-		limit = 20
-	}
-	if limit > 50 {
-		limit = 50
-	}
-
-	// Build base URL for the site
-	scheme := "http"
-	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
-		scheme = "https"
+	tagID, ok := feedTagID(c)
+	if !ok {
+		return
 	}
-	baseURL := scheme + "://" + c.Request.Host
+	limit := feedLimit(c)
+	fullContent := h.rssService.UseFullContent(c.Query("content"))
 
 	// Generate RSS feed
-	rssXML, err := h.rssService.GenerateRSSFeed(baseURL, limit)
+	rssXML, err := h.rssService.GenerateRSSFeed(feedBaseURL(c), tagID, limit, fullContent)
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate RSS feed"})
 		return
@@ -47,7 +44,98 @@ func (h *RSSHandler) GetRSSFeed(c *gin.Context) {
 	// Set appropriate headers for RSS feed
 	c.Header("Content-Type", "application/rss+xml; charset=utf-8")
 	c.Header("Cache-Control", "public, max-age=3600") // Cache for 1 hour
-	
+
 	// Return RSS XML
 	c.String(http.StatusOK, rssXML)
-}
\ No newline at end of file
+}
+
+// GetAtomFeed generates and returns an Atom 1.0 feed
+// GET /atom.xml, GET /tags/:id/atom.xml
+func (h *RSSHandler) GetAtomFeed(c *gin.Context) {
+	tagID, ok := feedTagID(c)
+	if !ok {
+		return
+	}
+	limit := feedLimit(c)
+	fullContent := h.rssService.UseFullContent(c.Query("content"))
+
+	atomXML, err := h.rssService.GenerateAtomFeed(feedBaseURL(c), tagID, limit, fullContent)
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate Atom feed"})
+		return
+	}
+
+	c.Header("Content-Type", "application/atom+xml; charset=utf-8")
+	c.Header("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+	c.String(http.StatusOK, atomXML)
+}
+
+// GetJSONFeed generates and returns a JSON Feed 1.1 document
+// GET /feed.json, GET /tags/:id/feed.json
+func (h *RSSHandler) GetJSONFeed(c *gin.Context) {
+	tagID, ok := feedTagID(c)
+	if !ok {
+		return
+	}
+	limit := feedLimit(c)
+	fullContent := h.rssService.UseFullContent(c.Query("content"))
+
+	feedJSON, err := h.rssService.GenerateJSONFeed(feedBaseURL(c), tagID, limit, fullContent)
+	if err == gorm.ErrRecordNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate JSON feed"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+	c.Data(http.StatusOK, "application/feed+json; charset=utf-8", feedJSON)
+}
+
+// feedTagID reads the optional tag ID route parameter, 0 meaning all posts.
+// It responds with 400 and returns false when the ID is invalid.
+func feedTagID(c *gin.Context) (uint, bool) {
+	idStr := c.Param("id")
+	if idStr == "" {
+		return 0, true
+	}
+
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// feedLimit reads the limit parameter (default 20, max 50)
+func feedLimit(c *gin.Context) int {
+	limitStr := c.DefaultQuery("limit", "20")
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 {
+		limit = 20
+	}
+	if limit > 50 {
+		limit = 50
+	}
+	return limit
+}
+
+// feedBaseURL builds the base URL for the site, preferring the BASE_URL environment variable
+func feedBaseURL(c *gin.Context) string {
+	if baseURL := os.Getenv("BASE_URL"); baseURL != "" {
+		return baseURL
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
@@ -54,12 +54,44 @@ func (h *SettingsHandler) UpdateConfigs(c *gin.Context) {
 
 	// Validate that only allowed config keys are being updated
 	allowedKeys := map[string]bool{
-		"blog_name":        true,
-		"blog_description": true,
-		"custom_css":       true,
-		"language":         true,
-		"blog_timezone":    true,
-		"footer_links":     true,
+		"blog_name":                   true,
+		"blog_description":            true,
+		"custom_css":                  true,
+		"language":                    true,
+		"blog_timezone":               true,
+		"footer_links":                true,
+		"feed_content":                true,
+		"robots_txt":                  true,
+		"default_share_image":         true,
+		"allowed_iframe_hosts":        true,
+		"code_highlight_style":        true,
+		"comment_min_submit_seconds":  true,
+		"comment_ip_rate_limit":       true,
+		"comment_post_rate_limit":     true,
+		"comment_rate_window_minutes": true,
+		"comment_pow_difficulty":      true,
+		"comment_auto_close_days":     true,
+		"avatar_source":               true,
+		"avatar_style":                true,
+		"image_thumbnail_width":       true,
+		"image_medium_width":          true,
+		"image_large_width":           true,
+		"image_jpeg_quality":          true,
+		"image_webp":                  true,
+		"upload_allowed_types":        true,
+		"upload_serve_mode":           true,
+		"spam_min_training":           true,
+		"spam_hide_threshold":         true,
+		"spam_approve_threshold":      true,
+		"smtp_host":                   true,
+		"smtp_port":                   true,
+		"smtp_tls_mode":               true,
+		"smtp_username":               true,
+		"smtp_password":               true,
+		"smtp_from":                   true,
+		"notify_email":                true,
+		"notify_new_comments":         true,
+		"notify_comment_replies":      true,
 	}
 
 	for key := range req.Configs {
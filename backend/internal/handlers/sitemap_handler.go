@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type SitemapHandler struct {
+	sitemapService *services.SitemapService
+}
+
+func NewSitemapHandler(sitemapService *services.SitemapService) *SitemapHandler {
+	return &SitemapHandler{
+		sitemapService: sitemapService,
+	}
+}
+
+// GetSitemap handles GET /sitemap.xml
+func (h *SitemapHandler) GetSitemap(c *gin.Context) {
+	sitemapXML, err := h.sitemapService.GenerateSitemap(feedBaseURL(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate sitemap"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", []byte(sitemapXML))
+}
+
+// GetSitemapPage handles GET /sitemaps/:page (e.g. /sitemaps/2.xml) for split sitemaps
+func (h *SitemapHandler) GetSitemapPage(c *gin.Context) {
+	page, err := strconv.Atoi(strings.TrimSuffix(c.Param("page"), ".xml"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sitemap not found"})
+		return
+	}
+
+	sitemapXML, err := h.sitemapService.GenerateSitemapPage(feedBaseURL(c), page)
+	if err == services.ErrSitemapPageNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sitemap not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate sitemap"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", []byte(sitemapXML))
+}
+
+// GetRobotsTxt handles GET /robots.txt
+func (h *SitemapHandler) GetRobotsTxt(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+	c.String(http.StatusOK, h.sitemapService.GenerateRobotsTxt(feedBaseURL(c)))
+}
@@ -1,11 +1,13 @@
 package handlers
 
 import (
-	"crypto/md5"
-	"fmt"
+	"encoding/json"
+	"errors"
+	"html"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -17,7 +19,6 @@ import (
 	"github.com/bytetopia/BlankoBlog/backend/internal/models"
 	"github.com/bytetopia/BlankoBlog/backend/internal/services"
 	"github.com/gin-gonic/gin"
-	"github.com/russross/blackfriday/v2"
 	"gorm.io/gorm"
 )
 
@@ -25,11 +26,17 @@ import (
 type TemplateHandler struct {
 	db            *gorm.DB
 	configService *services.ConfigService
+	searchService *services.SearchService
+	markdown      *services.MarkdownService
+	submissions   *services.CommentSubmissionService
+	comments      *services.CommentService
+	notifier      *services.CommentNotificationService
+	images        *services.ImageService
 	templates     *template.Template
 }
 
 // NewTemplateHandler creates a new template handler
-func NewTemplateHandler(db *gorm.DB, configService *services.ConfigService) *TemplateHandler {
+func NewTemplateHandler(db *gorm.DB, configService *services.ConfigService, submissions *services.CommentSubmissionService, comments *services.CommentService, notifier *services.CommentNotificationService, images *services.ImageService) *TemplateHandler {
 	// Parse all HTML templates
 	templates, err := template.ParseGlob(filepath.Join("templates", "html", "*.gohtml"))
 	if err != nil {
@@ -39,6 +46,12 @@ func NewTemplateHandler(db *gorm.DB, configService *services.ConfigService) *Tem
 	return &TemplateHandler{
 		db:            db,
 		configService: configService,
+		searchService: services.NewSearchService(db),
+		markdown:      services.NewMarkdownService(configService, services.NewSanitizerService(configService)),
+		submissions:   submissions,
+		comments:      comments,
+		notifier:      notifier,
+		images:        images,
 		templates:     templates,
 	}
 }
@@ -55,6 +68,7 @@ type PostListData struct {
 	T               i18n.Translations
 	Language        string
 	CustomCSS       template.CSS
+	Meta            PageMeta
 }
 
 // PostDetailData represents data for the post detail template
@@ -65,12 +79,57 @@ type PostDetailData struct {
 	Year            int
 	Post            PostData
 	Comments        []CommentData
+	CommentForm     models.CommentFormResponse
+	CommentNotice   string // Outcome of the last comment submission, shown above the form
+	CommentsVisible bool   // False when the post's comment mode is hidden
+	CommentsOpen    bool   // Whether the form is shown and new comments are accepted
 	FooterLinks     []models.FooterLink
 	T               i18n.Translations
 	Language        string
 	CustomCSS       template.CSS
+	Meta            PageMeta
+	HighlightStyle  string
 }
 
+// PageMeta represents the OpenGraph, Twitter Card and JSON-LD metadata of a page
+type PageMeta struct {
+	Type          string // og:type, "website" or "article"
+	SiteName      string
+	Title         string
+	Description   string
+	URL           string
+	Image         string // Absolute image URL, empty when there is none
+	PublishedTime string // RFC 3339, articles only
+	ModifiedTime  string // RFC 3339, articles only
+	Tags          []string
+	JSONLD        template.JS
+}
+
+// jsonLDBlogPosting is the schema.org BlogPosting structured data of a post
+type jsonLDBlogPosting struct {
+	Context          string       `json:"@context"`
+	Type             string       `json:"@type"`
+	Headline         string       `json:"headline"`
+	Description      string       `json:"description,omitempty"`
+	Image            string       `json:"image,omitempty"`
+	URL              string       `json:"url"`
+	MainEntityOfPage string       `json:"mainEntityOfPage"`
+	DatePublished    string       `json:"datePublished"`
+	DateModified     string       `json:"dateModified"`
+	Keywords         string       `json:"keywords,omitempty"`
+	Author           jsonLDEntity `json:"author"`
+	Publisher        jsonLDEntity `json:"publisher"`
+}
+
+// jsonLDEntity is a schema.org Organization or Person
+type jsonLDEntity struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+// metaDescriptionLength is the maximum length in characters of generated page descriptions
+const metaDescriptionLength = 200
+
 // TagListData represents data for the tag list template (both tag list and tag posts)
 type TagListData struct {
 	BlogName        string
@@ -87,10 +146,42 @@ type TagListData struct {
 	CustomCSS       template.CSS
 }
 
+// SearchData represents data for the search results template
+type SearchData struct {
+	BlogName        string
+	BlogDescription string
+	BaseURL         string
+	Year            int
+	Query           string
+	Results         []SearchResultData
+	Pagination      PaginationData
+	FooterLinks     []models.FooterLink
+	T               i18n.Translations
+	Language        string
+	CustomCSS       template.CSS
+}
+
 // NotFoundData represents data for the 404 page template
 type NotFoundData struct {
+	BlogName    string
+	BaseURL     string
+	Year        int
+	FooterLinks []models.FooterLink
+	T           i18n.Translations
+	Language    string
+	CustomCSS   template.CSS
+}
+
+// CommentActionData represents data for the pages behind the links in notification emails
+type CommentActionData struct {
 	BlogName    string
 	Year        int
+	Title       string
+	Comment     *models.Comment
+	PostTitle   string
+	PostSlug    string
+	SubmitText  string            // Confirmation button, empty when there is nothing left to confirm
+	FormFields  map[string]string // Hidden fields posted back with the confirmation
 	FooterLinks []models.FooterLink
 	T           i18n.Translations
 	Language    string
@@ -107,10 +198,18 @@ type PostData struct {
 	Slug          string
 	ViewCount     uint
 	Tags          []TagData
+	TOC           []services.TOCEntry // Nested headings, empty for posts with too few headings
 	CreatedAt     time.Time
 	FormattedDate string
 }
 
+// SearchResultData represents a single search hit for templates
+type SearchResultData struct {
+	Post      PostData
+	TitleHTML template.HTML
+	Snippet   template.HTML
+}
+
 // TagData represents a tag for templates
 type TagData struct {
 	ID    uint
@@ -129,14 +228,23 @@ type TagWithCountData struct {
 // CommentData represents a comment for templates
 type CommentData struct {
 	ID            uint
+	ParentID      uint
+	ParentName    string
+	Depth         int // Nesting level in the thread, capped at maxCommentDepth
+	Indent        int // Left indentation in pixels derived from Depth
+	IsAuthor      bool
 	Name          string
 	Email         string
-	EmailHash     string
+	AvatarURL     string
 	Content       string
+	ContentHTML   template.HTML // Rendered and sanitized by services.RenderCommentMarkdown
 	CreatedAt     time.Time
 	FormattedDate string
 }
 
+// maxCommentDepth limits how deeply replies are indented on the page
+const maxCommentDepth = 3
+
 // PaginationData represents pagination information
 type PaginationData struct {
 	Page       int
@@ -197,7 +305,7 @@ func (h *TemplateHandler) getCustomCSS() template.CSS {
 	if err != nil || customCSS == "" {
 		return template.CSS("")
 	}
-	return template.CSS(customCSS)
+	return template.CSS(services.SanitizeCSS(customCSS))
 }
 
 // formatDate formats a time to a readable string using the configured timezone
@@ -230,10 +338,10 @@ func (h *TemplateHandler) convertPostToData(post models.Post) PostData {
 		}
 	}
 
-	// Convert markdown to HTML
-	htmlContent := string(blackfriday.Run([]byte(post.Content)))
-	// Add lazy loading to images
-	htmlContent = addLazyLoadingToImages(htmlContent)
+	// Convert markdown to sanitized HTML with highlighted code and heading anchors
+	rendered := h.markdown.Render(post.Content)
+	// Serve uploaded images in fitting sizes and add lazy loading
+	htmlContent := addLazyLoadingToImages(h.addResponsiveImages(rendered.HTML))
 	contentHTML := template.HTML(htmlContent)
 
 	return PostData{
@@ -245,6 +353,7 @@ func (h *TemplateHandler) convertPostToData(post models.Post) PostData {
 		Slug:          post.Slug,
 		ViewCount:     post.ViewCount,
 		Tags:          tags,
+		TOC:           rendered.TOC,
 		CreatedAt:     post.CreatedAt,
 		FormattedDate: h.formatDate(post.CreatedAt),
 	}
@@ -303,8 +412,8 @@ func (h *TemplateHandler) RenderPostList(c *gin.Context) {
 
 	// Get published posts with tags
 	offset := (page - 1) * limit
-	h.db.Model(&models.Post{}).Where("published = ?", true).Count(&total)
-	h.db.Where("published = ?", true).
+	h.db.Model(&models.Post{}).Scopes(services.PublishedPosts).Count(&total)
+	h.db.Scopes(services.PublishedPosts).
 		Preload("Tags").
 		Order("created_at DESC").
 		Limit(limit).
@@ -339,6 +448,14 @@ func (h *TemplateHandler) RenderPostList(c *gin.Context) {
 		T:               h.getTranslations(),
 		Language:        h.getLanguage(),
 		CustomCSS:       h.getCustomCSS(),
+		Meta: PageMeta{
+			Type:        "website",
+			SiteName:    blogName,
+			Title:       blogName,
+			Description: blogDescription,
+			URL:         baseURL + "/",
+			Image:       h.getDefaultShareImage(baseURL),
+		},
 	}
 
 	if err := h.templates.ExecuteTemplate(c.Writer, "post-list.gohtml", data); err != nil {
@@ -352,53 +469,71 @@ func (h *TemplateHandler) RenderPostDetail(c *gin.Context) {
 	slug := c.Param("slug")
 
 	var post models.Post
-	if err := h.db.Where("slug = ? AND published = ?", slug, true).Preload("Tags").First(&post).Error; err != nil {
+	if err := h.db.Where("slug = ?", slug).Scopes(services.PublishedPosts).Preload("Tags").First(&post).Error; err != nil {
 		h.Render404(c)
 		return
 	}
 
 	// Increment view count
-	h.db.Model(&post).Update("view_count", post.ViewCount+1)
+	// UpdateColumn keeps updated_at untouched so it still reflects content changes
+	h.db.Model(&post).UpdateColumn("view_count", post.ViewCount+1)
 	post.ViewCount++
 
-	// Get approved comments
+	commentMode := h.submissions.CommentMode(&post)
+	commentsOpen := h.submissions.AcceptsComments(&post)
+
+	// Get approved comments, unless the post hides them
 	var comments []models.Comment
-	h.db.Where("post_id = ? AND status = ?", post.ID, "approved").
-		Order("created_at ASC").
-		Find(&comments)
-
-	// Convert comments to template data
-	commentData := make([]CommentData, len(comments))
-	for i, comment := range comments {
-		emailHash := fmt.Sprintf("%x", md5.Sum([]byte(comment.Email)))
-		commentData[i] = CommentData{
-			ID:            comment.ID,
-			Name:          comment.Name,
-			Email:         comment.Email,
-			EmailHash:     emailHash,
-			Content:       comment.Content,
-			CreatedAt:     comment.CreatedAt,
-			FormattedDate: h.formatDate(comment.CreatedAt),
+	if commentMode != services.CommentModeHidden {
+		var err error
+		comments, err = h.comments.GetApprovedComments(post.ID)
+		if err != nil {
+			log.Printf("Error fetching comments: %v", err)
 		}
 	}
 
+	// Convert comments to threaded template data
+	commentData := h.buildCommentThread(comments)
+
 	// Get base data
 	blogName, blogDescription, baseURL, _ := h.getBaseData(c)
 
 	// Get footer links
 	footerLinks, _ := h.configService.GetFooterLinks()
 
+	postData := h.convertPostToData(post)
+
+	t := h.getTranslations()
+
+	var commentForm models.CommentFormResponse
+	if commentsOpen {
+		var err error
+		commentForm, err = h.submissions.NewForm(post.ID)
+		if err != nil {
+			log.Printf("Error preparing comment form: %v", err)
+		}
+
+		// The form is only rendered for pages that aren't cached, so a fresh token per view is fine
+		c.Header("Cache-Control", "no-store")
+	}
+
 	data := PostDetailData{
 		BlogName:        blogName,
 		BlogDescription: blogDescription,
 		BaseURL:         baseURL,
 		Year:            time.Now().Year(),
-		Post:            h.convertPostToData(post),
+		Post:            postData,
 		Comments:        commentData,
+		CommentForm:     commentForm,
+		CommentNotice:   commentNotice(t, c.Query("comment")),
+		CommentsVisible: commentMode != services.CommentModeHidden,
+		CommentsOpen:    commentsOpen,
 		FooterLinks:     footerLinks,
-		T:               h.getTranslations(),
+		T:               t,
 		Language:        h.getLanguage(),
 		CustomCSS:       h.getCustomCSS(),
+		Meta:            h.buildPostMeta(post, postData, blogName, baseURL),
+		HighlightStyle:  h.markdown.HighlightStyle(),
 	}
 
 	if err := h.templates.ExecuteTemplate(c.Writer, "post-detail.gohtml", data); err != nil {
@@ -407,6 +542,147 @@ func (h *TemplateHandler) RenderPostDetail(c *gin.Context) {
 	}
 }
 
+// ServeHighlightCSS handles GET /highlight.css, the stylesheet for highlighted code blocks.
+// The style query parameter selects the style, defaulting to the configured one.
+func (h *TemplateHandler) ServeHighlightCSS(c *gin.Context) {
+	css, err := h.markdown.HighlightCSS(c.Query("style"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error generating stylesheet")
+		return
+	}
+
+	// Pages reference the stylesheet with the style name, so it can be cached for long
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "text/css; charset=utf-8", []byte(css))
+}
+
+// buildPostMeta builds the social sharing metadata of a post page.
+// The image is the post's cover file, else the first image in the post, else the site-wide default.
+func (h *TemplateHandler) buildPostMeta(post models.Post, postData PostData, blogName, baseURL string) PageMeta {
+	description := post.Summary
+	if description == "" {
+		description = plainTextExcerpt(string(postData.ContentHTML), metaDescriptionLength)
+	}
+
+	image := ""
+	if post.CoverFileID != nil {
+		var file models.File
+		if err := h.db.First(&file, *post.CoverFileID).Error; err == nil && strings.HasPrefix(file.MimeType, "image/") {
+			image = baseURL + "/uploads/" + file.ServerPath
+		}
+	}
+	if image == "" {
+		if match := firstImageRegex.FindStringSubmatch(string(postData.ContentHTML)); match != nil {
+			image = absoluteURL(baseURL, html.UnescapeString(match[1]))
+		}
+	}
+	if image == "" {
+		image = h.getDefaultShareImage(baseURL)
+	}
+
+	meta := PageMeta{
+		Type:          "article",
+		SiteName:      blogName,
+		Title:         post.Title,
+		Description:   description,
+		URL:           baseURL + "/posts/" + post.Slug,
+		Image:         image,
+		PublishedTime: post.CreatedAt.UTC().Format(time.RFC3339),
+		ModifiedTime:  post.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	for _, tag := range post.Tags {
+		meta.Tags = append(meta.Tags, tag.Name)
+	}
+
+	// json.Marshal escapes <, > and &, so the result is safe inside a script element
+	jsonLD, err := json.Marshal(jsonLDBlogPosting{
+		Context:          "https://schema.org",
+		Type:             "BlogPosting",
+		Headline:         meta.Title,
+		Description:      meta.Description,
+		Image:            meta.Image,
+		URL:              meta.URL,
+		MainEntityOfPage: meta.URL,
+		DatePublished:    meta.PublishedTime,
+		DateModified:     meta.ModifiedTime,
+		Keywords:         strings.Join(meta.Tags, ", "),
+		Author:           jsonLDEntity{Type: "Organization", Name: blogName},
+		Publisher:        jsonLDEntity{Type: "Organization", Name: blogName},
+	})
+	if err == nil {
+		meta.JSONLD = template.JS(jsonLD)
+	}
+
+	return meta
+}
+
+// getDefaultShareImage returns the absolute URL of the site-wide fallback share image, if configured
+func (h *TemplateHandler) getDefaultShareImage(baseURL string) string {
+	image, err := h.configService.GetConfig("default_share_image")
+	if err != nil {
+		return ""
+	}
+	return absoluteURL(baseURL, strings.TrimSpace(image))
+}
+
+// buildCommentThread orders comments depth-first so replies follow their parent.
+// Replies to comments that aren't shown are promoted to the top level.
+func (h *TemplateHandler) buildCommentThread(comments []models.Comment) []CommentData {
+	byID := make(map[uint]models.Comment, len(comments))
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+	}
+
+	var roots []models.Comment
+	children := make(map[uint][]models.Comment)
+	for _, comment := range comments {
+		if comment.ParentID != nil {
+			if _, ok := byID[*comment.ParentID]; ok {
+				children[*comment.ParentID] = append(children[*comment.ParentID], comment)
+				continue
+			}
+		}
+		roots = append(roots, comment)
+	}
+
+	commentData := make([]CommentData, 0, len(comments))
+	var appendComment func(comment models.Comment, depth int)
+	appendComment = func(comment models.Comment, depth int) {
+		if depth > maxCommentDepth {
+			depth = maxCommentDepth
+		}
+
+		data := CommentData{
+			ID:            comment.ID,
+			Depth:         depth,
+			Indent:        depth * 30,
+			IsAuthor:      comment.IsAuthor,
+			Name:          comment.Name,
+			Email:         comment.Email,
+			AvatarURL:     comment.AvatarURL(),
+			Content:       comment.Content,
+			ContentHTML:   template.HTML(comment.ContentHTML),
+			CreatedAt:     comment.CreatedAt,
+			FormattedDate: h.formatDate(comment.CreatedAt),
+		}
+		if comment.ParentID != nil && depth > 0 {
+			data.ParentID = *comment.ParentID
+			data.ParentName = byID[*comment.ParentID].Name
+		}
+		commentData = append(commentData, data)
+
+		for _, child := range children[comment.ID] {
+			appendComment(child, depth+1)
+		}
+	}
+
+	for _, root := range roots {
+		appendComment(root, 0)
+	}
+
+	return commentData
+}
+
 // RenderTagList renders the tag list page
 func (h *TemplateHandler) RenderTagList(c *gin.Context) {
 	var tags []models.Tag
@@ -418,7 +694,8 @@ func (h *TemplateHandler) RenderTagList(c *gin.Context) {
 		var count int64
 		h.db.Model(&models.Post{}).
 			Joins("JOIN post_tags ON post_tags.post_id = posts.id").
-			Where("post_tags.tag_id = ? AND posts.published = ?", tag.ID, true).
+			Where("post_tags.tag_id = ?", tag.ID).
+			Scopes(services.PublishedPosts).
 			Count(&count)
 
 		tagData[i] = TagWithCountData{
@@ -481,11 +758,13 @@ func (h *TemplateHandler) RenderTagPosts(c *gin.Context) {
 	offset := (page - 1) * limit
 	h.db.Model(&models.Post{}).
 		Joins("JOIN post_tags ON post_tags.post_id = posts.id").
-		Where("post_tags.tag_id = ? AND posts.published = ?", tagID, true).
+		Where("post_tags.tag_id = ?", tagID).
+		Scopes(services.PublishedPosts).
 		Count(&total)
 
 	h.db.Joins("JOIN post_tags ON post_tags.post_id = posts.id").
-		Where("post_tags.tag_id = ? AND posts.published = ?", tagID, true).
+		Where("post_tags.tag_id = ?", tagID).
+		Scopes(services.PublishedPosts).
 		Preload("Tags").
 		Order("posts.created_at DESC").
 		Limit(limit).
@@ -535,16 +814,73 @@ func (h *TemplateHandler) RenderTagPosts(c *gin.Context) {
 	}
 }
 
+// RenderSearch renders the search results page
+func (h *TemplateHandler) RenderSearch(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	limit := 10
+
+	results, total, err := h.searchService.SearchPosts(query, page, limit, true)
+	if err != nil {
+		log.Printf("Error searching posts: %v", err)
+	}
+
+	// Convert results to template data (snippets are escaped by the search service)
+	resultData := make([]SearchResultData, len(results))
+	for i, result := range results {
+		resultData[i] = SearchResultData{
+			Post:      h.convertPostToData(result.Post),
+			TitleHTML: template.HTML(result.TitleHighlight),
+			Snippet:   template.HTML(result.Snippet),
+		}
+	}
+
+	// Calculate pagination
+	totalPages := int((total + int64(limit) - 1) / int64(limit))
+	pagination := calculatePagination(page, totalPages)
+	pagination.Total = int(total)
+
+	// Get base data
+	blogName, blogDescription, baseURL, _ := h.getBaseData(c)
+
+	// Get footer links
+	footerLinks, _ := h.configService.GetFooterLinks()
+
+	data := SearchData{
+		BlogName:        blogName,
+		BlogDescription: blogDescription,
+		BaseURL:         baseURL,
+		Year:            time.Now().Year(),
+		Query:           query,
+		Results:         resultData,
+		Pagination:      pagination,
+		FooterLinks:     footerLinks,
+		T:               h.getTranslations(),
+		Language:        h.getLanguage(),
+		CustomCSS:       h.getCustomCSS(),
+	}
+
+	if err := h.templates.ExecuteTemplate(c.Writer, "search.gohtml", data); err != nil {
+		log.Printf("Error rendering template: %v", err)
+		c.String(http.StatusInternalServerError, "Error rendering page")
+	}
+}
+
 // Render404 renders the 404 not found page
 func (h *TemplateHandler) Render404(c *gin.Context) {
 	// Get base data
-	blogName, _, _, _ := h.getBaseData(c)
+	blogName, _, baseURL, _ := h.getBaseData(c)
 
 	// Get footer links
 	footerLinks, _ := h.configService.GetFooterLinks()
 
 	data := NotFoundData{
 		BlogName:    blogName,
+		BaseURL:     baseURL,
 		Year:        time.Now().Year(),
 		FooterLinks: footerLinks,
 		T:           h.getTranslations(),
@@ -559,39 +895,340 @@ func (h *TemplateHandler) Render404(c *gin.Context) {
 	}
 }
 
-// HandleCommentSubmit handles comment form submission
+// HandleCommentSubmit handles comment form submission.
+// Submissions go through the same pipeline as the JSON API, and the outcome is shown above the form.
 func (h *TemplateHandler) HandleCommentSubmit(c *gin.Context) {
 	slug := c.Param("slug")
 
 	// Get the post
 	var post models.Post
-	if err := h.db.Where("slug = ? AND published = ?", slug, true).First(&post).Error; err != nil {
+	if err := h.db.Where("slug = ?", slug).Scopes(services.PublishedPosts).First(&post).Error; err != nil {
 		c.Redirect(http.StatusSeeOther, "/posts/"+slug)
 		return
 	}
 
-	// Get form data
-	name := c.PostForm("name")
-	email := c.PostForm("email")
-	content := c.PostForm("content")
-
-	// Create comment
-	comment := models.Comment{
-		PostID:    post.ID,
-		Name:      name,
-		Email:     email,
-		Content:   content,
-		Status:    "pending",
-		IPAddress: c.ClientIP(),
-		Referer:   c.Request.Referer(),
+	req := models.CreateCommentRequest{
+		Name:          c.PostForm("name"),
+		Email:         c.PostForm("email"),
+		Content:       c.PostForm("content"),
+		NotifyReplies: c.PostForm("notify_replies") != "",
+		FormToken:     c.PostForm("form_token"),
+		PowNonce:      c.PostForm("pow_nonce"),
+		Website:       c.PostForm("website"),
+	}
+	if parentParam := c.PostForm("parent_id"); parentParam != "" {
+		id, err := strconv.ParseUint(parentParam, 10, 32)
+		if err != nil {
+			redirectAfterComment(c, slug, "invalid")
+			return
+		}
+		parentID := uint(id)
+		req.ParentID = &parentID
 	}
 
-	if err := h.db.Create(&comment).Error; err != nil {
-		log.Printf("Error creating comment: %v", err)
+	if _, err := h.submissions.Submit(&post, req, c.ClientIP(), c.Request.Referer()); err != nil {
+		var invalid *services.CommentValidationError
+		var rejected *services.CommentRejectedError
+		switch {
+		case errors.Is(err, services.ErrCommentsClosed):
+			redirectAfterComment(c, slug, "closed")
+		case errors.As(err, &invalid):
+			redirectAfterComment(c, slug, "invalid")
+		case errors.As(err, &rejected):
+			redirectAfterComment(c, slug, "rejected")
+		default:
+			log.Printf("Error creating comment: %v", err)
+			redirectAfterComment(c, slug, "error")
+		}
+		return
 	}
 
 	// Redirect back to post
-	c.Redirect(http.StatusSeeOther, "/posts/"+slug)
+	redirectAfterComment(c, slug, "submitted")
+}
+
+// redirectAfterComment sends the reader back to the comment form with the outcome of the submission
+func redirectAfterComment(c *gin.Context, slug, outcome string) {
+	c.Redirect(http.StatusSeeOther, "/posts/"+slug+"?comment="+outcome+"#comment-form")
+}
+
+// commentNotice returns the message for a comment submission outcome, empty for unknown outcomes
+func commentNotice(t i18n.Translations, outcome string) string {
+	switch outcome {
+	case "submitted":
+		return t.CommentSubmitted
+	case "invalid":
+		return t.CommentInvalid
+	case "rejected":
+		return t.CommentRejected
+	case "error":
+		return t.CommentError
+	case "closed":
+		return t.CommentsClosed
+	default:
+		return ""
+	}
+}
+
+// RenderCommentModeration asks the admin to confirm the action of a moderation link from a notification email.
+// The change itself needs a POST, so mail scanners that follow links can't approve or hide comments.
+func (h *TemplateHandler) RenderCommentModeration(c *gin.Context) {
+	h.moderateComment(c, c.Query("action"), c.Query("expires"), c.Query("sig"), false)
+}
+
+// HandleCommentModeration applies a confirmed moderation link
+func (h *TemplateHandler) HandleCommentModeration(c *gin.Context) {
+	h.moderateComment(c, c.PostForm("action"), c.PostForm("expires"), c.PostForm("sig"), true)
+}
+
+func (h *TemplateHandler) moderateComment(c *gin.Context, action, expires, signature string, confirmed bool) {
+	t := h.getTranslations()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	status := services.ModerationActionStatus(action)
+	if err != nil || status == "" || !h.notifier.VerifyModerationLink(uint(id), action, expires, signature) {
+		h.renderCommentAction(c, http.StatusForbidden, CommentActionData{Title: t.LinkInvalid})
+		return
+	}
+
+	comment, err := h.comments.GetCommentByID(uint(id))
+	if err != nil {
+		h.renderCommentAction(c, http.StatusNotFound, CommentActionData{Title: t.LinkInvalid})
+		return
+	}
+
+	data := CommentActionData{
+		Comment:   comment,
+		PostTitle: comment.Post.Title,
+		PostSlug:  comment.Post.Slug,
+	}
+
+	if comment.Status == status {
+		data.Title = t.ModerateDone
+		h.renderCommentAction(c, http.StatusOK, data)
+		return
+	}
+
+	if !confirmed {
+		data.Title, data.SubmitText = t.ModerateApprovePrompt, t.ModerateApprove
+		if action == "hide" {
+			data.Title, data.SubmitText = t.ModerateHidePrompt, t.ModerateHide
+		}
+		data.FormFields = map[string]string{"action": action, "expires": expires, "sig": signature}
+		h.renderCommentAction(c, http.StatusOK, data)
+		return
+	}
+
+	if err := h.comments.UpdateCommentStatus(comment.ID, status); err != nil {
+		log.Printf("Error moderating comment from email link: %v", err)
+		c.String(http.StatusInternalServerError, "Failed to update comment")
+		return
+	}
+
+	comment.Status = status
+	data.Title = t.ModerateDone
+	h.renderCommentAction(c, http.StatusOK, data)
+}
+
+// RenderCommentUnsubscribe asks a commenter to confirm they no longer want emails about replies
+func (h *TemplateHandler) RenderCommentUnsubscribe(c *gin.Context) {
+	t := h.getTranslations()
+	data := CommentActionData{
+		Title:      t.UnsubscribePrompt,
+		SubmitText: t.Unsubscribe,
+		FormFields: map[string]string{"sig": c.Query("sig")},
+	}
+	h.renderCommentAction(c, http.StatusOK, data)
+}
+
+// HandleCommentUnsubscribe turns off reply notifications for the commenter behind a signed link
+func (h *TemplateHandler) HandleCommentUnsubscribe(c *gin.Context) {
+	t := h.getTranslations()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		h.renderCommentAction(c, http.StatusForbidden, CommentActionData{Title: t.LinkInvalid})
+		return
+	}
+
+	if err := h.notifier.Unsubscribe(uint(id), c.PostForm("sig")); err != nil {
+		if strings.Contains(err.Error(), "invalid") || strings.Contains(err.Error(), "not found") {
+			h.renderCommentAction(c, http.StatusForbidden, CommentActionData{Title: t.LinkInvalid})
+			return
+		}
+		log.Printf("Error unsubscribing from reply notifications: %v", err)
+		c.String(http.StatusInternalServerError, "Failed to unsubscribe")
+		return
+	}
+
+	h.renderCommentAction(c, http.StatusOK, CommentActionData{Title: t.Unsubscribed})
+}
+
+// renderCommentAction fills in the common page data and renders the comment action page
+func (h *TemplateHandler) renderCommentAction(c *gin.Context, status int, data CommentActionData) {
+	data.BlogName, _, _, _ = h.getBaseData(c)
+	data.Year = time.Now().Year()
+	data.FooterLinks, _ = h.configService.GetFooterLinks()
+	data.T = h.getTranslations()
+	data.Language = h.getLanguage()
+	data.CustomCSS = h.getCustomCSS()
+
+	// Signed links must not end up in shared caches
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	if err := h.templates.ExecuteTemplate(c.Writer, "comment-action.gohtml", data); err != nil {
+		log.Printf("Error rendering comment action template: %v", err)
+		c.String(http.StatusInternalServerError, "Error rendering page")
+	}
+}
+
+// firstImageRegex matches the source of the first img tag in rendered post HTML
+var firstImageRegex = regexp.MustCompile(`<img[^>]*?\ssrc=["']([^"']+)["']`)
+
+// absoluteURL resolves a site-relative URL against the base URL.
+// Absolute http(s) URLs are returned as is, anything else is dropped.
+func absoluteURL(baseURL, rawURL string) string {
+	switch {
+	case strings.HasPrefix(rawURL, "http://"), strings.HasPrefix(rawURL, "https://"):
+		return rawURL
+	case strings.HasPrefix(rawURL, "//"):
+		return "https:" + rawURL
+	case strings.HasPrefix(rawURL, "/"):
+		return baseURL + rawURL
+	default:
+		return ""
+	}
+}
+
+// plainTextExcerpt strips tags from HTML and truncates the text at a word boundary
+func plainTextExcerpt(htmlContent string, maxLength int) string {
+	text := html.UnescapeString(htmlTagRegex.ReplaceAllString(htmlContent, " "))
+	text = strings.Join(strings.Fields(text), " ")
+
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+
+	truncated := string(runes[:maxLength])
+	if lastSpace := strings.LastIndex(truncated, " "); lastSpace > len(truncated)/2 {
+		truncated = truncated[:lastSpace]
+	}
+	return truncated + "…"
+}
+
+// htmlTagRegex matches HTML tags
+var htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// uploadImageRegex matches img tags showing an uploaded file and captures their source
+var uploadImageRegex = regexp.MustCompile(`<img[^>]*?\ssrc="([^"]*/uploads/[^"]+)"[^>]*>`)
+
+// responsiveImageSizes tells browsers how wide post images are shown, at most the width of the page
+const responsiveImageSizes = "(max-width: 720px) 100vw, 720px"
+
+// addResponsiveImages gives uploaded images a srcset of their resized copies and shows the
+// largest copy by default. Where WebP copies exist the image is wrapped in a picture element
+// offering them to browsers that support WebP.
+func (h *TemplateHandler) addResponsiveImages(content string) string {
+	matches := uploadImageRegex.FindAllStringSubmatch(content, -1)
+	if len(matches) == 0 {
+		return content
+	}
+
+	serverPaths := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if serverPath, ok := uploadServerPath(match[1]); ok {
+			serverPaths = append(serverPaths, serverPath)
+		}
+	}
+	if len(serverPaths) == 0 {
+		return content
+	}
+
+	images, err := h.images.ResponsiveImages(serverPaths)
+	if err != nil {
+		log.Printf("Warning: failed to load image variants: %v", err)
+		return content
+	}
+
+	return uploadImageRegex.ReplaceAllStringFunc(content, func(tag string) string {
+		src := uploadImageRegex.FindStringSubmatch(tag)[1]
+		serverPath, ok := uploadServerPath(src)
+		if !ok {
+			return tag
+		}
+		file, ok := images[serverPath]
+		if !ok {
+			return tag
+		}
+
+		// Copies are linked the way the original is, keeping the host of absolute URLs
+		prefix := src[:strings.Index(src, "/uploads/")] + "/uploads/"
+		var srcset, names []string
+		webpCandidates := make(map[string]string)
+		var largest models.FileVariant
+		hasLarge := false
+		for _, variant := range file.Variants {
+			candidate := html.EscapeString(prefix+variant.ServerPath) + " " + strconv.Itoa(variant.Width) + "w"
+			if variant.MimeType == file.MimeType {
+				srcset = append(srcset, candidate)
+				names = append(names, variant.Name)
+				largest = variant
+				hasLarge = hasLarge || variant.Name == services.ImageVariantLarge
+			} else if variant.Format == "webp" {
+				webpCandidates[variant.Name] = candidate
+			}
+		}
+		if len(srcset) == 0 {
+			return tag
+		}
+		// Without a large copy the original is no larger than one and serves as it,
+		// for WebP browsers too as browsers go by the content of the file rather than the source type
+		if !hasLarge {
+			srcset = append(srcset, html.EscapeString(prefix+file.ServerPath)+" "+strconv.Itoa(file.Width)+"w")
+			names = append(names, "")
+			largest = models.FileVariant{ServerPath: file.ServerPath, Width: file.Width, Height: file.Height}
+		}
+
+		// Browsers taking the WebP source pick from it alone, so sizes without a WebP copy
+		// are offered there in the original format
+		var webpSrcset []string
+		if len(webpCandidates) > 0 {
+			for i, name := range names {
+				if candidate, ok := webpCandidates[name]; ok && name != "" {
+					webpSrcset = append(webpSrcset, candidate)
+				} else {
+					webpSrcset = append(webpSrcset, srcset[i])
+				}
+			}
+		}
+
+		img := strings.Replace(tag, ` src="`+src+`"`, ` src="`+html.EscapeString(prefix+largest.ServerPath)+`"`, 1)
+		attributes := ` srcset="` + strings.Join(srcset, ", ") + `" sizes="` + responsiveImageSizes + `"`
+		if !strings.Contains(img, " width=") && !strings.Contains(img, " height=") {
+			// Reserves the space of the image before it loads
+			attributes += ` width="` + strconv.Itoa(largest.Width) + `" height="` + strconv.Itoa(largest.Height) + `"`
+		}
+		if strings.HasSuffix(img, "/>") {
+			img = strings.TrimSuffix(img, "/>") + attributes + "/>"
+		} else {
+			img = strings.TrimSuffix(img, ">") + attributes + ">"
+		}
+
+		if len(webpSrcset) == 0 {
+			return img
+		}
+		return `<picture><source type="image/webp" srcset="` + strings.Join(webpSrcset, ", ") + `" sizes="` + responsiveImageSizes + `">` + img + `</picture>`
+	})
+}
+
+// uploadServerPath returns the server path of an uploaded file from its URL in post HTML
+func uploadServerPath(src string) (string, bool) {
+	parsed, err := url.Parse(html.UnescapeString(src))
+	if err != nil || !strings.HasPrefix(parsed.Path, "/uploads/") {
+		return "", false
+	}
+	return strings.TrimPrefix(parsed.Path, "/uploads/"), true
 }
 
 // addLazyLoadingToImages adds loading="lazy" attribute to all img tags in HTML
@@ -604,7 +1241,10 @@ func addLazyLoadingToImages(html string) string {
 		if strings.Contains(match, "loading=") {
 			return match
 		}
-		// Add loading="lazy" before the closing >
+		// Add loading="lazy" before the closing > or />
+		if strings.HasSuffix(match, "/>") {
+			return strings.TrimSuffix(match, "/>") + ` loading="lazy"/>`
+		}
 		return strings.TrimSuffix(match, ">") + ` loading="lazy">`
 	})
 }
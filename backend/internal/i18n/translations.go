@@ -10,6 +10,7 @@ type Translations struct {
 	YourEmail                   string
 	LeaveComment                string
 	CommentHelp                 string
+	MarkdownHelp                string
 	PostComment                 string
 	Home                        string
 	Tags                        string
@@ -23,6 +24,31 @@ type Translations struct {
 	BrowseAllTags               string
 	PageNotFound                string
 	BackToHome                  string
+	Search                      string
+	SearchPlaceholder           string
+	SearchResultsFor            string
+	NoSearchResults             string
+	Reply                       string
+	ReplyingTo                  string
+	CancelReply                 string
+	Author                      string
+	TableOfContents             string
+	CommentSubmitted            string
+	CommentInvalid              string
+	CommentRejected             string
+	CommentError                string
+	CommentVerifying            string
+	NotifyReplies               string
+	ModerateApprovePrompt       string
+	ModerateHidePrompt          string
+	ModerateApprove             string
+	ModerateHide                string
+	ModerateDone                string
+	UnsubscribePrompt           string
+	Unsubscribe                 string
+	Unsubscribed                string
+	LinkInvalid                 string
+	CommentsClosed              string
 }
 
 // Languages contains all supported languages
@@ -36,6 +62,7 @@ var Languages = map[string]Translations{
 		YourEmail:                   "Your email (optional)",
 		LeaveComment:                "Leave a comment...",
 		CommentHelp:                 "Comment may need to be reviewed before it appears on the website.",
+		MarkdownHelp:                "You can use Markdown: *emphasis*, **bold**, `code`, code blocks, links and lists.",
 		PostComment:                 "Post Comment",
 		Home:                        "Home",
 		Tags:                        "Tags",
@@ -49,6 +76,31 @@ var Languages = map[string]Translations{
 		BrowseAllTags:               "Browse all tags",
 		PageNotFound:                "Page Not Found",
 		BackToHome:                  "Back to Home",
+		Search:                      "Search",
+		SearchPlaceholder:           "Search posts...",
+		SearchResultsFor:            "Search results for",
+		NoSearchResults:             "No posts matched your search.",
+		Reply:                       "Reply",
+		ReplyingTo:                  "Replying to",
+		CancelReply:                 "Cancel",
+		Author:                      "Author",
+		TableOfContents:             "Contents",
+		CommentSubmitted:            "Thanks! Your comment was received and may need to be reviewed before it appears.",
+		CommentInvalid:              "Your comment could not be posted. Please check your name, email and comment.",
+		CommentRejected:             "Your comment was blocked by the spam filter. Please wait a moment and try again.",
+		CommentError:                "Something went wrong while posting your comment. Please try again later.",
+		CommentVerifying:            "Verifying...",
+		NotifyReplies:               "Email me when someone replies",
+		ModerateApprovePrompt:       "Approve this comment?",
+		ModerateHidePrompt:          "Hide this comment?",
+		ModerateApprove:             "Approve",
+		ModerateHide:                "Hide",
+		ModerateDone:                "The comment has been updated.",
+		UnsubscribePrompt:           "Stop receiving emails about replies to your comments?",
+		Unsubscribe:                 "Unsubscribe",
+		Unsubscribed:                "You will no longer receive emails about replies.",
+		LinkInvalid:                 "This link is invalid or has expired.",
+		CommentsClosed:              "Comments are closed.",
 	},
 	"zh-CN": {
 		NoPostsFound:                "未找到文章。",
@@ -59,6 +111,7 @@ var Languages = map[string]Translations{
 		YourEmail:                   "您的邮箱（可选）",
 		LeaveComment:                "留下评论...",
 		CommentHelp:                 "评论可能需要审核后才会显示在网站上。",
+		MarkdownHelp:                "支持 Markdown：*斜体*、**粗体**、`代码`、代码块、链接和列表。",
 		PostComment:                 "发表评论",
 		Home:                        "首页",
 		Tags:                        "标签",
@@ -72,6 +125,31 @@ var Languages = map[string]Translations{
 		BrowseAllTags:               "浏览所有标签",
 		PageNotFound:                "页面未找到",
 		BackToHome:                  "返回首页",
+		Search:                      "搜索",
+		SearchPlaceholder:           "搜索文章...",
+		SearchResultsFor:            "搜索结果：",
+		NoSearchResults:             "没有找到匹配的文章。",
+		Reply:                       "回复",
+		ReplyingTo:                  "回复给",
+		CancelReply:                 "取消",
+		Author:                      "作者",
+		TableOfContents:             "目录",
+		CommentSubmitted:            "感谢！评论已收到，可能需要审核后才会显示。",
+		CommentInvalid:              "评论发表失败，请检查您的名字、邮箱和评论内容。",
+		CommentRejected:             "评论被垃圾评论过滤器拦截，请稍后再试。",
+		CommentError:                "发表评论时出错，请稍后再试。",
+		CommentVerifying:            "验证中...",
+		NotifyReplies:               "有人回复时邮件通知我",
+		ModerateApprovePrompt:       "通过这条评论？",
+		ModerateHidePrompt:          "隐藏这条评论？",
+		ModerateApprove:             "通过",
+		ModerateHide:                "隐藏",
+		ModerateDone:                "评论已更新。",
+		UnsubscribePrompt:           "不再接收评论回复的邮件通知？",
+		Unsubscribe:                 "退订",
+		Unsubscribed:                "您将不再收到评论回复的邮件通知。",
+		LinkInvalid:                 "此链接无效或已过期。",
+		CommentsClosed:              "评论已关闭。",
 	},
 }
 
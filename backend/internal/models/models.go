@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+	"strconv"
 	"time"
 
 	"gorm.io/gorm"
@@ -8,17 +10,31 @@ import (
 
 // Post represents a blog post
 type Post struct {
-	ID        uint           `json:"id" gorm:"primarykey"`
-	Title     string         `json:"title" gorm:"not null" validate:"required,min=1,max=200"`
-	Content   string         `json:"content" gorm:"not null" validate:"required,min=1"`
-	Summary   string         `json:"summary" gorm:"size:500"`
-	Slug      string         `json:"slug" gorm:"uniqueIndex;not null"`
-	Published bool           `json:"published" gorm:"default:false"`
-	ViewCount uint           `json:"view_count" gorm:"default:0"`
-	Tags      []Tag          `json:"tags" gorm:"many2many:post_tags;"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID          uint           `json:"id" gorm:"primarykey"`
+	Title       string         `json:"title" gorm:"not null" validate:"required,min=1,max=200"`
+	Content     string         `json:"content" gorm:"not null" validate:"required,min=1"`
+	Summary     string         `json:"summary" gorm:"size:500"`
+	Slug        string         `json:"slug" gorm:"uniqueIndex;not null"`
+	Published   bool           `json:"published" gorm:"default:false"`
+	PublishAt   *time.Time     `json:"publish_at,omitempty" gorm:"index"`                   // Scheduled publish time, nil when not scheduled
+	PublishedAt *time.Time     `json:"published_at,omitempty"`                              // When the post last went from draft to published
+	CoverFileID *uint          `json:"cover_file_id,omitempty"`                             // Uploaded image used when the post is shared
+	CommentMode string         `json:"comment_mode" gorm:"size:20;not null;default:'open'"` // open, moderated, closed or hidden
+	ViewCount   uint           `json:"view_count" gorm:"default:0"`
+	Tags        []Tag          `json:"tags" gorm:"many2many:post_tags;"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// PostRevision represents a snapshot of a post taken before it was updated
+type PostRevision struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	PostID    uint      `json:"post_id" gorm:"not null;index"`
+	Title     string    `json:"title" gorm:"not null"`
+	Content   string    `json:"content" gorm:"not null"`
+	Summary   string    `json:"summary" gorm:"size:500"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // Tag represents a tag that can be associated with posts
@@ -56,70 +72,235 @@ type Config struct {
 
 // Comment represents a comment on a blog post
 type Comment struct {
-	ID        uint           `json:"id" gorm:"primarykey"`
-	PostID    uint           `json:"post_id" gorm:"not null"`
-	Post      Post           `json:"post,omitempty" gorm:"foreignKey:PostID"`
-	Name      string         `json:"name" gorm:"not null" validate:"required,min=1,max=100"`
-	Email     string         `json:"email" gorm:"size:255" validate:"omitempty,email,max=255"`
-	Content   string         `json:"content" gorm:"not null" validate:"required,min=1,max=2000"`
-	Status    string         `json:"status" gorm:"not null;default:'pending'" validate:"required,oneof=pending approved hidden"`
-	IPAddress string         `json:"ip_address" gorm:"size:45"`     // IPv4/IPv6 address
-	Referer   string         `json:"referer" gorm:"size:500"`       // HTTP Referer header
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID            uint           `json:"id" gorm:"primarykey"`
+	PostID        uint           `json:"post_id" gorm:"not null"`
+	Post          Post           `json:"post,omitempty" gorm:"foreignKey:PostID"`
+	ParentID      *uint          `json:"parent_id,omitempty" gorm:"index"` // Comment being replied to, nil for top-level comments
+	IsAuthor      bool           `json:"is_author" gorm:"default:false"`   // Reply posted by the blog author from the admin panel
+	Name          string         `json:"name" gorm:"not null" validate:"required,min=1,max=100"`
+	Email         string         `json:"email" gorm:"size:255" validate:"omitempty,email,max=255"`
+	Content       string         `json:"content" gorm:"not null" validate:"required,min=1,max=2000"`
+	Status        string         `json:"status" gorm:"not null;default:'pending'" validate:"required,oneof=pending approved hidden"`
+	IPAddress     string         `json:"ip_address" gorm:"size:45"`           // IPv4/IPv6 address
+	Referer       string         `json:"referer" gorm:"size:500"`             // HTTP Referer header
+	SpamScore     *float64       `json:"spam_score,omitempty"`                // Spam probability from the classifier, nil when not scored
+	NotifyReplies bool           `json:"notify_replies" gorm:"default:false"` // Commenter asked to be emailed about replies
+	ReplyNotified bool           `json:"-" gorm:"default:false"`              // Parent's author has been emailed about this reply
+	ImportID      string         `json:"-" gorm:"size:100;index"`             // Source and ID of an imported comment, e.g. disqus:123
+	ContentHTML   string         `json:"-" gorm:"type:text"`                  // Rendered Markdown of Content, written together with it
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// CommentRejection records a comment submission blocked by the comment guards
+type CommentRejection struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	PostID    uint      `json:"post_id" gorm:"index"`
+	Reason    string    `json:"reason" gorm:"size:50;not null;index"` // Guard reason code, e.g. honeypot or rate_limit_ip
+	Detail    string    `json:"detail" gorm:"size:255"`
+	Name      string    `json:"name" gorm:"size:100"`
+	Email     string    `json:"email" gorm:"size:255"`
+	Content   string    `json:"content" gorm:"size:2000"`
+	IPAddress string    `json:"ip_address" gorm:"size:45;index"`
+	Referer   string    `json:"referer" gorm:"size:500"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
 }
 
-// File represents an uploaded file associated with a post
+// CommentRule is an admin-managed blocklist or allowlist entry applied to new comments
+type CommentRule struct {
+	ID          uint       `json:"id" gorm:"primarykey"`
+	Field       string     `json:"field" gorm:"size:20;not null"`      // ip, email, name, content or referer
+	MatchType   string     `json:"match_type" gorm:"size:20;not null"` // exact, cidr, substring, regex or trusted
+	Pattern     string     `json:"pattern" gorm:"size:500"`
+	Action      string     `json:"action" gorm:"size:20;not null"` // hide, approve or reject
+	Description string     `json:"description" gorm:"size:255"`
+	Enabled     bool       `json:"enabled" gorm:"not null"`
+	HitCount    int64      `json:"hit_count" gorm:"not null;default:0"`
+	LastHitAt   *time.Time `json:"last_hit_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// SpamToken holds how many spam and ham comments a token appeared in
+type SpamToken struct {
+	ID        uint   `json:"id" gorm:"primarykey"`
+	Token     string `json:"token" gorm:"size:100;uniqueIndex;not null"`
+	SpamCount int64  `json:"spam_count" gorm:"not null;default:0"`
+	HamCount  int64  `json:"ham_count" gorm:"not null;default:0"`
+}
+
+// SpamTrainingLabel records how a comment was used to train the spam classifier,
+// so a changed moderation decision can be unlearned
+type SpamTrainingLabel struct {
+	CommentID uint      `json:"comment_id" gorm:"primarykey;autoIncrement:false"`
+	Label     string    `json:"label" gorm:"size:10;not null;index"` // spam or ham
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// File represents an uploaded file, optionally uploaded for a post
 type File struct {
 	ID               uint           `json:"id" gorm:"primarykey"`
-	PostID           uint           `json:"post_id" gorm:"not null;index"`
+	PostID           *uint          `json:"post_id,omitempty" gorm:"index"` // Post the file was uploaded for, nil for library uploads
 	Post             Post           `json:"post,omitempty" gorm:"foreignKey:PostID"`
+	UsedIn           []Post         `json:"-" gorm:"many2many:post_files"` // Posts linking to the file or using it as their cover
 	OriginalFileName string         `json:"original_file_name" gorm:"not null"`
 	DisplayName      string         `json:"display_name" gorm:"not null"`
 	Description      string         `json:"description" gorm:"size:500"`
-	ServerPath       string         `json:"server_path" gorm:"not null;uniqueIndex"`
+	Folder           string         `json:"folder" gorm:"size:255;not null;default:'';index"` // Media library folder such as "logos/dark", empty for the top level
+	ServerPath       string         `json:"server_path" gorm:"not null;index"`                // Path of the blob, shared by files with the same content
 	FileSize         int64          `json:"file_size" gorm:"not null"`
 	MimeType         string         `json:"mime_type" gorm:"size:100"`
+	SHA256           string         `json:"sha256" gorm:"column:sha256;size:64;index"` // Hash of the uploaded content, the key of its blob
+	Width            int            `json:"width"`                                     // Images only, after EXIF orientation is applied
+	Height           int            `json:"height"`                                    // Images only, after EXIF orientation is applied
+	Variants         []FileVariant  `json:"variants,omitempty" gorm:"foreignKey:BlobHash;references:SHA256"`
 	CreatedAt        time.Time      `json:"created_at"`
 	UpdatedAt        time.Time      `json:"updated_at"`
 	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// PostFile records that a post uses an uploaded file, found by scanning the post when it is saved
+type PostFile struct {
+	PostID uint `gorm:"primaryKey"`
+	FileID uint `gorm:"primaryKey;index"`
+}
+
+// Blob is the stored content of uploaded files. Files with the same content share one blob,
+// which is deleted from disk with the last file referencing it.
+type Blob struct {
+	Hash       string    `json:"hash" gorm:"primarykey;size:64"` // SHA-256 of the uploaded content, hex encoded
+	ServerPath string    `json:"server_path" gorm:"not null;uniqueIndex"`
+	FileSize   int64     `json:"file_size" gorm:"not null"`
+	MimeType   string    `json:"mime_type" gorm:"size:100"`
+	RefCount   int       `json:"ref_count" gorm:"not null;default:0"` // Files referencing the blob
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// FileVariant is a resized copy of an uploaded image, stored next to its blob
+type FileVariant struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	BlobHash   string    `json:"blob_hash" gorm:"size:64;not null;index"`
+	Name       string    `json:"name" gorm:"size:20;not null"`   // thumbnail, medium or large
+	Format     string    `json:"format" gorm:"size:10;not null"` // jpeg, png or webp
+	ServerPath string    `json:"server_path" gorm:"not null;uniqueIndex"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	FileSize   int64     `json:"file_size"`
+	MimeType   string    `json:"mime_type" gorm:"size:100"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// MailOutbox is an email waiting to be sent, or the record of one that was.
+// Failed deliveries are retried with backoff by the outbox worker.
+type MailOutbox struct {
+	ID            uint       `json:"id" gorm:"primarykey"`
+	To            string     `json:"to" gorm:"size:255;not null"`
+	Subject       string     `json:"subject" gorm:"size:255;not null"`
+	Body          string     `json:"body" gorm:"not null"`
+	Status        string     `json:"status" gorm:"size:20;not null;default:'pending';index"` // pending, sent or failed
+	Attempts      int        `json:"attempts" gorm:"not null;default:0"`
+	LastError     string     `json:"last_error" gorm:"size:500"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"index"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
 // PostResponse represents the public response format for a post
 type PostResponse struct {
-	ID        uint      `json:"id"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	Summary   string    `json:"summary"`
-	Slug      string    `json:"slug"`
-	Published bool      `json:"published"`
-	ViewCount uint      `json:"view_count"`
-	Tags      []Tag     `json:"tags"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          uint       `json:"id"`
+	Title       string     `json:"title"`
+	Content     string     `json:"content"`
+	Summary     string     `json:"summary"`
+	Slug        string     `json:"slug"`
+	Published   bool       `json:"published"`
+	Scheduled   bool       `json:"scheduled"`
+	PublishAt   *time.Time `json:"publish_at,omitempty"`
+	CoverFileID *uint      `json:"cover_file_id,omitempty"`
+	CommentMode string     `json:"comment_mode"`
+	ViewCount   uint       `json:"view_count"`
+	Tags        []Tag      `json:"tags"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
 }
 
 // CreatePostRequest represents the request to create a new post
 type CreatePostRequest struct {
-	Title     string     `json:"title" validate:"required,min=1,max=200"`
-	Content   string     `json:"content" validate:"required,min=1"`
-	Summary   string     `json:"summary"`
-	Slug      string     `json:"slug,omitempty"`
-	Published bool       `json:"published"`
-	TagIDs    []uint     `json:"tag_ids,omitempty"`
-	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Title       string     `json:"title" validate:"required,min=1,max=200"`
+	Content     string     `json:"content" validate:"required,min=1"`
+	Summary     string     `json:"summary"`
+	Slug        string     `json:"slug,omitempty"`
+	Published   bool       `json:"published"`
+	PublishAt   *time.Time `json:"publish_at,omitempty"`    // Schedules the post when set to a future time
+	CoverFileID *uint      `json:"cover_file_id,omitempty"` // Image file shown when the post is shared
+	CommentMode string     `json:"comment_mode,omitempty" validate:"omitempty,oneof=open moderated closed hidden"`
+	TagIDs      []uint     `json:"tag_ids,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
 }
 
 // UpdatePostRequest represents the request to update a post
 type UpdatePostRequest struct {
-	Title     *string     `json:"title,omitempty" validate:"omitempty,min=1,max=200"`
-	Content   *string     `json:"content,omitempty" validate:"omitempty,min=1"`
-	Summary   *string     `json:"summary,omitempty"`
-	Slug      *string     `json:"slug,omitempty"`
-	Published *bool       `json:"published,omitempty"`
-	TagIDs    *[]uint     `json:"tag_ids,omitempty"`
-	CreatedAt *time.Time  `json:"created_at,omitempty"`
+	Title       *string      `json:"title,omitempty" validate:"omitempty,min=1,max=200"`
+	Content     *string      `json:"content,omitempty" validate:"omitempty,min=1"`
+	Summary     *string      `json:"summary,omitempty"`
+	Slug        *string      `json:"slug,omitempty"`
+	Published   *bool        `json:"published,omitempty"`
+	PublishAt   NullableTime `json:"publish_at"`              // Schedules the post when set to a future time, null cancels the schedule
+	CoverFileID *uint        `json:"cover_file_id,omitempty"` // Image file shown when the post is shared, 0 removes it
+	CommentMode *string      `json:"comment_mode,omitempty" validate:"omitempty,oneof=open moderated closed hidden"`
+	TagIDs      *[]uint      `json:"tag_ids,omitempty"`
+	CreatedAt   *time.Time   `json:"created_at,omitempty"`
+}
+
+// NullableTime is a time in a request that tells an explicit null apart from a missing field
+type NullableTime struct {
+	Set   bool
+	Value *time.Time
+}
+
+func (t *NullableTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+	if string(data) == "null" {
+		t.Value = nil
+		return nil
+	}
+
+	var value time.Time
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	t.Value = &value
+	return nil
+}
+
+// PostRevisionResponse represents a revision in the revision list (without content)
+type PostRevisionResponse struct {
+	ID          uint      `json:"id"`
+	PostID      uint      `json:"post_id"`
+	Title       string    `json:"title"`
+	Summary     string    `json:"summary"`
+	ContentSize int       `json:"content_size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// DiffLine represents a single line in a line-based diff
+type DiffLine struct {
+	Type    string `json:"type"` // equal, insert or delete
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+	Text    string `json:"text"`
+}
+
+// RevisionDiffResponse represents the diff between two versions of a post
+type RevisionDiffResponse struct {
+	From    string     `json:"from"` // Revision ID or "current"
+	To      string     `json:"to"`   // Revision ID or "current"
+	Title   []DiffLine `json:"title"`
+	Summary []DiffLine `json:"summary"`
+	Content []DiffLine `json:"content"`
 }
 
 // LoginRequest represents the login request
@@ -177,38 +358,58 @@ type TagWithPostCount struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// CreateCommentRequest represents the request to create a new comment
+// CreateCommentRequest represents a reader's comment on a post, from the public API or the HTML form.
+// The anti-spam fields come from CommentFormResponse and must be sent back unchanged.
 type CreateCommentRequest struct {
-	PostID  uint   `json:"post_id" validate:"required"`
-	Name    string `json:"name" validate:"required,min=1,max=100"`
-	Email   string `json:"email" validate:"omitempty,email,max=255"`
-	Content string `json:"content" validate:"required,min=1,max=2000"`
+	ParentID      *uint  `json:"parent_id,omitempty"`
+	Name          string `json:"name" validate:"required,min=1,max=100"`
+	Email         string `json:"email" validate:"omitempty,email,max=255"`
+	Content       string `json:"content" validate:"required,min=1,max=2000"`
+	NotifyReplies bool   `json:"notify_replies"`
+	FormToken     string `json:"form_token"`
+	PowNonce      string `json:"pow_nonce"`
+	Website       string `json:"website"` // Honeypot, real readers leave it empty
+}
+
+// CommentFormResponse holds what a client needs before it can submit a comment
+type CommentFormResponse struct {
+	Token         string `json:"token"`          // Signed form token, also the proof-of-work challenge
+	PowDifficulty int    `json:"pow_difficulty"` // Leading zero bits of sha256(token + ":" + nonce), 0 when disabled
+	NotifyReplies bool   `json:"notify_replies"` // Whether reply notifications can be requested
 }
 
 // CommentResponse represents the public response format for a comment
 type CommentResponse struct {
-	ID        uint      `json:"id"`
-	PostID    uint      `json:"post_id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email,omitempty"` // Only show email to admin
-	Content   string    `json:"content"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          uint      `json:"id"`
+	PostID      uint      `json:"post_id"`
+	ParentID    *uint     `json:"parent_id,omitempty"`
+	IsAuthor    bool      `json:"is_author"`
+	Name        string    `json:"name"`
+	Email       string    `json:"email,omitempty"` // Only show email to admin
+	AvatarURL   string    `json:"avatar_url"`      // Served by this site, see Comment.AvatarURL
+	Content     string    `json:"content"`
+	ContentHTML string    `json:"content_html"` // Content rendered from Markdown
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 // CommentAdminResponse represents the admin response format for a comment
 type CommentAdminResponse struct {
-	ID        uint      `json:"id"`
-	PostID    uint      `json:"post_id"`
-	PostTitle string    `json:"post_title,omitempty"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Content   string    `json:"content"`
-	Status    string    `json:"status"`
-	IPAddress string    `json:"ip_address"`
-	Referer   string    `json:"referer"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          uint      `json:"id"`
+	PostID      uint      `json:"post_id"`
+	PostTitle   string    `json:"post_title,omitempty"`
+	ParentID    *uint     `json:"parent_id,omitempty"`
+	IsAuthor    bool      `json:"is_author"`
+	Name        string    `json:"name"`
+	Email       string    `json:"email"`
+	Content     string    `json:"content"`
+	ContentHTML string    `json:"content_html"` // Rendered Markdown, as shown on the post
+	Status      string    `json:"status"`
+	IPAddress   string    `json:"ip_address"`
+	Referer     string    `json:"referer"`
+	SpamScore   *float64  `json:"spam_score,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 // UpdateCommentStatusRequest represents the request to update comment status
@@ -216,31 +417,149 @@ type UpdateCommentStatusRequest struct {
 	Status string `json:"status" validate:"required,oneof=pending approved hidden"`
 }
 
+// CreateCommentRuleRequest represents the request to create a comment moderation rule
+type CreateCommentRuleRequest struct {
+	Field       string `json:"field" validate:"required,oneof=ip email name content referer"`
+	MatchType   string `json:"match_type" validate:"required,oneof=exact cidr substring regex trusted"`
+	Pattern     string `json:"pattern" validate:"max=500"`
+	Action      string `json:"action" validate:"required,oneof=hide approve reject"`
+	Description string `json:"description" validate:"max=255"`
+	Enabled     *bool  `json:"enabled,omitempty"` // Defaults to true
+}
+
+// UpdateCommentRuleRequest represents the request to update a comment moderation rule
+type UpdateCommentRuleRequest struct {
+	Field       *string `json:"field,omitempty" validate:"omitempty,oneof=ip email name content referer"`
+	MatchType   *string `json:"match_type,omitempty" validate:"omitempty,oneof=exact cidr substring regex trusted"`
+	Pattern     *string `json:"pattern,omitempty" validate:"omitempty,max=500"`
+	Action      *string `json:"action,omitempty" validate:"omitempty,oneof=hide approve reject"`
+	Description *string `json:"description,omitempty" validate:"omitempty,max=255"`
+	Enabled     *bool   `json:"enabled,omitempty"`
+	ResetHits   bool    `json:"reset_hits,omitempty"` // Clears the hit counter
+}
+
+// SpamClassifierStats represents the training state of the spam classifier
+type SpamClassifierStats struct {
+	SpamComments     int64 `json:"spam_comments"`
+	HamComments      int64 `json:"ham_comments"`
+	Tokens           int64 `json:"tokens"`
+	MinTraining      int   `json:"min_training"` // Comments of each kind needed before scoring starts
+	Ready            bool  `json:"ready"`
+	HideThreshold    int   `json:"hide_threshold"`    // Percent, 0 when disabled
+	ApproveThreshold int   `json:"approve_threshold"` // Percent, 0 when disabled
+}
+
+// BulkCommentRequest represents a moderation action applied to many comments at once.
+// Comments are picked by ID, or by the filter when no IDs are given.
+type BulkCommentRequest struct {
+	Action string         `json:"action" validate:"required,oneof=approve hide delete"`
+	IDs    []uint         `json:"ids,omitempty" validate:"omitempty,max=1000"`
+	Filter *CommentFilter `json:"filter,omitempty"`
+	DryRun bool           `json:"dry_run"` // Report what would change without changing anything
+}
+
+// CommentFilter selects comments for bulk moderation. At least one criterion is required.
+type CommentFilter struct {
+	Status    string     `json:"status,omitempty" validate:"omitempty,oneof=pending approved hidden"`
+	PostID    uint       `json:"post_id,omitempty"`
+	IPAddress string     `json:"ip_address,omitempty" validate:"omitempty,max=45"`
+	From      *time.Time `json:"from,omitempty"`                              // Created at or after
+	To        *time.Time `json:"to,omitempty"`                                // Created before
+	Text      string     `json:"text,omitempty" validate:"omitempty,max=500"` // Case-insensitive match on name, email or content
+}
+
+// BulkCommentResult is the outcome of a bulk action for one comment
+type BulkCommentResult struct {
+	ID     uint   `json:"id"`
+	Result string `json:"result"` // updated, deleted, unchanged or not_found
+}
+
+// BulkCommentResponse reports what a bulk action did, or would do in a dry run
+type BulkCommentResponse struct {
+	Action   string              `json:"action"`
+	DryRun   bool                `json:"dry_run"`
+	Matched  int                 `json:"matched"`
+	Affected int                 `json:"affected"`
+	Results  []BulkCommentResult `json:"results"`
+}
+
+// CreateCommentReplyRequest represents the request for an admin reply to a comment
+type CreateCommentReplyRequest struct {
+	Content string `json:"content" validate:"required,min=1,max=2000"`
+}
+
+// CommentImportReport summarizes a Disqus or WordPress comment import
+type CommentImportReport struct {
+	Format     string            `json:"format"`
+	DryRun     bool              `json:"dry_run"`
+	Threads    int               `json:"threads"`    // Threads or posts with comments in the file
+	Imported   int               `json:"imported"`   // Comments created, or that would be created in a dry run
+	Duplicates int               `json:"duplicates"` // Comments skipped because an earlier import created them
+	Skipped    int               `json:"skipped"`    // Deleted, trashed or empty comments and pingbacks
+	Unmatched  []UnmatchedThread `json:"unmatched"`  // Threads that match no post
+}
+
+// UploadDedupeReport summarizes the hashing and deduplication of existing uploads
+type UploadDedupeReport struct {
+	Hashed     int   `json:"hashed"`      // Files hashed for the first time
+	Missing    int   `json:"missing"`     // Files whose content is missing from disk
+	Duplicates int   `json:"duplicates"`  // Files now sharing the blob of an earlier file
+	BytesFreed int64 `json:"bytes_freed"` // Disk space of the removed copies
+	Processed  int   `json:"processed"`   // Images that got resized copies
+}
+
+// UnmatchedThread is a thread from an import file whose post could not be found
+type UnmatchedThread struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Link     string `json:"link"`
+	Comments int    `json:"comments"`
+}
+
+// TestMailRequest represents the request to send a test email
+type TestMailRequest struct {
+	To string `json:"to" validate:"required,email"`
+}
+
 // ToResponse converts a Comment to CommentResponse (public view)
 func (c *Comment) ToResponse() CommentResponse {
 	return CommentResponse{
-		ID:        c.ID,
-		PostID:    c.PostID,
-		Name:      c.Name,
-		Content:   c.Content,
-		Status:    c.Status,
-		CreatedAt: c.CreatedAt,
+		ID:          c.ID,
+		PostID:      c.PostID,
+		ParentID:    c.ParentID,
+		IsAuthor:    c.IsAuthor,
+		Name:        c.Name,
+		AvatarURL:   c.AvatarURL(),
+		Content:     c.Content,
+		ContentHTML: c.ContentHTML,
+		Status:      c.Status,
+		CreatedAt:   c.CreatedAt,
 	}
 }
 
+// AvatarURL returns the path of the commenter's avatar on this site. It names the comment
+// rather than a hash of the email, which would give the commenter's Gravatar away.
+func (c *Comment) AvatarURL() string {
+	return "/avatars/" + strconv.FormatUint(uint64(c.ID), 10)
+}
+
 // ToAdminResponse converts a Comment to CommentAdminResponse (admin view)
 func (c *Comment) ToAdminResponse() CommentAdminResponse {
 	response := CommentAdminResponse{
-		ID:        c.ID,
-		PostID:    c.PostID,
-		Name:      c.Name,
-		Email:     c.Email,
-		Content:   c.Content,
-		Status:    c.Status,
-		IPAddress: c.IPAddress,
-		Referer:   c.Referer,
-		CreatedAt: c.CreatedAt,
-		UpdatedAt: c.UpdatedAt,
+		ID:          c.ID,
+		PostID:      c.PostID,
+		ParentID:    c.ParentID,
+		IsAuthor:    c.IsAuthor,
+		Name:        c.Name,
+		Email:       c.Email,
+		Content:     c.Content,
+		ContentHTML: c.ContentHTML,
+		Status:      c.Status,
+		IPAddress:   c.IPAddress,
+		Referer:     c.Referer,
+		SpamScore:   c.SpamScore,
+		CreatedAt:   c.CreatedAt,
+		UpdatedAt:   c.UpdatedAt,
 	}
 	
 	// Include post title if available
@@ -254,38 +573,100 @@ func (c *Comment) ToAdminResponse() CommentAdminResponse {
 // ToResponse converts a Post to PostResponse
 func (p *Post) ToResponse() PostResponse {
 	return PostResponse{
-		ID:        p.ID,
-		Title:     p.Title,
-		Content:   p.Content,
-		Summary:   p.Summary,
-		Slug:      p.Slug,
-		Published: p.Published,
-		ViewCount: p.ViewCount,
-		Tags:      p.Tags,
-		CreatedAt: p.CreatedAt,
-		UpdatedAt: p.UpdatedAt,
+		ID:          p.ID,
+		Title:       p.Title,
+		Content:     p.Content,
+		Summary:     p.Summary,
+		Slug:        p.Slug,
+		Published:   p.Published,
+		Scheduled:   p.IsScheduled(),
+		PublishAt:   p.PublishAt,
+		CoverFileID: p.CoverFileID,
+		CommentMode: p.CommentMode,
+		ViewCount:   p.ViewCount,
+		Tags:        p.Tags,
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+	}
+}
+
+// PublishedTime returns when the post went live. Posts published before this was recorded
+// fall back to their publish time or date.
+func (p *Post) PublishedTime() time.Time {
+	if p.PublishedAt != nil {
+		return *p.PublishedAt
+	}
+	if p.PublishAt != nil {
+		return *p.PublishAt
+	}
+	return p.CreatedAt
+}
+
+// IsScheduled reports whether the post is waiting for its scheduled publish time
+func (p *Post) IsScheduled() bool {
+	return !p.Published && p.PublishAt != nil
+}
+
+// ToResponse converts a PostRevision to PostRevisionResponse
+func (r *PostRevision) ToResponse() PostRevisionResponse {
+	return PostRevisionResponse{
+		ID:          r.ID,
+		PostID:      r.PostID,
+		Title:       r.Title,
+		Summary:     r.Summary,
+		ContentSize: len(r.Content),
+		CreatedAt:   r.CreatedAt,
 	}
 }
 
 // FileResponse represents the response format for a file
 type FileResponse struct {
-	ID               uint      `json:"id"`
-	PostID           uint      `json:"post_id"`
-	PostTitle        string    `json:"post_title,omitempty"`
-	OriginalFileName string    `json:"original_file_name"`
-	DisplayName      string    `json:"display_name"`
-	Description      string    `json:"description"`
-	ServerPath       string    `json:"server_path"`
-	FileSize         int64     `json:"file_size"`
-	MimeType         string    `json:"mime_type"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
+	ID               uint          `json:"id"`
+	PostID           *uint         `json:"post_id,omitempty"`
+	PostTitle        string        `json:"post_title,omitempty"`
+	OriginalFileName string        `json:"original_file_name"`
+	DisplayName      string        `json:"display_name"`
+	Description      string        `json:"description"`
+	Folder           string        `json:"folder"`
+	ServerPath       string        `json:"server_path"`
+	FileSize         int64         `json:"file_size"`
+	MimeType         string        `json:"mime_type"`
+	SHA256           string        `json:"sha256,omitempty"`
+	Width            int           `json:"width,omitempty"`
+	Height           int           `json:"height,omitempty"`
+	Variants         []FileVariant `json:"variants,omitempty"`
+	UsedIn           []FileUsage   `json:"used_in"`
+	CreatedAt        time.Time     `json:"created_at"`
+	UpdatedAt        time.Time     `json:"updated_at"`
+}
+
+// FileUsage is a post using a file
+type FileUsage struct {
+	PostID uint   `json:"post_id"`
+	Title  string `json:"title"`
+	Slug   string `json:"slug"`
+}
+
+// FileFilter selects files in the media library. Empty criteria match every file.
+type FileFilter struct {
+	Type   string  // A MIME type such as image/png, or a major type such as image
+	Folder *string // Files directly in a folder, "" for the top level
+	Usage  string  // used or unused
+	PostID uint    // Files used in a post
+	Query  string  // Case-insensitive match on the display name
+}
+
+// FolderSummary is a media library folder with the number of files directly in it
+type FolderSummary struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
 }
 
 // UpdateFileRequest represents the request to update file metadata
 type UpdateFileRequest struct {
 	DisplayName *string `json:"display_name,omitempty" validate:"omitempty,min=1,max=255"`
 	Description *string `json:"description,omitempty" validate:"omitempty,max=500"`
+	Folder      *string `json:"folder,omitempty" validate:"omitempty,max=255"`
 }
 
 // ToResponse converts a File to FileResponse
@@ -296,9 +677,15 @@ func (f *File) ToResponse() FileResponse {
 		OriginalFileName: f.OriginalFileName,
 		DisplayName:      f.DisplayName,
 		Description:      f.Description,
+		Folder:           f.Folder,
 		ServerPath:       f.ServerPath,
 		FileSize:         f.FileSize,
 		MimeType:         f.MimeType,
+		SHA256:           f.SHA256,
+		Width:            f.Width,
+		Height:           f.Height,
+		Variants:         f.Variants,
+		UsedIn:           make([]FileUsage, 0, len(f.UsedIn)),
 		CreatedAt:        f.CreatedAt,
 		UpdatedAt:        f.UpdatedAt,
 	}
@@ -308,6 +695,10 @@ func (f *File) ToResponse() FileResponse {
 		response.PostTitle = f.Post.Title
 	}
 	
+	for _, post := range f.UsedIn {
+		response.UsedIn = append(response.UsedIn, FileUsage{PostID: post.ID, Title: post.Title, Slug: post.Slug})
+	}
+	
 	return response
 }
 
@@ -0,0 +1,559 @@
+package services
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Avatar sources and styles
+const (
+	AvatarSourceLocal    = "local"    // Avatars are generated on this server
+	AvatarSourceGravatar = "gravatar" // Gravatar images are fetched and cached, generated avatars are the fallback
+
+	AvatarStyleIdenticon = "identicon" // Symmetric 5x5 pattern
+	AvatarStyleInitials  = "initials"  // Initials of the commenter's name on a colored background
+)
+
+// DefaultAvatarSize is the avatar size in pixels when none is asked for
+const DefaultAvatarSize = 80
+
+// avatarSizes are the sizes avatars come in, so a handful of images is made and cached per commenter
+var avatarSizes = []int{40, 80, 160, 320}
+
+// maxCachedGravatars caps the number of files in the Gravatar cache, the oldest are removed first
+const maxCachedGravatars = 2000
+
+// gravatarCacheTTL is how long a fetched Gravatar image, or the lack of one, is kept before asking again
+const gravatarCacheTTL = 7 * 24 * time.Hour
+
+// gravatarRetryDelay is how long Gravatar is left alone after a failed request, so pages don't wait on it
+const gravatarRetryDelay = 5 * time.Minute
+
+// ErrAvatarNotFound is returned for avatars of comments that don't exist or aren't shown
+var ErrAvatarNotFound = errors.New("avatar not found")
+
+// Avatar is a rendered or fetched avatar image
+type Avatar struct {
+	Data        []byte
+	ContentType string
+	ETag        string
+	ModTime     time.Time // Zero for generated avatars
+}
+
+// AvatarService serves commenter avatars without sending readers to a third party.
+// Avatars are looked up by comment, so pages never show the Gravatar hash of an email.
+type AvatarService struct {
+	db            *gorm.DB
+	configService *ConfigService
+	client        *http.Client
+
+	mu          sync.Mutex
+	failedUntil time.Time // Gravatar is not asked before this time
+}
+
+func NewAvatarService(db *gorm.DB, configService *ConfigService) *AvatarService {
+	return &AvatarService{
+		db:            db,
+		configService: configService,
+		client:        &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// GetCacheDir returns the directory fetched Gravatar images are kept in (next to blog.db)
+func (s *AvatarService) GetCacheDir() string {
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "./data/blog.db"
+	}
+	return filepath.Join(filepath.Dir(dbPath), "avatars")
+}
+
+// Avatar returns the avatar of the author of an approved comment, as "png" or "svg".
+// Gravatar is only asked for PNG avatars, as it has no SVGs, and only for commenters who gave an email.
+func (s *AvatarService) Avatar(commentID uint, format string, size int) (*Avatar, error) {
+	if format != "png" && format != "svg" {
+		return nil, fmt.Errorf("invalid avatar format: %s", format)
+	}
+	size = avatarSize(size)
+
+	var comment models.Comment
+	if err := s.db.Select("id", "name", "email").Where("status = ?", "approved").First(&comment, commentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAvatarNotFound
+		}
+		return nil, err
+	}
+	email := strings.ToLower(strings.TrimSpace(comment.Email))
+	name := comment.Name
+
+	source, _ := s.configService.GetConfig("avatar_source")
+	if format == "png" && email != "" && strings.TrimSpace(source) == AvatarSourceGravatar {
+		avatar, err := s.gravatar(fmt.Sprintf("%x", md5.Sum([]byte(email))), size)
+		if err != nil {
+			// Readers still get an avatar while Gravatar is unreachable
+			log.Printf("Warning: failed to fetch Gravatar avatar: %v", err)
+		}
+		if avatar != nil {
+			return avatar, nil
+		}
+	}
+
+	// Generated avatars are drawn from a keyed hash of the commenter, which stays the same
+	// across their comments but can't be matched to an email
+	identity := "email:" + email
+	if email == "" {
+		identity = "name:" + name
+	}
+	signature, err := s.configService.Sign("avatar", identity)
+	if err != nil {
+		return nil, err
+	}
+	hash := signature[:32]
+
+	style, _ := s.configService.GetConfig("avatar_style")
+	if style = strings.TrimSpace(style); style != AvatarStyleInitials {
+		style = AvatarStyleIdenticon
+	}
+	initials := avatarInitials(name)
+	if style == AvatarStyleInitials && initials == "" {
+		style = AvatarStyleIdenticon
+	}
+
+	var data []byte
+	switch {
+	case format == "svg" && style == AvatarStyleInitials:
+		data = initialsSVG(hash, initials, size)
+	case format == "svg":
+		data = identiconSVG(hash, size)
+	case style == AvatarStyleInitials && canDrawInitials(initials):
+		data, err = initialsPNG(hash, initials, size)
+	default:
+		// The built-in PNG font only covers A-Z and 0-9
+		data, err = identiconPNG(hash, size)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to render avatar: %w", err)
+	}
+
+	contentType := "image/png"
+	if format == "svg" {
+		contentType = "image/svg+xml"
+	}
+
+	// Generated avatars only change with the style and name, so those make up the ETag
+	etag := sha256.Sum256([]byte(strings.Join([]string{hash, style, initials, format, fmt.Sprint(size)}, ":")))
+	return &Avatar{
+		Data:        data,
+		ContentType: contentType,
+		ETag:        `"` + hex.EncodeToString(etag[:8]) + `"`,
+	}, nil
+}
+
+// gravatar returns the cached Gravatar image for a hash, fetching it when missing or stale.
+// It returns nil without an error when the hash has no Gravatar.
+func (s *AvatarService) gravatar(hash string, size int) (*Avatar, error) {
+	base := filepath.Join(s.GetCacheDir(), fmt.Sprintf("%s-%d", hash, size))
+
+	// A .none file records that Gravatar has no image, so it isn't asked on every page view
+	if info, err := os.Stat(base + ".none"); err == nil && time.Since(info.ModTime()) < gravatarCacheTTL {
+		return nil, nil
+	}
+
+	cached, cachedErr := readCachedGravatar(base)
+	if cachedErr == nil && time.Since(cached.ModTime) < gravatarCacheTTL {
+		return cached, nil
+	}
+
+	s.mu.Lock()
+	failing := time.Now().Before(s.failedUntil)
+	s.mu.Unlock()
+	if failing {
+		if cachedErr == nil {
+			return cached, nil
+		}
+		return nil, nil
+	}
+
+	avatar, err := s.fetchGravatar(hash, size, base)
+	if err != nil {
+		s.mu.Lock()
+		s.failedUntil = time.Now().Add(gravatarRetryDelay)
+		s.mu.Unlock()
+
+		// A stale image beats none at all
+		if cachedErr == nil {
+			return cached, err
+		}
+		return nil, err
+	}
+	return avatar, nil
+}
+
+// fetchGravatar downloads an image from Gravatar into the cache
+func (s *AvatarService) fetchGravatar(hash string, size int, base string) (*Avatar, error) {
+	resp, err := s.client.Get(fmt.Sprintf("https://www.gravatar.com/avatar/%s?s=%d&d=404", hash, size))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create avatar cache directory: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		os.Remove(base + ".png")
+		os.Remove(base + ".jpg")
+		defer s.pruneGravatarCache()
+		return nil, writeFileAtomic(base+".none", nil)
+	default:
+		return nil, fmt.Errorf("gravatar returned %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	ext := ".png"
+	if http.DetectContentType(data) == "image/jpeg" {
+		ext = ".jpg"
+	} else if http.DetectContentType(data) != "image/png" {
+		return nil, fmt.Errorf("gravatar returned an unexpected %s", http.DetectContentType(data))
+	}
+
+	os.Remove(base + ".none")
+	if err := writeFileAtomic(base+ext, data); err != nil {
+		return nil, fmt.Errorf("failed to cache avatar: %w", err)
+	}
+	s.pruneGravatarCache()
+	return readCachedGravatar(base)
+}
+
+// pruneGravatarCache removes the least recently fetched files once the cache holds more than maxCachedGravatars
+func (s *AvatarService) pruneGravatarCache() {
+	entries, err := os.ReadDir(s.GetCacheDir())
+	if err != nil || len(entries) <= maxCachedGravatars {
+		return
+	}
+
+	type cachedFile struct {
+		name    string
+		modTime time.Time
+	}
+	files := make([]cachedFile, 0, len(entries))
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			files = append(files, cachedFile{entry.Name(), info.ModTime()})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	for _, file := range files[:max(len(files)-maxCachedGravatars, 0)] {
+		os.Remove(filepath.Join(s.GetCacheDir(), file.name))
+	}
+}
+
+// readCachedGravatar reads a cached Gravatar image in either of the formats Gravatar sends
+func readCachedGravatar(base string) (*Avatar, error) {
+	for ext, contentType := range map[string]string{".png": "image/png", ".jpg": "image/jpeg"} {
+		info, err := os.Stat(base + ext)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(base + ext)
+		if err != nil {
+			return nil, err
+		}
+
+		etag := sha256.Sum256(data)
+		return &Avatar{
+			Data:        data,
+			ContentType: contentType,
+			ETag:        `"` + hex.EncodeToString(etag[:8]) + `"`,
+			ModTime:     info.ModTime(),
+		}, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// writeFileAtomic writes a file through a temporary file, so readers never see it half written
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// avatarSize rounds a requested size up to one of avatarSizes, or down to the largest
+func avatarSize(size int) int {
+	if size <= 0 {
+		return DefaultAvatarSize
+	}
+	for _, bucket := range avatarSizes {
+		if size <= bucket {
+			return bucket
+		}
+	}
+	return avatarSizes[len(avatarSizes)-1]
+}
+
+// avatarInitials returns up to two uppercase initials: of the first and the last word of a name
+func avatarInitials(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+
+	initials := []rune{[]rune(words[0])[0]}
+	if len(words) > 1 {
+		initials = append(initials, []rune(words[len(words)-1])[0])
+	}
+	return strings.ToUpper(string(initials))
+}
+
+// avatarColors derives the background and foreground colors of an avatar from its hash
+func avatarColors(hash string) (color.RGBA, color.RGBA) {
+	hue := float64(hexByte(hash, 15)) / 255 * 360
+	return color.RGBA{0xf0, 0xf0, 0xf0, 0xff}, hslColor(hue, 0.55, 0.55)
+}
+
+// identiconCells returns the filled cells of a 5x5 identicon, mirrored left to right.
+// The first 15 bytes of the hash pick the cells and the last one the color.
+func identiconCells(hash string) [5][5]bool {
+	var cells [5][5]bool
+	for i := 0; i < 15; i++ {
+		row, col := i%5, i/5
+		if hexByte(hash, i)%2 == 0 {
+			cells[row][col] = true
+			cells[row][4-col] = true
+		}
+	}
+	return cells
+}
+
+// identiconPNG renders an identicon as PNG
+func identiconPNG(hash string, size int) ([]byte, error) {
+	background, foreground := avatarColors(hash)
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	fillRect(img, 0, 0, size, size, background)
+
+	cell := size / 6
+	padding := (size - 5*cell) / 2
+	for row, cols := range identiconCells(hash) {
+		for col, filled := range cols {
+			if filled {
+				fillRect(img, padding+col*cell, padding+row*cell, cell, cell, foreground)
+			}
+		}
+	}
+	return encodePNG(img)
+}
+
+// identiconSVG renders an identicon as SVG
+func identiconSVG(hash string, size int) []byte {
+	background, foreground := avatarColors(hash)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 12 12" shape-rendering="crispEdges">`, size, size)
+	fmt.Fprintf(&buf, `<rect width="12" height="12" fill="%s"/>`, hexColor(background))
+	for row, cols := range identiconCells(hash) {
+		for col, filled := range cols {
+			if filled {
+				fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="2" height="2" fill="%s"/>`, 1+col*2, 1+row*2, hexColor(foreground))
+			}
+		}
+	}
+	buf.WriteString(`</svg>`)
+	return buf.Bytes()
+}
+
+// initialsSVG renders initials on a colored background as SVG
+func initialsSVG(hash, initials string, size int) []byte {
+	_, background := avatarColors(hash)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 100 100">`, size, size)
+	fmt.Fprintf(&buf, `<rect width="100" height="100" fill="%s"/>`, hexColor(background))
+	fmt.Fprintf(&buf, `<text x="50" y="50" dy="0.35em" text-anchor="middle" font-family="sans-serif" font-size="40" fill="#ffffff">%s</text>`, html.EscapeString(initials))
+	buf.WriteString(`</svg>`)
+	return buf.Bytes()
+}
+
+// initialsPNG renders initials on a colored background as PNG using the built-in bitmap font
+func initialsPNG(hash, initials string, size int) ([]byte, error) {
+	_, background := avatarColors(hash)
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	fillRect(img, 0, 0, size, size, background)
+
+	// Glyphs are 5x7 with one column between them, scaled to about half the avatar
+	letters := []rune(initials)
+	width := len(letters)*6 - 1
+	scale := size / 2 / width
+	if heightScale := size / 2 / 7; heightScale < scale {
+		scale = heightScale
+	}
+	if scale < 1 {
+		scale = 1
+	}
+
+	x := (size - width*scale) / 2
+	y := (size - 7*scale) / 2
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	for _, letter := range letters {
+		glyph := avatarFont[letter]
+		for row, bits := range glyph {
+			for col := 0; col < 5; col++ {
+				if bits&(1<<(4-col)) != 0 {
+					fillRect(img, x+col*scale, y+row*scale, scale, scale, white)
+				}
+			}
+		}
+		x += 6 * scale
+	}
+	return encodePNG(img)
+}
+
+// canDrawInitials reports whether the built-in font has every letter of the initials
+func canDrawInitials(initials string) bool {
+	for _, letter := range initials {
+		if _, ok := avatarFont[letter]; !ok {
+			return false
+		}
+	}
+	return initials != ""
+}
+
+func fillRect(img *image.RGBA, x, y, width, height int, c color.RGBA) {
+	for py := y; py < y+height; py++ {
+		for px := x; px < x+width; px++ {
+			img.SetRGBA(px, py, c)
+		}
+	}
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// hexByte returns the byte at position i of a hex string
+func hexByte(hash string, i int) byte {
+	b, _ := hex.DecodeString(hash[i*2 : i*2+2])
+	return b[0]
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// hslColor converts a hue in degrees and saturation and lightness between 0 and 1 to RGB
+func hslColor(hue, saturation, lightness float64) color.RGBA {
+	chroma := (1 - math.Abs(2*lightness-1)) * saturation
+	x := chroma * (1 - math.Abs(math.Mod(hue/60, 2)-1))
+	m := lightness - chroma/2
+
+	var r, g, b float64
+	switch {
+	case hue < 60:
+		r, g, b = chroma, x, 0
+	case hue < 120:
+		r, g, b = x, chroma, 0
+	case hue < 180:
+		r, g, b = 0, chroma, x
+	case hue < 240:
+		r, g, b = 0, x, chroma
+	case hue < 300:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+	return color.RGBA{uint8((r + m) * 255), uint8((g + m) * 255), uint8((b + m) * 255), 0xff}
+}
+
+// avatarFont is a 5x7 bitmap font for PNG initials, one row per byte with the leftmost pixel in bit 4
+var avatarFont = map[rune][7]uint8{
+	'A': {0b01110, 0b10001, 0b10001, 0b11111, 0b10001, 0b10001, 0b10001},
+	'B': {0b11110, 0b10001, 0b10001, 0b11110, 0b10001, 0b10001, 0b11110},
+	'C': {0b01110, 0b10001, 0b10000, 0b10000, 0b10000, 0b10001, 0b01110},
+	'D': {0b11110, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b11110},
+	'E': {0b11111, 0b10000, 0b10000, 0b11110, 0b10000, 0b10000, 0b11111},
+	'F': {0b11111, 0b10000, 0b10000, 0b11110, 0b10000, 0b10000, 0b10000},
+	'G': {0b01110, 0b10001, 0b10000, 0b10111, 0b10001, 0b10001, 0b01111},
+	'H': {0b10001, 0b10001, 0b10001, 0b11111, 0b10001, 0b10001, 0b10001},
+	'I': {0b01110, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b01110},
+	'J': {0b00111, 0b00010, 0b00010, 0b00010, 0b00010, 0b10010, 0b01100},
+	'K': {0b10001, 0b10010, 0b10100, 0b11000, 0b10100, 0b10010, 0b10001},
+	'L': {0b10000, 0b10000, 0b10000, 0b10000, 0b10000, 0b10000, 0b11111},
+	'M': {0b10001, 0b11011, 0b10101, 0b10101, 0b10001, 0b10001, 0b10001},
+	'N': {0b10001, 0b10001, 0b11001, 0b10101, 0b10011, 0b10001, 0b10001},
+	'O': {0b01110, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01110},
+	'P': {0b11110, 0b10001, 0b10001, 0b11110, 0b10000, 0b10000, 0b10000},
+	'Q': {0b01110, 0b10001, 0b10001, 0b10001, 0b10101, 0b10010, 0b01101},
+	'R': {0b11110, 0b10001, 0b10001, 0b11110, 0b10100, 0b10010, 0b10001},
+	'S': {0b01111, 0b10000, 0b10000, 0b01110, 0b00001, 0b00001, 0b11110},
+	'T': {0b11111, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100},
+	'U': {0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01110},
+	'V': {0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01010, 0b00100},
+	'W': {0b10001, 0b10001, 0b10001, 0b10101, 0b10101, 0b10101, 0b01010},
+	'X': {0b10001, 0b10001, 0b01010, 0b00100, 0b01010, 0b10001, 0b10001},
+	'Y': {0b10001, 0b10001, 0b01010, 0b00100, 0b00100, 0b00100, 0b00100},
+	'Z': {0b11111, 0b00001, 0b00010, 0b00100, 0b01000, 0b10000, 0b11111},
+	'0': {0b01110, 0b10001, 0b10011, 0b10101, 0b11001, 0b10001, 0b01110},
+	'1': {0b00100, 0b01100, 0b00100, 0b00100, 0b00100, 0b00100, 0b01110},
+	'2': {0b01110, 0b10001, 0b00001, 0b00010, 0b00100, 0b01000, 0b11111},
+	'3': {0b11111, 0b00010, 0b00100, 0b00010, 0b00001, 0b10001, 0b01110},
+	'4': {0b00010, 0b00110, 0b01010, 0b10010, 0b11111, 0b00010, 0b00010},
+	'5': {0b11111, 0b10000, 0b11110, 0b00001, 0b00001, 0b10001, 0b01110},
+	'6': {0b00110, 0b01000, 0b10000, 0b11110, 0b10001, 0b10001, 0b01110},
+	'7': {0b11111, 0b00001, 0b00010, 0b00100, 0b01000, 0b01000, 0b01000},
+	'8': {0b01110, 0b10001, 0b10001, 0b01110, 0b10001, 0b10001, 0b01110},
+	'9': {0b01110, 0b10001, 0b10001, 0b01111, 0b00001, 0b00010, 0b01100},
+}
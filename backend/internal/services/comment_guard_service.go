@@ -0,0 +1,541 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Reasons recorded when a comment guard blocks a submission
+const (
+	GuardReasonHoneypot      = "honeypot"
+	GuardReasonInvalidToken  = "invalid_token"
+	GuardReasonExpiredToken  = "expired_token"
+	GuardReasonReusedToken   = "reused_token"
+	GuardReasonTooFast       = "too_fast"
+	GuardReasonProofOfWork   = "proof_of_work"
+	GuardReasonRateLimitIP   = "rate_limit_ip"
+	GuardReasonRateLimitPost = "rate_limit_post"
+)
+
+// commentTokenMaxAge is how long a rendered comment form stays valid
+const commentTokenMaxAge = 24 * time.Hour
+
+// commentRejectionRetention is how long blocked submissions are kept for review
+const commentRejectionRetention = 30 * 24 * time.Hour
+
+// maxRecordedRejectionsPerIP bounds how many blocked submissions of one address are stored per
+// rejectionRecordWindow, so a flood of blocked submissions doesn't turn into a flood of writes
+const (
+	maxRecordedRejectionsPerIP = 20
+	rejectionRecordWindow      = time.Hour
+)
+
+// maxPowNonceLength bounds the proof-of-work solution sent by the client
+const maxPowNonceLength = 32
+
+// CommentSubmission is a comment sent by a reader, together with the anti-spam fields of the form
+type CommentSubmission struct {
+	PostID     uint
+	Name       string
+	Email      string
+	Content    string
+	IPAddress  string
+	Referer    string
+	Honeypot   string // Hidden field that people leave empty and bots fill in
+	FormToken  string // Signed token issued when the form was rendered
+	PowNonce   string // Proof-of-work solution for the form token
+	ReceivedAt time.Time
+}
+
+// CommentRejectedError is returned when a guard blocks a submission
+type CommentRejectedError struct {
+	Reason string
+	Detail string
+}
+
+func (e *CommentRejectedError) Error() string {
+	return fmt.Sprintf("comment rejected (%s): %s", e.Reason, e.Detail)
+}
+
+// CommentGuard inspects a submission and returns a *CommentRejectedError to block it
+type CommentGuard interface {
+	Check(sub *CommentSubmission) error
+}
+
+// CommentReleaser is implemented by guards that reserve something for a submission while checking it,
+// like a form token or a rate limit slot. Release gives it back when the submission isn't stored.
+type CommentReleaser interface {
+	Release(sub *CommentSubmission)
+}
+
+// CommentGuardService runs comment submissions through a pipeline of anti-spam guards
+// and records the reason whenever one of them blocks a submission
+type CommentGuardService struct {
+	db            *gorm.DB
+	configService *ConfigService
+	guards        []CommentGuard
+
+	mu        sync.Mutex
+	recorded  hitCounter // Stored rejections per address
+	lastPrune time.Time  // When rejections past the retention period were last dropped
+}
+
+// NewCommentGuardService creates the guard pipeline with the built-in guards:
+// honeypot field, signed form token with a minimum time-to-submit, proof-of-work and rate limits
+func NewCommentGuardService(db *gorm.DB, configService *ConfigService) *CommentGuardService {
+	s := &CommentGuardService{
+		db:            db,
+		configService: configService,
+		recorded:      make(hitCounter),
+	}
+
+	s.Use(
+		honeypotGuard{},
+		&formTokenGuard{service: s, used: make(map[string]time.Time)},
+		&proofOfWorkGuard{service: s},
+		newRateLimitGuard(configService),
+	)
+	return s
+}
+
+// Use appends guards to the end of the pipeline
+func (s *CommentGuardService) Use(guards ...CommentGuard) {
+	s.guards = append(s.guards, guards...)
+}
+
+// Check runs a submission through every guard in order.
+// The first rejection is recorded and returned, other errors are returned as is.
+// A submission that passes holds its reservations until Release is called.
+func (s *CommentGuardService) Check(sub *CommentSubmission) error {
+	if sub.ReceivedAt.IsZero() {
+		sub.ReceivedAt = time.Now()
+	}
+
+	for i, guard := range s.guards {
+		err := guard.Check(sub)
+		if err == nil {
+			continue
+		}
+
+		// The guards that passed give back what they reserved
+		release(sub, s.guards[:i])
+
+		var rejected *CommentRejectedError
+		if errors.As(err, &rejected) {
+			s.RecordRejection(sub, rejected)
+		}
+		return err
+	}
+	return nil
+}
+
+// Release gives back what the guards reserved for a submission that passed Check but wasn't stored
+func (s *CommentGuardService) Release(sub *CommentSubmission) {
+	release(sub, s.guards)
+}
+
+// release calls Release on the guards that reserve something
+func release(sub *CommentSubmission, guards []CommentGuard) {
+	for _, guard := range guards {
+		if releaser, ok := guard.(CommentReleaser); ok {
+			releaser.Release(sub)
+		}
+	}
+}
+
+// IssueFormToken returns a signed token for the comment form of a post.
+// It carries the time the form was rendered and doubles as the proof-of-work challenge.
+func (s *CommentGuardService) IssueFormToken(postID uint) (string, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate form token: %w", err)
+	}
+
+	payload := fmt.Sprintf("%d.%d.%s", time.Now().Unix(), postID, hex.EncodeToString(nonce))
+	signature, err := s.sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return payload + "." + signature, nil
+}
+
+// ProofOfWorkDifficulty returns the configured number of leading zero bits, 0 when disabled
+func (s *CommentGuardService) ProofOfWorkDifficulty() int {
+	difficulty := s.configService.GetIntConfig("comment_pow_difficulty", 0)
+	if difficulty < 0 {
+		return 0
+	}
+	if difficulty > 32 {
+		return 32
+	}
+	return difficulty
+}
+
+// GetRejections returns recently blocked submissions, newest first, optionally filtered by reason
+func (s *CommentGuardService) GetRejections(page, limit int, reason string) ([]models.CommentRejection, int64, error) {
+	var rejections []models.CommentRejection
+	var totalCount int64
+
+	query := s.db.Model(&models.CommentRejection{})
+	if reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+
+	if err := query.Count(&totalCount).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count rejections: %w", err)
+	}
+
+	offset := (page - 1) * limit
+	if err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&rejections).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch rejections: %w", err)
+	}
+
+	return rejections, totalCount, nil
+}
+
+// GetRejectionStats returns the number of recorded rejections per reason
+func (s *CommentGuardService) GetRejectionStats() (map[string]int64, error) {
+	var rows []struct {
+		Reason string
+		Count  int64
+	}
+	if err := s.db.Model(&models.CommentRejection{}).
+		Select("reason, COUNT(*) AS count").
+		Group("reason").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count rejections: %w", err)
+	}
+
+	stats := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		stats[row.Reason] = row.Count
+	}
+	return stats, nil
+}
+
+// RecordRejection stores a blocked submission and drops records past the retention period.
+// Only the first maxRecordedRejectionsPerIP rejections of an address per window are stored.
+func (s *CommentGuardService) RecordRejection(sub *CommentSubmission, rejected *CommentRejectedError) {
+	record, prune := s.throttleRejection(sub, time.Now())
+	if !record {
+		return
+	}
+
+	rejection := models.CommentRejection{
+		PostID:    sub.PostID,
+		Reason:    rejected.Reason,
+		Detail:    truncateRunes(rejected.Detail, 255),
+		Name:      truncateRunes(sub.Name, 100),
+		Email:     truncateRunes(sub.Email, 255),
+		Content:   truncateRunes(sub.Content, 2000),
+		IPAddress: truncateRunes(sub.IPAddress, 45),
+		Referer:   truncateRunes(sub.Referer, 500),
+	}
+	if err := s.db.Create(&rejection).Error; err != nil {
+		log.Printf("Warning: failed to record comment rejection: %v", err)
+	}
+
+	if prune {
+		cutoff := time.Now().Add(-commentRejectionRetention)
+		s.db.Where("created_at < ?", cutoff).Delete(&models.CommentRejection{})
+	}
+}
+
+// throttleRejection reports whether a rejection of the submission's address should still be stored,
+// and whether it is time to drop old records, which is done at most once per window
+func (s *CommentGuardService) throttleRejection(sub *CommentSubmission, now time.Time) (record, prune bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recorded.sweep(now, rejectionRecordWindow)
+	key := ipRateKey(sub.IPAddress)
+	if s.recorded.count(key, now, rejectionRecordWindow) >= maxRecordedRejectionsPerIP {
+		return false, false
+	}
+	s.recorded.add(key, now)
+
+	if now.Sub(s.lastPrune) >= rejectionRecordWindow {
+		s.lastPrune = now
+		prune = true
+	}
+	return true, prune
+}
+
+// sign returns the signature of a form token payload
+func (s *CommentGuardService) sign(payload string) (string, error) {
+	signature, err := s.configService.Sign("comment-form", payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign form token: %w", err)
+	}
+	return signature, nil
+}
+
+// honeypotGuard rejects submissions that filled in the hidden honeypot field
+type honeypotGuard struct{}
+
+func (honeypotGuard) Check(sub *CommentSubmission) error {
+	if strings.TrimSpace(sub.Honeypot) != "" {
+		return &CommentRejectedError{Reason: GuardReasonHoneypot, Detail: "hidden field was filled in"}
+	}
+	return nil
+}
+
+// formTokenGuard verifies the signed form token and the minimum time between rendering and submitting.
+// A token can post one comment, so its proof-of-work can't be replayed. A token is taken when it passes
+// the check, and used tokens are remembered in memory until they expire.
+type formTokenGuard struct {
+	service *CommentGuardService
+
+	mu   sync.Mutex
+	used map[string]time.Time // Nonces of tokens taken by a submission, with the time they were issued
+}
+
+func (g *formTokenGuard) Check(sub *CommentSubmission) error {
+	parts := strings.Split(sub.FormToken, ".")
+	if len(parts) != 4 {
+		return &CommentRejectedError{Reason: GuardReasonInvalidToken, Detail: "missing or malformed form token"}
+	}
+
+	payload := strings.Join(parts[:3], ".")
+	expected, err := g.service.sign(payload)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(expected), []byte(parts[3])) {
+		return &CommentRejectedError{Reason: GuardReasonInvalidToken, Detail: "form token signature mismatch"}
+	}
+
+	issuedUnix, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return &CommentRejectedError{Reason: GuardReasonInvalidToken, Detail: "malformed form token time"}
+	}
+	if parts[1] != strconv.FormatUint(uint64(sub.PostID), 10) {
+		return &CommentRejectedError{Reason: GuardReasonInvalidToken, Detail: "form token issued for another post"}
+	}
+
+	elapsed := sub.ReceivedAt.Sub(time.Unix(issuedUnix, 0))
+	if elapsed > commentTokenMaxAge {
+		return &CommentRejectedError{Reason: GuardReasonExpiredToken, Detail: fmt.Sprintf("form was rendered %s ago", elapsed.Round(time.Minute))}
+	}
+
+	minSeconds := g.service.configService.GetIntConfig("comment_min_submit_seconds", 3)
+	if elapsed < time.Duration(minSeconds)*time.Second {
+		return &CommentRejectedError{Reason: GuardReasonTooFast, Detail: fmt.Sprintf("submitted %s after rendering", elapsed.Round(time.Millisecond))}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, used := g.used[parts[2]]; used {
+		return &CommentRejectedError{Reason: GuardReasonReusedToken, Detail: "form token already posted a comment"}
+	}
+
+	// Expired tokens are rejected anyway, so they needn't be remembered
+	cutoff := sub.ReceivedAt.Add(-commentTokenMaxAge)
+	for nonce, issued := range g.used {
+		if issued.Before(cutoff) {
+			delete(g.used, nonce)
+		}
+	}
+	// Take the token now, so parallel submissions of the same form can't all pass
+	g.used[parts[2]] = time.Unix(issuedUnix, 0)
+
+	return nil
+}
+
+func (g *formTokenGuard) Release(sub *CommentSubmission) {
+	parts := strings.Split(sub.FormToken, ".")
+	if len(parts) != 4 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.used, parts[2])
+}
+
+// proofOfWorkGuard requires SHA-256(token + ":" + nonce) to start with the configured number of zero bits
+type proofOfWorkGuard struct {
+	service *CommentGuardService
+}
+
+func (g *proofOfWorkGuard) Check(sub *CommentSubmission) error {
+	difficulty := g.service.ProofOfWorkDifficulty()
+	if difficulty == 0 {
+		return nil
+	}
+
+	if sub.PowNonce == "" || len(sub.PowNonce) > maxPowNonceLength {
+		return &CommentRejectedError{Reason: GuardReasonProofOfWork, Detail: "missing proof-of-work solution"}
+	}
+
+	sum := sha256.Sum256([]byte(sub.FormToken + ":" + sub.PowNonce))
+	if zeros := leadingZeroBits(sum[:]); zeros < difficulty {
+		return &CommentRejectedError{Reason: GuardReasonProofOfWork, Detail: fmt.Sprintf("solution has %d of %d zero bits", zeros, difficulty)}
+	}
+	return nil
+}
+
+// leadingZeroBits counts the zero bits at the start of a hash
+func leadingZeroBits(sum []byte) int {
+	count := 0
+	for _, b := range sum {
+		if b != 0 {
+			return count + bits.LeadingZeros8(b)
+		}
+		count += 8
+	}
+	return count
+}
+
+// rateLimitGuard limits comments per IP address and per post over a sliding window.
+// A submission takes its slot when it passes the check and gives it back when it isn't stored.
+// Counters live in memory, so they reset when the server restarts.
+type rateLimitGuard struct {
+	configService *ConfigService
+
+	mu   sync.Mutex
+	hits hitCounter
+}
+
+func newRateLimitGuard(configService *ConfigService) *rateLimitGuard {
+	return &rateLimitGuard{
+		configService: configService,
+		hits:          make(hitCounter),
+	}
+}
+
+func (g *rateLimitGuard) Check(sub *CommentSubmission) error {
+	window := g.window()
+	ipLimit := g.configService.GetIntConfig("comment_ip_rate_limit", 5)
+	postLimit := g.configService.GetIntConfig("comment_post_rate_limit", 30)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.hits.sweep(sub.ReceivedAt, window)
+
+	if ipLimit > 0 && sub.IPAddress != "" {
+		if count := g.hits.count(ipRateKey(sub.IPAddress), sub.ReceivedAt, window); count >= ipLimit {
+			return &CommentRejectedError{Reason: GuardReasonRateLimitIP, Detail: fmt.Sprintf("%d comments from this address in %s", count, window)}
+		}
+	}
+
+	if postLimit > 0 {
+		if count := g.hits.count(postRateKey(sub.PostID), sub.ReceivedAt, window); count >= postLimit {
+			return &CommentRejectedError{Reason: GuardReasonRateLimitPost, Detail: fmt.Sprintf("%d comments on this post in %s", count, window)}
+		}
+	}
+
+	// Take the slots while holding the lock, so parallel submissions can't all squeeze under the limit
+	if sub.IPAddress != "" {
+		g.hits.add(ipRateKey(sub.IPAddress), sub.ReceivedAt)
+	}
+	g.hits.add(postRateKey(sub.PostID), sub.ReceivedAt)
+
+	return nil
+}
+
+func (g *rateLimitGuard) Release(sub *CommentSubmission) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if sub.IPAddress != "" {
+		g.hits.remove(ipRateKey(sub.IPAddress), sub.ReceivedAt)
+	}
+	g.hits.remove(postRateKey(sub.PostID), sub.ReceivedAt)
+}
+
+// window returns the configured rate limit window
+func (g *rateLimitGuard) window() time.Duration {
+	minutes := g.configService.GetIntConfig("comment_rate_window_minutes", 10)
+	if minutes < 1 {
+		minutes = 1
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// hitCounter keeps the times of hits per key for sliding window limits; callers synchronize access
+type hitCounter map[string][]time.Time
+
+// count drops hits older than the window and returns how many remain
+func (h hitCounter) count(key string, now time.Time, window time.Duration) int {
+	hits := h[key]
+	cutoff := now.Add(-window)
+
+	kept := hits[:0]
+	for _, hit := range hits {
+		if hit.After(cutoff) {
+			kept = append(kept, hit)
+		}
+	}
+
+	if len(kept) == 0 {
+		delete(h, key)
+		return 0
+	}
+	h[key] = kept
+	return len(kept)
+}
+
+// add records a hit
+func (h hitCounter) add(key string, at time.Time) {
+	h[key] = append(h[key], at)
+}
+
+// remove drops one hit recorded at the given time
+func (h hitCounter) remove(key string, at time.Time) {
+	hits := h[key]
+	for i, hit := range hits {
+		if hit.Equal(at) {
+			hits = append(hits[:i], hits[i+1:]...)
+			break
+		}
+	}
+
+	if len(hits) == 0 {
+		delete(h, key)
+		return
+	}
+	h[key] = hits
+}
+
+// sweep drops keys of idle addresses now and then, so the map doesn't grow without bound
+func (h hitCounter) sweep(now time.Time, window time.Duration) {
+	if len(h) <= 1000 {
+		return
+	}
+	for key := range h {
+		h.count(key, now, window)
+	}
+}
+
+func ipRateKey(ip string) string {
+	return "ip:" + ip
+}
+
+func postRateKey(postID uint) string {
+	return "post:" + strconv.FormatUint(uint64(postID), 10)
+}
+
+// truncateRunes shortens a string to at most maxRunes characters
+func truncateRunes(text string, maxRunes int) string {
+	runes := []rune(text)
+	if len(runes) <= maxRunes {
+		return text
+	}
+	return string(runes[:maxRunes])
+}
@@ -0,0 +1,366 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newGuardTestService(t *testing.T, configs map[string]string) *CommentGuardService {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Config{}, &models.CommentRejection{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	configService := NewConfigService(db)
+	if err := configService.UpdateConfigs(configs); err != nil {
+		t.Fatalf("failed to update configs: %v", err)
+	}
+	return NewCommentGuardService(db, configService)
+}
+
+// signedFormToken builds a form token as IssueFormToken does, for a chosen time and nonce
+func signedFormToken(t *testing.T, s *CommentGuardService, issued time.Time, postID uint, nonce string) string {
+	t.Helper()
+	payload := fmt.Sprintf("%d.%d.%s", issued.Unix(), postID, nonce)
+	signature, err := s.sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload + "." + signature
+}
+
+// rejectionReason returns the reason of a *CommentRejectedError, or "" for nil and other errors
+func rejectionReason(err error) string {
+	var rejected *CommentRejectedError
+	if errors.As(err, &rejected) {
+		return rejected.Reason
+	}
+	return ""
+}
+
+func TestFormTokenGuard(t *testing.T) {
+	s := newGuardTestService(t, map[string]string{"comment_min_submit_seconds": "3"})
+	now := time.Now()
+	valid := signedFormToken(t, s, now.Add(-time.Minute), 7, "0011223344556677")
+	tampered := valid[:len(valid)-1] + "0"
+	if tampered == valid {
+		tampered = valid[:len(valid)-1] + "1"
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		postID uint
+		want   string
+	}{
+		{"valid", valid, 7, ""},
+		{"missing", "", 7, GuardReasonInvalidToken},
+		{"malformed", "a.b.c", 7, GuardReasonInvalidToken},
+		{"bad signature", tampered, 7, GuardReasonInvalidToken},
+		{"signed for another purpose", func() string {
+			payload := fmt.Sprintf("%d.7.aa", now.Add(-time.Minute).Unix())
+			signature, _ := s.configService.Sign("avatar", payload)
+			return payload + "." + signature
+		}(), 7, GuardReasonInvalidToken},
+		{"another post", valid, 8, GuardReasonInvalidToken},
+		{"malformed time", func() string {
+			signature, _ := s.sign("soon.7.aa")
+			return "soon.7.aa." + signature
+		}(), 7, GuardReasonInvalidToken},
+		{"expired", signedFormToken(t, s, now.Add(-commentTokenMaxAge-time.Minute), 7, "aa"), 7, GuardReasonExpiredToken},
+		{"just before expiry", signedFormToken(t, s, now.Add(-commentTokenMaxAge+time.Minute), 7, "ab"), 7, ""},
+		{"too fast", signedFormToken(t, s, now.Add(-time.Second), 7, "ac"), 7, GuardReasonTooFast},
+		{"issued in the future", signedFormToken(t, s, now.Add(time.Minute), 7, "ad"), 7, GuardReasonTooFast},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			guard := &formTokenGuard{service: s, used: make(map[string]time.Time)}
+			err := guard.Check(&CommentSubmission{PostID: test.postID, FormToken: test.token, ReceivedAt: now})
+			if reason := rejectionReason(err); reason != test.want || (reason == "" && err != nil) {
+				t.Errorf("Check() = %v, want reason %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestFormTokenGuardReuse(t *testing.T) {
+	s := newGuardTestService(t, map[string]string{"comment_min_submit_seconds": "0"})
+	guard := &formTokenGuard{service: s, used: make(map[string]time.Time)}
+	sub := &CommentSubmission{PostID: 1, FormToken: signedFormToken(t, s, time.Now(), 1, "aa"), ReceivedAt: time.Now()}
+
+	if err := guard.Check(sub); err != nil {
+		t.Fatalf("first Check() = %v, want nil", err)
+	}
+	if err := guard.Check(sub); rejectionReason(err) != GuardReasonReusedToken {
+		t.Fatalf("second Check() = %v, want %s", err, GuardReasonReusedToken)
+	}
+
+	// A released token can be used again, as its comment wasn't stored
+	guard.Release(sub)
+	if err := guard.Check(sub); err != nil {
+		t.Fatalf("Check() after Release() = %v, want nil", err)
+	}
+
+	// Expired tokens are forgotten when another token is taken
+	guard.used["old"] = time.Now().Add(-commentTokenMaxAge - time.Hour)
+	other := &CommentSubmission{PostID: 1, FormToken: signedFormToken(t, s, time.Now(), 1, "bb"), ReceivedAt: time.Now()}
+	if err := guard.Check(other); err != nil {
+		t.Fatalf("Check() of another token = %v, want nil", err)
+	}
+	if _, kept := guard.used["old"]; kept {
+		t.Error("expired token is still remembered")
+	}
+}
+
+func TestCommentGuardConcurrentReuse(t *testing.T) {
+	s := newGuardTestService(t, map[string]string{
+		"comment_min_submit_seconds": "0",
+		"comment_ip_rate_limit":      "0",
+		"comment_post_rate_limit":    "0",
+	})
+	token := signedFormToken(t, s, time.Now(), 1, "aa")
+
+	var passed, reused int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := s.Check(&CommentSubmission{PostID: 1, FormToken: token, IPAddress: "192.0.2." + strconv.Itoa(i)})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				passed++
+			case rejectionReason(err) == GuardReasonReusedToken:
+				reused++
+			default:
+				t.Errorf("Check() = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if passed != 1 || reused != 19 {
+		t.Errorf("%d submissions passed and %d were rejected as reused, want 1 and 19", passed, reused)
+	}
+}
+
+func TestCommentGuardConcurrentRateLimit(t *testing.T) {
+	s := newGuardTestService(t, map[string]string{
+		"comment_min_submit_seconds": "0",
+		"comment_ip_rate_limit":      "3",
+	})
+
+	var passed int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		token := signedFormToken(t, s, time.Now(), 1, strconv.Itoa(i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Check(&CommentSubmission{PostID: 1, FormToken: token, IPAddress: "192.0.2.1"})
+			if err != nil && rejectionReason(err) != GuardReasonRateLimitIP {
+				t.Errorf("Check() = %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				passed++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if passed != 3 {
+		t.Errorf("%d parallel submissions passed, want the limit of 3", passed)
+	}
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		sum  []byte
+		want int
+	}{
+		{[]byte{}, 0},
+		{[]byte{0xff}, 0},
+		{[]byte{0x80, 0x00}, 0},
+		{[]byte{0x40}, 1},
+		{[]byte{0x01}, 7},
+		{[]byte{0x00, 0xff}, 8},
+		{[]byte{0x00, 0x0f}, 12},
+		{[]byte{0x00, 0x00, 0x00, 0x01}, 31},
+		{[]byte{0x00, 0x00}, 16},
+	}
+	for _, test := range tests {
+		if got := leadingZeroBits(test.sum); got != test.want {
+			t.Errorf("leadingZeroBits(%x) = %d, want %d", test.sum, got, test.want)
+		}
+	}
+}
+
+func TestProofOfWorkGuard(t *testing.T) {
+	s := newGuardTestService(t, map[string]string{"comment_pow_difficulty": "8"})
+	guard := &proofOfWorkGuard{service: s}
+	token := "1700000000.1.aa.signature"
+
+	// Search for solutions the way the form script does
+	var solved, unsolved string
+	for i := 0; solved == "" || unsolved == ""; i++ {
+		nonce := strconv.Itoa(i)
+		if guard.Check(&CommentSubmission{FormToken: token, PowNonce: nonce}) == nil {
+			solved = nonce
+		} else {
+			unsolved = nonce
+		}
+	}
+
+	tests := []struct {
+		name  string
+		nonce string
+		want  string
+	}{
+		{"solved", solved, ""},
+		{"unsolved", unsolved, GuardReasonProofOfWork},
+		{"missing", "", GuardReasonProofOfWork},
+		{"too long", solved + string(make([]byte, maxPowNonceLength)), GuardReasonProofOfWork},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := guard.Check(&CommentSubmission{FormToken: token, PowNonce: test.nonce})
+			if reason := rejectionReason(err); reason != test.want || (reason == "" && err != nil) {
+				t.Errorf("Check() = %v, want reason %q", err, test.want)
+			}
+		})
+	}
+
+	// The solution is bound to the token, one in 256 other tokens takes it by chance
+	bound := false
+	for i := 0; i < 64 && !bound; i++ {
+		bound = guard.Check(&CommentSubmission{FormToken: token + strconv.Itoa(i), PowNonce: solved}) != nil
+	}
+	if !bound {
+		t.Error("solution was accepted for every other token")
+	}
+
+	disabled := &proofOfWorkGuard{service: newGuardTestService(t, map[string]string{"comment_pow_difficulty": "0"})}
+	if err := disabled.Check(&CommentSubmission{FormToken: token}); err != nil {
+		t.Errorf("Check() with proof-of-work disabled = %v, want nil", err)
+	}
+}
+
+func TestRateLimitGuard(t *testing.T) {
+	s := newGuardTestService(t, map[string]string{
+		"comment_ip_rate_limit":       "2",
+		"comment_post_rate_limit":     "3",
+		"comment_rate_window_minutes": "10",
+	})
+	guard := newRateLimitGuard(s.configService)
+	start := time.Now()
+	submit := func(ip string, postID uint, at time.Duration) error {
+		return guard.Check(&CommentSubmission{PostID: postID, IPAddress: ip, ReceivedAt: start.Add(at)})
+	}
+
+	steps := []struct {
+		name   string
+		ip     string
+		postID uint
+		at     time.Duration
+		want   string
+	}{
+		{"first from an address", "192.0.2.1", 1, 0, ""},
+		{"second from the address", "192.0.2.1", 2, time.Minute, ""},
+		{"over the address limit", "192.0.2.1", 3, 2 * time.Minute, GuardReasonRateLimitIP},
+		{"another address", "192.0.2.2", 1, 3 * time.Minute, ""},
+		{"third on the post", "192.0.2.3", 1, 4 * time.Minute, ""},
+		{"over the post limit", "192.0.2.4", 1, 5 * time.Minute, GuardReasonRateLimitPost},
+		{"first hit left the window", "192.0.2.1", 3, 10*time.Minute + time.Second, ""},
+		{"second hit still in the window", "192.0.2.1", 3, 10*time.Minute + 2*time.Second, GuardReasonRateLimitIP},
+		{"post hit left the window", "192.0.2.5", 1, 13*time.Minute + time.Second, ""},
+	}
+	for _, step := range steps {
+		err := submit(step.ip, step.postID, step.at)
+		if reason := rejectionReason(err); reason != step.want || (reason == "" && err != nil) {
+			t.Errorf("%s: Check() = %v, want reason %q", step.name, err, step.want)
+		}
+	}
+}
+
+func TestRateLimitGuardRelease(t *testing.T) {
+	s := newGuardTestService(t, map[string]string{"comment_ip_rate_limit": "1"})
+	guard := newRateLimitGuard(s.configService)
+	sub := &CommentSubmission{PostID: 1, IPAddress: "192.0.2.1", ReceivedAt: time.Now()}
+
+	if err := guard.Check(sub); err != nil {
+		t.Fatalf("Check() = %v, want nil", err)
+	}
+	retry := &CommentSubmission{PostID: 1, IPAddress: "192.0.2.1", ReceivedAt: sub.ReceivedAt.Add(time.Second)}
+	if err := guard.Check(retry); rejectionReason(err) != GuardReasonRateLimitIP {
+		t.Fatalf("Check() over the limit = %v, want %s", err, GuardReasonRateLimitIP)
+	}
+
+	guard.Release(sub)
+	if err := guard.Check(retry); err != nil {
+		t.Errorf("Check() after Release() = %v, want nil", err)
+	}
+	if len(guard.hits) != 2 {
+		t.Errorf("%d keys counted, want the address and the post", len(guard.hits))
+	}
+}
+
+func TestCommentGuardReleasesPassedGuardsOnRejection(t *testing.T) {
+	s := newGuardTestService(t, map[string]string{
+		"comment_min_submit_seconds": "0",
+		"comment_pow_difficulty":     "16",
+	})
+	token := signedFormToken(t, s, time.Now(), 1, "aa")
+
+	// The token passes, then the missing proof-of-work blocks the submission
+	err := s.Check(&CommentSubmission{PostID: 1, FormToken: token, IPAddress: "192.0.2.1"})
+	if rejectionReason(err) != GuardReasonProofOfWork {
+		t.Fatalf("Check() = %v, want %s", err, GuardReasonProofOfWork)
+	}
+
+	tokenGuard := s.guards[1].(*formTokenGuard)
+	if _, used := tokenGuard.used["aa"]; used {
+		t.Error("token is still taken after a later guard rejected the submission")
+	}
+}
+
+func TestRecordRejectionThrottledPerAddress(t *testing.T) {
+	s := newGuardTestService(t, nil)
+	rejected := &CommentRejectedError{Reason: GuardReasonHoneypot, Detail: "test"}
+
+	for i := 0; i < maxRecordedRejectionsPerIP+5; i++ {
+		s.RecordRejection(&CommentSubmission{PostID: 1, IPAddress: "192.0.2.1"}, rejected)
+	}
+	s.RecordRejection(&CommentSubmission{PostID: 1, IPAddress: "192.0.2.2"}, rejected)
+
+	var stored []models.CommentRejection
+	if err := s.db.Find(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	perAddress := make(map[string]int)
+	for _, rejection := range stored {
+		perAddress[rejection.IPAddress]++
+	}
+	if perAddress["192.0.2.1"] != maxRecordedRejectionsPerIP || perAddress["192.0.2.2"] != 1 {
+		t.Errorf("stored rejections per address = %v, want %d and 1", perAddress, maxRecordedRejectionsPerIP)
+	}
+}
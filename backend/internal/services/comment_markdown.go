@@ -0,0 +1,115 @@
+package services
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday/v2"
+)
+
+// commentMarkdownExtensions is the Markdown readers can use in comments. Tables, footnotes
+// and heading IDs are left out, and single line breaks are kept as readers expect.
+const commentMarkdownExtensions = blackfriday.NoIntraEmphasis | blackfriday.FencedCode | blackfriday.Autolink |
+	blackfriday.Strikethrough | blackfriday.HardLineBreak | blackfriday.NoEmptyLineBeforeBlock
+
+// commentPolicy allows only the elements the comment renderer produces
+var commentPolicy = newCommentPolicy()
+
+// RenderCommentMarkdown converts the Markdown of a comment to sanitized HTML.
+// Readers get emphasis, inline code, code blocks, lists, quotes and links; headings become
+// paragraphs, images become links and raw HTML is shown as text.
+func RenderCommentMarkdown(content string) string {
+	document := blackfriday.New(blackfriday.WithExtensions(commentMarkdownExtensions)).Parse([]byte(content))
+
+	renderer := &commentRenderer{
+		HTMLRenderer: blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{}),
+	}
+
+	var buf bytes.Buffer
+	document.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		return renderer.RenderNode(&buf, node, entering)
+	})
+
+	return strings.TrimSpace(commentPolicy.Sanitize(buf.String()))
+}
+
+// commentRenderer is the blackfriday HTML renderer restricted to what comments may contain
+type commentRenderer struct {
+	*blackfriday.HTMLRenderer
+}
+
+// RenderNode renders the comment subset and turns everything else into harmless text
+func (r *commentRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	switch node.Type {
+	case blackfriday.Heading:
+		// Headings would stand out from the rest of the thread
+		if entering {
+			io.WriteString(w, "<p>")
+		} else {
+			io.WriteString(w, "</p>\n")
+		}
+		return blackfriday.GoToNext
+	case blackfriday.Link, blackfriday.Image:
+		// Images become links to them, so comments can't load remote content into the page
+		if href, ok := commentLinkHref(node.LinkData.Destination); ok {
+			if entering {
+				io.WriteString(w, `<a href="`+html.EscapeString(href)+`" rel="nofollow ugc">`)
+			} else {
+				io.WriteString(w, "</a>")
+			}
+		}
+		return blackfriday.GoToNext
+	case blackfriday.HTMLBlock:
+		io.WriteString(w, "<p>"+strings.ReplaceAll(html.EscapeString(strings.TrimSpace(string(node.Literal))), "\n", "<br>\n")+"</p>\n")
+		return blackfriday.GoToNext
+	case blackfriday.HTMLSpan:
+		io.WriteString(w, html.EscapeString(string(node.Literal)))
+		return blackfriday.GoToNext
+	case blackfriday.HorizontalRule:
+		return blackfriday.GoToNext
+	case blackfriday.Hardbreak:
+		// The line break at the end of a list item has nothing to separate
+		if node.Next == nil {
+			return blackfriday.GoToNext
+		}
+	}
+	return r.HTMLRenderer.RenderNode(w, node, entering)
+}
+
+// commentLinkHref returns the link target if it is an absolute http, https or mailto URL
+func commentLinkHref(destination []byte) (string, bool) {
+	parsed, err := url.Parse(strings.TrimSpace(string(destination)))
+	if err != nil {
+		return "", false
+	}
+
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+		if parsed.Host == "" {
+			return "", false
+		}
+	case "mailto":
+	default:
+		return "", false
+	}
+	return parsed.String(), true
+}
+
+// newCommentPolicy builds the allowlist for rendered comments
+func newCommentPolicy() *bluemonday.Policy {
+	policy := bluemonday.NewPolicy()
+	policy.AllowElements("p", "br", "em", "strong", "del", "code", "pre", "ul", "ol", "li", "blockquote")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[a-zA-Z0-9_+#-]+$`)).OnElements("code")
+	policy.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+
+	policy.AllowAttrs("href").OnElements("a")
+	policy.AllowAttrs("rel").Matching(regexp.MustCompile(`^nofollow ugc$`)).OnElements("a")
+	policy.AllowURLSchemes("http", "https", "mailto")
+	policy.RequireParseableURLs(true)
+	return policy
+}
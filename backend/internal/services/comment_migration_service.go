@@ -0,0 +1,628 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Comment import and export formats
+const (
+	CommentFormatDisqus    = "disqus"    // Disqus XML export
+	CommentFormatWordPress = "wordpress" // WordPress eXtended RSS (WXR) export
+)
+
+// CommentMigrationService imports comments from Disqus and WordPress exports and exports ours in the Disqus format
+type CommentMigrationService struct {
+	db *gorm.DB
+}
+
+func NewCommentMigrationService(db *gorm.DB) *CommentMigrationService {
+	return &CommentMigrationService{db: db}
+}
+
+// importedThread groups the comments of one post in an import file
+type importedThread struct {
+	id       string
+	title    string
+	link     string
+	slugs    []string // Slugs that may identify the post, most specific first
+	comments []importedComment
+}
+
+// importedComment is a comment read from an import file
+type importedComment struct {
+	sourceID  string
+	parentID  string // Source ID of the parent comment, empty for top-level comments
+	name      string
+	email     string
+	content   string
+	ipAddress string
+	status    string
+	createdAt time.Time
+	skip      bool // Deleted, trashed or not a real comment
+}
+
+// DetectCommentFormat guesses the format of an import file from its root element
+func DetectCommentFormat(data []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", fmt.Errorf("invalid import file: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			switch start.Name.Local {
+			case "disqus":
+				return CommentFormatDisqus, nil
+			case "rss":
+				return CommentFormatWordPress, nil
+			default:
+				return "", fmt.Errorf("invalid import file: unknown root element <%s>", start.Name.Local)
+			}
+		}
+	}
+}
+
+// Import reads a Disqus or WordPress export and adds its comments to the matching posts.
+// Comments created by an earlier import are skipped, so importing the same file twice is safe.
+// With dryRun nothing is written and the report shows what would happen.
+func (s *CommentMigrationService) Import(format string, r io.Reader, dryRun bool) (*models.CommentImportReport, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read import file: %w", err)
+	}
+
+	if format == "" {
+		if format, err = DetectCommentFormat(data); err != nil {
+			return nil, err
+		}
+	}
+
+	var threads []importedThread
+	switch format {
+	case CommentFormatDisqus:
+		threads, err = parseDisqusExport(data)
+	case CommentFormatWordPress:
+		threads, err = parseWordPressExport(data)
+	default:
+		return nil, fmt.Errorf("invalid import format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	postIDs, err := s.postIDsBySlug()
+	if err != nil {
+		return nil, err
+	}
+
+	// Deleted comments count too, so comments removed after an earlier import stay removed
+	var existing []models.Comment
+	if err := s.db.Unscoped().Select("id", "import_id").
+		Where("import_id LIKE ?", format+":%").
+		Find(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch imported comments: %w", err)
+	}
+	commentIDs := make(map[string]uint, len(existing))
+	for _, comment := range existing {
+		commentIDs[comment.ImportID] = comment.ID
+	}
+
+	report := &models.CommentImportReport{
+		Format:    format,
+		DryRun:    dryRun,
+		Unmatched: []models.UnmatchedThread{},
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var parents []importedComment
+		for _, thread := range threads {
+			if len(thread.comments) == 0 {
+				continue
+			}
+			report.Threads++
+
+			postID, ok := matchThreadPost(thread, postIDs)
+			if !ok {
+				report.Unmatched = append(report.Unmatched, models.UnmatchedThread{
+					ID:       thread.id,
+					Title:    thread.title,
+					Link:     thread.link,
+					Comments: len(thread.comments),
+				})
+				continue
+			}
+
+			var comments []models.Comment
+			var sources []importedComment
+			for _, source := range thread.comments {
+				importID := format + ":" + source.sourceID
+				switch {
+				case source.skip:
+					report.Skipped++
+					continue
+				case commentIDs[importID] != 0:
+					report.Duplicates++
+					continue
+				}
+
+				comments = append(comments, models.Comment{
+					PostID:      postID,
+					Name:        source.name,
+					Email:       source.email,
+					Content:     source.content,
+					ContentHTML: RenderCommentMarkdown(source.content),
+					Status:      source.status,
+					IPAddress:   source.ipAddress,
+					ImportID:    importID,
+					CreatedAt:   source.createdAt,
+					UpdatedAt:   source.createdAt,
+				})
+				sources = append(sources, source)
+			}
+
+			report.Imported += len(comments)
+			if dryRun || len(comments) == 0 {
+				continue
+			}
+
+			if err := tx.CreateInBatches(&comments, 100).Error; err != nil {
+				return fmt.Errorf("failed to create comments: %w", err)
+			}
+			for i := range comments {
+				commentIDs[comments[i].ImportID] = comments[i].ID
+				if sources[i].parentID != "" {
+					parents = append(parents, sources[i])
+				}
+			}
+		}
+
+		// Link replies once every comment has an ID, as parents may come after their replies
+		for _, source := range parents {
+			id := commentIDs[format+":"+source.sourceID]
+			parentID, ok := commentIDs[format+":"+source.parentID]
+			if !ok {
+				continue
+			}
+			if err := tx.Model(&models.Comment{}).Where("id = ?", id).UpdateColumn("parent_id", parentID).Error; err != nil {
+				return fmt.Errorf("failed to link comment replies: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// ExportDisqus writes every comment in the Disqus XML export format.
+// baseURL is used for the thread links, which Disqus uses to find the posts.
+func (s *CommentMigrationService) ExportDisqus(w io.Writer, baseURL string) error {
+	var comments []models.Comment
+	if err := s.db.Preload("Post").Order("id ASC").Find(&comments).Error; err != nil {
+		return fmt.Errorf("failed to fetch comments: %w", err)
+	}
+
+	export := disqusExportXML{
+		Xmlns:    "http://disqus.com",
+		XmlnsDsq: "http://disqus.com/disqus-internals",
+		Category: disqusCategoryXML{DsqID: "1", Title: "General", IsDefault: true},
+	}
+
+	threads := make(map[uint]bool)
+	baseURL = strings.TrimRight(baseURL, "/")
+	for _, comment := range comments {
+		// Comments of deleted posts have nowhere to go
+		if comment.Post.ID == 0 {
+			continue
+		}
+
+		if !threads[comment.PostID] {
+			threads[comment.PostID] = true
+			export.Threads = append(export.Threads, disqusThreadXML{
+				DsqID:      fmt.Sprint(comment.PostID),
+				Identifier: comment.Post.Slug,
+				Link:       baseURL + "/posts/" + comment.Post.Slug,
+				Title:      comment.Post.Title,
+				CreatedAt:  comment.Post.CreatedAt.UTC().Format(time.RFC3339),
+				Category:   disqusRefXML{DsqID: "1"},
+			})
+		}
+
+		post := disqusPostXML{
+			DsqID:      fmt.Sprint(comment.ID),
+			Message:    disqusCDATA{Text: textToHTML(comment.Content)},
+			CreatedAt:  comment.CreatedAt.UTC().Format(time.RFC3339),
+			IsSpam:     comment.Status == "hidden",
+			IsApproved: comment.Status == "approved",
+			Author: disqusAuthorXML{
+				Name:        comment.Name,
+				Email:       comment.Email,
+				IsAnonymous: comment.Email == "",
+			},
+			IPAddress: comment.IPAddress,
+			Thread:    disqusRefXML{DsqID: fmt.Sprint(comment.PostID)},
+		}
+		if comment.ParentID != nil {
+			post.Parent = &disqusRefXML{DsqID: fmt.Sprint(*comment.ParentID)}
+		}
+		export.Posts = append(export.Posts, post)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// postIDsBySlug maps the lowercase slug of every post to its ID
+func (s *CommentMigrationService) postIDsBySlug() (map[string]uint, error) {
+	var posts []models.Post
+	if err := s.db.Select("id", "slug").Find(&posts).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch posts: %w", err)
+	}
+
+	postIDs := make(map[string]uint, len(posts))
+	for _, post := range posts {
+		postIDs[strings.ToLower(post.Slug)] = post.ID
+	}
+	return postIDs, nil
+}
+
+// matchThreadPost finds the post a thread belongs to by its slugs
+func matchThreadPost(thread importedThread, postIDs map[string]uint) (uint, bool) {
+	for _, slug := range thread.slugs {
+		if postID, ok := postIDs[strings.ToLower(slug)]; ok {
+			return postID, true
+		}
+	}
+	return 0, false
+}
+
+// slugFromLink extracts the post slug from a post URL such as https://example.com/posts/hello-world/
+func slugFromLink(link string) string {
+	parsed, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return ""
+	}
+
+	segments := strings.FieldsFunc(parsed.Path, func(r rune) bool { return r == '/' })
+	if len(segments) == 0 {
+		// WordPress links without pretty permalinks look like /?p=123
+		return ""
+	}
+
+	slug := segments[len(segments)-1]
+	for i, segment := range segments[:len(segments)-1] {
+		if segment == "posts" {
+			slug = segments[i+1]
+			break
+		}
+	}
+	slug = strings.TrimSuffix(strings.TrimSuffix(slug, ".html"), ".htm")
+
+	if unescaped, err := url.PathUnescape(slug); err == nil {
+		slug = unescaped
+	}
+	return slug
+}
+
+// Disqus export structures for reading. Field tags leave out namespaces so the dsq: prefix doesn't matter.
+type disqusExport struct {
+	Threads []disqusThread `xml:"thread"`
+	Posts   []disqusPost   `xml:"post"`
+}
+
+type disqusThread struct {
+	DsqID      string `xml:"id,attr"`
+	Identifier string `xml:"id"`
+	Link       string `xml:"link"`
+	Title      string `xml:"title"`
+}
+
+type disqusPost struct {
+	DsqID      string `xml:"id,attr"`
+	Message    string `xml:"message"`
+	CreatedAt  string `xml:"createdAt"`
+	IsDeleted  string `xml:"isDeleted"`
+	IsSpam     string `xml:"isSpam"`
+	IsApproved string `xml:"isApproved"` // Not in every export, approved when missing
+	Author     struct {
+		Name     string `xml:"name"`
+		Email    string `xml:"email"`
+		Username string `xml:"username"`
+	} `xml:"author"`
+	IPAddress string    `xml:"ipAddress"`
+	Thread    disqusRef `xml:"thread"`
+	Parent    disqusRef `xml:"parent"`
+}
+
+type disqusRef struct {
+	DsqID string `xml:"id,attr"`
+}
+
+// parseDisqusExport reads the threads and comments of a Disqus XML export
+func parseDisqusExport(data []byte) ([]importedThread, error) {
+	var export disqusExport
+	if err := xml.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid import file: %w", err)
+	}
+
+	threads := make([]importedThread, 0, len(export.Threads))
+	index := make(map[string]int, len(export.Threads))
+	for _, thread := range export.Threads {
+		imported := importedThread{
+			id:    thread.DsqID,
+			title: strings.TrimSpace(thread.Title),
+			link:  strings.TrimSpace(thread.Link),
+		}
+		// Identifiers are often the slug, but WordPress plugins use "123 https://..." instead
+		if identifier := strings.TrimSpace(thread.Identifier); identifier != "" && !strings.ContainsAny(identifier, " /") {
+			imported.slugs = append(imported.slugs, identifier)
+		}
+		if slug := slugFromLink(thread.Link); slug != "" {
+			imported.slugs = append(imported.slugs, slug)
+		}
+
+		index[thread.DsqID] = len(threads)
+		threads = append(threads, imported)
+	}
+
+	for _, post := range export.Posts {
+		i, ok := index[post.Thread.DsqID]
+		if !ok {
+			continue
+		}
+
+		comment := importedComment{
+			sourceID:  post.DsqID,
+			parentID:  post.Parent.DsqID,
+			name:      importedName(post.Author.Name, post.Author.Username),
+			email:     strings.TrimSpace(post.Author.Email),
+			content:   htmlToText(post.Message),
+			ipAddress: strings.TrimSpace(post.IPAddress),
+			status:    "approved",
+			createdAt: parseImportTime(time.RFC3339, post.CreatedAt),
+			skip:      xmlTrue(post.IsDeleted),
+		}
+		switch {
+		case xmlTrue(post.IsSpam):
+			comment.status = "hidden"
+		case post.IsApproved != "" && !xmlTrue(post.IsApproved):
+			comment.status = "pending"
+		}
+		if comment.content == "" {
+			comment.skip = true
+		}
+
+		threads[i].comments = append(threads[i].comments, comment)
+	}
+
+	return threads, nil
+}
+
+// WordPress WXR structures for reading. WXR versions use different wp: namespaces, so tags leave them out.
+type wordPressExport struct {
+	Items []wordPressItem `xml:"channel>item"`
+}
+
+type wordPressItem struct {
+	Title    string             `xml:"title"`
+	Link     string             `xml:"link"`
+	PostID   string             `xml:"post_id"`
+	PostName string             `xml:"post_name"`
+	Comments []wordPressComment `xml:"comment"`
+}
+
+type wordPressComment struct {
+	ID          string `xml:"comment_id"`
+	Author      string `xml:"comment_author"`
+	AuthorEmail string `xml:"comment_author_email"`
+	AuthorIP    string `xml:"comment_author_IP"`
+	Date        string `xml:"comment_date"`
+	DateGMT     string `xml:"comment_date_gmt"`
+	Content     string `xml:"comment_content"`
+	Approved    string `xml:"comment_approved"`
+	Type        string `xml:"comment_type"`
+	Parent      string `xml:"comment_parent"`
+}
+
+// wordPressTimeLayout is the date format of WXR files
+const wordPressTimeLayout = "2006-01-02 15:04:05"
+
+// parseWordPressExport reads the posts and comments of a WordPress WXR export
+func parseWordPressExport(data []byte) ([]importedThread, error) {
+	var export wordPressExport
+	if err := xml.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid import file: %w", err)
+	}
+
+	threads := make([]importedThread, 0, len(export.Items))
+	for _, item := range export.Items {
+		thread := importedThread{
+			id:    strings.TrimSpace(item.PostID),
+			title: strings.TrimSpace(item.Title),
+			link:  strings.TrimSpace(item.Link),
+		}
+		if name := strings.TrimSpace(item.PostName); name != "" {
+			if unescaped, err := url.PathUnescape(name); err == nil {
+				name = unescaped
+			}
+			thread.slugs = append(thread.slugs, name)
+		}
+		if slug := slugFromLink(item.Link); slug != "" {
+			thread.slugs = append(thread.slugs, slug)
+		}
+
+		for _, source := range item.Comments {
+			comment := importedComment{
+				sourceID:  strings.TrimSpace(source.ID),
+				name:      importedName(source.Author, ""),
+				email:     strings.TrimSpace(source.AuthorEmail),
+				content:   htmlToText(source.Content),
+				ipAddress: strings.TrimSpace(source.AuthorIP),
+				createdAt: parseImportTime(wordPressTimeLayout, source.DateGMT),
+			}
+			if comment.createdAt.IsZero() {
+				comment.createdAt = parseImportTime(wordPressTimeLayout, source.Date)
+			}
+			if parent := strings.TrimSpace(source.Parent); parent != "" && parent != "0" {
+				comment.parentID = parent
+			}
+
+			switch strings.TrimSpace(source.Approved) {
+			case "1":
+				comment.status = "approved"
+			case "0":
+				comment.status = "pending"
+			case "spam":
+				comment.status = "hidden"
+			default: // trash, post-trashed
+				comment.skip = true
+			}
+
+			// Pingbacks and trackbacks aren't comments from readers
+			if commentType := strings.TrimSpace(source.Type); commentType != "" && commentType != "comment" {
+				comment.skip = true
+			}
+			if comment.content == "" {
+				comment.skip = true
+			}
+
+			thread.comments = append(thread.comments, comment)
+		}
+
+		threads = append(threads, thread)
+	}
+
+	return threads, nil
+}
+
+// Disqus export structures for writing, with the dsq: prefix Disqus uses
+type disqusExportXML struct {
+	XMLName  xml.Name          `xml:"disqus"`
+	Xmlns    string            `xml:"xmlns,attr"`
+	XmlnsDsq string            `xml:"xmlns:dsq,attr"`
+	Category disqusCategoryXML `xml:"category"`
+	Threads  []disqusThreadXML `xml:"thread"`
+	Posts    []disqusPostXML   `xml:"post"`
+}
+
+type disqusCategoryXML struct {
+	DsqID     string `xml:"dsq:id,attr"`
+	Title     string `xml:"title"`
+	IsDefault bool   `xml:"isDefault"`
+}
+
+type disqusThreadXML struct {
+	DsqID      string       `xml:"dsq:id,attr"`
+	Identifier string       `xml:"id"`
+	Link       string       `xml:"link"`
+	Title      string       `xml:"title"`
+	CreatedAt  string       `xml:"createdAt"`
+	Category   disqusRefXML `xml:"category"`
+}
+
+type disqusPostXML struct {
+	DsqID      string          `xml:"dsq:id,attr"`
+	Message    disqusCDATA     `xml:"message"`
+	CreatedAt  string          `xml:"createdAt"`
+	IsDeleted  bool            `xml:"isDeleted"`
+	IsSpam     bool            `xml:"isSpam"`
+	IsApproved bool            `xml:"isApproved"`
+	Author     disqusAuthorXML `xml:"author"`
+	IPAddress  string          `xml:"ipAddress,omitempty"`
+	Thread     disqusRefXML    `xml:"thread"`
+	Parent     *disqusRefXML   `xml:"parent,omitempty"`
+}
+
+type disqusAuthorXML struct {
+	Name        string `xml:"name"`
+	Email       string `xml:"email,omitempty"`
+	IsAnonymous bool   `xml:"isAnonymous"`
+}
+
+type disqusRefXML struct {
+	DsqID string `xml:"dsq:id,attr"`
+}
+
+type disqusCDATA struct {
+	Text string `xml:",cdata"`
+}
+
+var (
+	htmlBreakRegex     = regexp.MustCompile(`(?i)<br\s*/?>|</li\s*>`)
+	htmlParagraphRegex = regexp.MustCompile(`(?i)</(p|div|blockquote)\s*>`)
+	htmlTagRegex       = regexp.MustCompile(`<[^>]*>`)
+	extraBreaksRegex   = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText turns the HTML of an imported comment into the plain text comments are stored as
+func htmlToText(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = htmlBreakRegex.ReplaceAllString(content, "\n")
+	content = htmlParagraphRegex.ReplaceAllString(content, "\n\n")
+	content = htmlTagRegex.ReplaceAllString(content, "")
+	content = html.UnescapeString(content)
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	content = strings.Join(lines, "\n")
+	return strings.TrimSpace(extraBreaksRegex.ReplaceAllString(content, "\n\n"))
+}
+
+// textToHTML turns a plain text comment into the HTML paragraphs Disqus messages are made of
+func textToHTML(content string) string {
+	paragraphs := strings.Split(strings.TrimSpace(content), "\n\n")
+	for i, paragraph := range paragraphs {
+		paragraphs[i] = "<p>" + strings.ReplaceAll(html.EscapeString(strings.TrimSpace(paragraph)), "\n", "<br>") + "</p>"
+	}
+	return strings.Join(paragraphs, "")
+}
+
+// importedName picks the display name of an imported comment
+func importedName(name, username string) string {
+	name = strings.TrimSpace(html.UnescapeString(name))
+	if name == "" {
+		name = strings.TrimSpace(username)
+	}
+	if name == "" {
+		return "Anonymous"
+	}
+	return truncateRunes(name, 100)
+}
+
+// parseImportTime parses a timestamp from an import file as UTC, zero when it can't be parsed
+func parseImportTime(layout, value string) time.Time {
+	parsed, err := time.Parse(layout, strings.TrimSpace(value))
+	if err != nil || parsed.Year() < 1970 {
+		return time.Time{}
+	}
+	return parsed.UTC()
+}
+
+// xmlTrue reports whether an XML boolean is true
+func xmlTrue(value string) bool {
+	value = strings.TrimSpace(value)
+	return strings.EqualFold(value, "true") || value == "1"
+}
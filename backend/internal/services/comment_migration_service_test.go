@@ -0,0 +1,281 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	return data
+}
+
+func newMigrationTestService(t *testing.T, slugs ...string) *CommentMigrationService {
+	t.Helper()
+	db := newCommentTestDB(t)
+	if err := db.AutoMigrate(&models.Post{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	for _, slug := range slugs {
+		if err := db.Create(&models.Post{Title: slug, Content: "content", Slug: slug}).Error; err != nil {
+			t.Fatalf("failed to create post: %v", err)
+		}
+	}
+	return NewCommentMigrationService(db)
+}
+
+func TestDetectCommentFormat(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+		valid            bool
+	}{
+		{"disqus", `<?xml version="1.0"?><!-- export --><disqus xmlns="http://disqus.com"></disqus>`, CommentFormatDisqus, true},
+		{"wordpress", `<?xml version="1.0"?><rss version="2.0"><channel/></rss>`, CommentFormatWordPress, true},
+		{"unknown root", `<feed></feed>`, "", false},
+		{"not XML", `{"comments": []}`, "", false},
+		{"empty", ``, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := DetectCommentFormat([]byte(test.data))
+			if got != test.want || (err == nil) != test.valid {
+				t.Errorf("DetectCommentFormat() = %q, %v, want %q", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestParseDisqusExport(t *testing.T) {
+	threads, err := parseDisqusExport(readFixture(t, "disqus-export.xml"))
+	if err != nil {
+		t.Fatalf("parseDisqusExport() error: %v", err)
+	}
+	if len(threads) != 4 {
+		t.Fatalf("got %d threads, want 4", len(threads))
+	}
+
+	wantThreads := []struct {
+		id, title string
+		slugs     []string
+		comments  int
+	}{
+		{"100", "Hello World", []string{"hello-world", "hello-world"}, 4},
+		// WordPress plugin identifiers aren't slugs, so only the link is used
+		{"200", "Second Post", []string{"second-post"}, 2},
+		{"300", "Gone Post", []string{"gone-post", "gone-post"}, 1},
+		{"400", "No Comments", []string{"no-comments", "no-comments"}, 0},
+	}
+	for i, want := range wantThreads {
+		thread := threads[i]
+		if thread.id != want.id || thread.title != want.title || !reflect.DeepEqual(thread.slugs, want.slugs) || len(thread.comments) != want.comments {
+			t.Errorf("thread %d = id %q, title %q, slugs %q, %d comments, want %+v", i, thread.id, thread.title, thread.slugs, len(thread.comments), want)
+		}
+	}
+
+	wantComments := []importedComment{
+		{sourceID: "11", parentID: "10", name: "Author", content: "Thanks, glad you liked it!", ipAddress: "192.0.2.2", status: "approved",
+			createdAt: time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)},
+		{sourceID: "10", name: "Reader", email: "reader@example.com", content: "Great post & welcome\nsecond line\n\nAnother paragraph",
+			ipAddress: "192.0.2.1", status: "approved", createdAt: time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)},
+		{sourceID: "12", name: "Spammer", content: "Buy cheap pills", status: "hidden", createdAt: time.Date(2020, 1, 3, 10, 0, 0, 0, time.UTC)},
+		{sourceID: "13", name: "Reader", content: "Deleted comment", status: "approved", createdAt: time.Date(2020, 1, 4, 10, 0, 0, 0, time.UTC), skip: true},
+		{sourceID: "20", name: "guest_42", content: "Waiting for review", status: "pending", createdAt: time.Date(2020, 5, 2, 10, 0, 0, 0, time.UTC)},
+		{sourceID: "21", name: "Empty", status: "approved", createdAt: time.Date(2020, 5, 3, 10, 0, 0, 0, time.UTC), skip: true},
+	}
+	got := append(append([]importedComment{}, threads[0].comments...), threads[1].comments...)
+	if !reflect.DeepEqual(got, wantComments) {
+		t.Errorf("comments =\n%+v\nwant\n%+v", got, wantComments)
+	}
+
+	if _, err := parseDisqusExport([]byte("<disqus><thread>")); err == nil {
+		t.Error("parseDisqusExport() of broken XML succeeded")
+	}
+}
+
+func TestParseWordPressExport(t *testing.T) {
+	threads, err := parseWordPressExport(readFixture(t, "wordpress-export.xml"))
+	if err != nil {
+		t.Fatalf("parseWordPressExport() error: %v", err)
+	}
+	if len(threads) != 3 {
+		t.Fatalf("got %d threads, want 3", len(threads))
+	}
+
+	wantThreads := []struct {
+		id, title string
+		slugs     []string
+		comments  int
+	}{
+		// Links without pretty permalinks carry no slug
+		{"7", "Hello World", []string{"hello-world"}, 6},
+		{"8", "Café Notes", []string{"café-notes", "café-notes"}, 1},
+		{"9", "About", []string{"about", "about"}, 0},
+	}
+	for i, want := range wantThreads {
+		thread := threads[i]
+		if thread.id != want.id || thread.title != want.title || !reflect.DeepEqual(thread.slugs, want.slugs) || len(thread.comments) != want.comments {
+			t.Errorf("thread %d = id %q, title %q, slugs %q, %d comments, want %+v", i, thread.id, thread.title, thread.slugs, len(thread.comments), want)
+		}
+	}
+
+	wantComments := []importedComment{
+		{sourceID: "102", parentID: "101", name: "Author", email: "author@example.com", content: "Thanks!", ipAddress: "192.0.2.2",
+			status: "approved", createdAt: time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)},
+		// Without a GMT date the local date is used
+		{sourceID: "101", name: "Reader & Friend", email: "reader@example.com", content: "Nice post.\nSecond line", ipAddress: "192.0.2.1",
+			status: "approved", createdAt: time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)},
+		{sourceID: "103", name: "Spammer", content: "Buy cheap pills", status: "hidden"},
+		{sourceID: "104", name: "Reader", content: "Trashed", skip: true},
+		{sourceID: "105", name: "Other Blog", content: "[...] linked here [...]", status: "approved", skip: true},
+		{sourceID: "106", name: "Anonymous", content: "Waiting", status: "pending"},
+	}
+	if !reflect.DeepEqual(threads[0].comments, wantComments) {
+		t.Errorf("comments =\n%+v\nwant\n%+v", threads[0].comments, wantComments)
+	}
+}
+
+func TestSlugFromLink(t *testing.T) {
+	tests := []struct {
+		link, want string
+	}{
+		{"https://example.com/posts/hello-world/", "hello-world"},
+		{"https://example.com/posts/hello-world/comment-page-2/", "hello-world"},
+		{"https://example.com/2020/05/hello-world", "hello-world"},
+		{"https://example.com/2020/05/hello-world.html", "hello-world"},
+		{"https://example.com/archive/hello-world.htm?utm_source=feed#comments", "hello-world"},
+		{"https://example.com/2020/05/caf%C3%A9-notes/", "café-notes"},
+		{"  https://example.com/hello-world  ", "hello-world"},
+		{"/posts/relative", "relative"},
+		{"https://example.com/?p=123", ""},
+		{"https://example.com", ""},
+		{"", ""},
+		{"://bad url", ""},
+	}
+	for _, test := range tests {
+		if got := slugFromLink(test.link); got != test.want {
+			t.Errorf("slugFromLink(%q) = %q, want %q", test.link, got, test.want)
+		}
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name, html, want string
+	}{
+		{"plain", "Just text", "Just text"},
+		{"paragraphs", "<p>One</p><p>Two</p>", "One\n\nTwo"},
+		{"line breaks", "One<br>Two<BR/>Three<br />Four", "One\nTwo\nThree\nFour"},
+		{"list items", "<ul><li>One</li><li>Two</li></ul>", "One\nTwo"},
+		{"blockquote and div", "<blockquote>Quote</blockquote><div>Answer</div>", "Quote\n\nAnswer"},
+		{"links and formatting", `See <a href="https://example.com">this <b>page</b></a>`, "See this page"},
+		{"entities", "Fish &amp; chips &lt;3 &quot;yum&quot; &#39;ok&#39;", `Fish & chips <3 "yum" 'ok'`},
+		{"escaped tags stay text", "&lt;script&gt;alert(1)&lt;/script&gt;", "<script>alert(1)</script>"},
+		{"windows line endings", "One\r\nTwo", "One\nTwo"},
+		{"extra blank lines", "<p>One</p>\n\n\n<p>Two</p>", "One\n\nTwo"},
+		{"indented lines", "  <p>  One  </p>  ", "One"},
+		{"only markup", "<p> </p><br>", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := htmlToText(test.html); got != test.want {
+				t.Errorf("htmlToText(%q) = %q, want %q", test.html, got, test.want)
+			}
+		})
+	}
+}
+
+func TestImportComments(t *testing.T) {
+	tests := []struct {
+		fixture, format  string
+		slugs            []string
+		want             models.CommentImportReport
+		reply, parent    string // Import IDs of a reply that comes before its parent in the file
+		unmatchedThreads []string
+	}{
+		{
+			fixture: "disqus-export.xml", format: CommentFormatDisqus,
+			slugs: []string{"hello-world", "second-post"},
+			want:  models.CommentImportReport{Format: CommentFormatDisqus, Threads: 3, Imported: 4, Skipped: 2},
+			reply: "disqus:11", parent: "disqus:10",
+			unmatchedThreads: []string{"300"},
+		},
+		{
+			fixture: "wordpress-export.xml", format: CommentFormatWordPress,
+			slugs: []string{"Hello-World"},
+			want:  models.CommentImportReport{Format: CommentFormatWordPress, Threads: 2, Imported: 4, Skipped: 2},
+			reply: "wordpress:102", parent: "wordpress:101",
+			unmatchedThreads: []string{"8"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			s := newMigrationTestService(t, test.slugs...)
+			data := readFixture(t, test.fixture)
+
+			// A dry run reports without writing
+			report, err := s.Import("", bytes.NewReader(data), true)
+			if err != nil {
+				t.Fatalf("Import() dry run error: %v", err)
+			}
+			if report.Imported != test.want.Imported || !report.DryRun {
+				t.Errorf("dry run report = %+v, want %d imported", report, test.want.Imported)
+			}
+			var count int64
+			s.db.Model(&models.Comment{}).Count(&count)
+			if count != 0 {
+				t.Fatalf("dry run created %d comments", count)
+			}
+
+			report, err = s.Import(test.format, bytes.NewReader(data), false)
+			if err != nil {
+				t.Fatalf("Import() error: %v", err)
+			}
+			unmatched := make([]string, len(report.Unmatched))
+			for i, thread := range report.Unmatched {
+				unmatched[i] = thread.ID
+			}
+			report.Unmatched = nil
+			if !reflect.DeepEqual(*report, test.want) || !reflect.DeepEqual(unmatched, test.unmatchedThreads) {
+				t.Errorf("report = %+v, unmatched %q, want %+v, unmatched %q", *report, unmatched, test.want, test.unmatchedThreads)
+			}
+
+			// Replies are linked to parents that come after them in the file
+			var reply, parent models.Comment
+			s.db.Where("import_id = ?", test.reply).First(&reply)
+			s.db.Where("import_id = ?", test.parent).First(&parent)
+			if parent.ID == 0 || reply.ParentID == nil || *reply.ParentID != parent.ID {
+				t.Errorf("reply has parent %v, want comment %d", reply.ParentID, parent.ID)
+			}
+			if parent.ContentHTML == "" || parent.CreatedAt.IsZero() {
+				t.Errorf("imported comment has HTML %q and time %v", parent.ContentHTML, parent.CreatedAt)
+			}
+
+			// Importing again creates nothing, even for comments deleted since
+			if err := s.db.Delete(&parent).Error; err != nil {
+				t.Fatal(err)
+			}
+			report, err = s.Import(test.format, bytes.NewReader(data), false)
+			if err != nil {
+				t.Fatalf("second Import() error: %v", err)
+			}
+			if report.Imported != 0 || report.Duplicates != test.want.Imported {
+				t.Errorf("second import = %d imported, %d duplicates, want 0 and %d", report.Imported, report.Duplicates, test.want.Imported)
+			}
+			s.db.Unscoped().Model(&models.Comment{}).Count(&count)
+			if count != int64(test.want.Imported) {
+				t.Errorf("%d comments after importing twice, want %d", count, test.want.Imported)
+			}
+		})
+	}
+}
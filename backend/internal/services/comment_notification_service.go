@@ -0,0 +1,272 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// moderationLinkTTL is how long the approve and hide links in notification emails work
+const moderationLinkTTL = 7 * 24 * time.Hour
+
+// Purposes of the signed links in notification emails
+const (
+	linkPurposeModerate    = "comment-moderate"
+	linkPurposeUnsubscribe = "comment-unsubscribe"
+)
+
+// CommentNotificationService emails the admin about new comments and commenters about replies
+type CommentNotificationService struct {
+	db            *gorm.DB
+	configService *ConfigService
+	mailService   *MailService
+	siteURL       string // Configured address of the blog for links in emails, no email is sent without it
+}
+
+// NewCommentNotificationService creates the service. siteURL comes from the BASE_URL setting rather than
+// from requests, whose Host header anyone can set, so links in emails can't point elsewhere.
+func NewCommentNotificationService(db *gorm.DB, configService *ConfigService, mailService *MailService, siteURL string) *CommentNotificationService {
+	return &CommentNotificationService{
+		db:            db,
+		configService: configService,
+		mailService:   mailService,
+		siteURL:       strings.TrimRight(strings.TrimSpace(siteURL), "/"),
+	}
+}
+
+// Enabled reports whether notification emails can be sent: email is configured and so is the site URL
+func (s *CommentNotificationService) Enabled() bool {
+	return s.siteURL != "" && s.mailService.IsConfigured()
+}
+
+// RepliesEnabled reports whether commenters may ask to be emailed about replies
+func (s *CommentNotificationService) RepliesEnabled() bool {
+	return s.configEnabled("notify_comment_replies") && s.Enabled()
+}
+
+// CommentCreated notifies about a comment that was just stored
+func (s *CommentNotificationService) CommentCreated(comment *models.Comment) {
+	if !s.Enabled() {
+		return
+	}
+
+	// Hidden comments are spam as far as the filters can tell, so they don't deserve an email
+	if !comment.IsAuthor && comment.Status != "hidden" && s.configEnabled("notify_new_comments") {
+		if err := s.notifyAdmin(comment); err != nil {
+			log.Printf("Warning: failed to queue new comment notification: %v", err)
+		}
+	}
+
+	if comment.Status == "approved" {
+		s.CommentApproved(comment)
+	}
+}
+
+// CommentApproved emails the author of the parent comment once a reply becomes visible
+func (s *CommentNotificationService) CommentApproved(comment *models.Comment) {
+	if comment.ParentID == nil || comment.ReplyNotified || !s.RepliesEnabled() {
+		return
+	}
+
+	var parent models.Comment
+	if err := s.db.First(&parent, *comment.ParentID).Error; err != nil {
+		return
+	}
+	if !parent.NotifyReplies || parent.Email == "" || strings.EqualFold(parent.Email, comment.Email) {
+		return
+	}
+
+	post, err := s.loadPost(comment.PostID)
+	if err != nil {
+		log.Printf("Warning: failed to load post for reply notification: %v", err)
+		return
+	}
+
+	blogName := s.blogName()
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s,\n\n", parent.Name)
+	fmt.Fprintf(&body, "%s replied to your comment on \"%s\":\n\n", comment.Name, post.Title)
+	body.WriteString(quoteText(comment.Content))
+	fmt.Fprintf(&body, "\n\nRead the conversation: %s/posts/%s#comment-%d\n", s.siteURL, post.Slug, comment.ID)
+	if unsubscribeURL, err := s.UnsubscribeURL(parent.ID); err == nil {
+		fmt.Fprintf(&body, "\nStop emails about replies: %s\n", unsubscribeURL)
+	}
+
+	subject := fmt.Sprintf("[%s] New reply to your comment on \"%s\"", blogName, post.Title)
+	if err := s.mailService.Enqueue(parent.Email, subject, body.String()); err != nil {
+		log.Printf("Warning: failed to queue reply notification: %v", err)
+		return
+	}
+
+	comment.ReplyNotified = true
+	s.db.Model(&models.Comment{}).Where("id = ?", comment.ID).UpdateColumn("reply_notified", true)
+}
+
+// ModerationURL returns a signed link that approves or hides a comment without logging in
+func (s *CommentNotificationService) ModerationURL(commentID uint, action string) (string, error) {
+	expires := strconv.FormatInt(time.Now().Add(moderationLinkTTL).Unix(), 10)
+	signature, err := s.configService.Sign(linkPurposeModerate, moderationPayload(commentID, action, expires))
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("action", action)
+	query.Set("expires", expires)
+	query.Set("sig", signature)
+	return fmt.Sprintf("%s/comments/%d/moderate?%s", s.siteURL, commentID, query.Encode()), nil
+}
+
+// VerifyModerationLink checks the signature and expiry of a moderation link
+func (s *CommentNotificationService) VerifyModerationLink(commentID uint, action, expires, signature string) bool {
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresUnix {
+		return false
+	}
+	return s.configService.VerifySignature(linkPurposeModerate, moderationPayload(commentID, action, expires), signature)
+}
+
+// UnsubscribeURL returns a signed link that stops reply notifications for a commenter
+func (s *CommentNotificationService) UnsubscribeURL(commentID uint) (string, error) {
+	signature, err := s.configService.Sign(linkPurposeUnsubscribe, strconv.FormatUint(uint64(commentID), 10))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/comments/%d/unsubscribe?sig=%s", s.siteURL, commentID, signature), nil
+}
+
+// Unsubscribe turns off reply notifications for every comment left with the same email address
+func (s *CommentNotificationService) Unsubscribe(commentID uint, signature string) error {
+	if !s.configService.VerifySignature(linkPurposeUnsubscribe, strconv.FormatUint(uint64(commentID), 10), signature) {
+		return errors.New("invalid unsubscribe link")
+	}
+
+	var comment models.Comment
+	if err := s.db.First(&comment, commentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("comment with ID %d not found", commentID)
+		}
+		return fmt.Errorf("failed to fetch comment: %w", err)
+	}
+
+	query := s.db.Model(&models.Comment{}).Where("id = ?", comment.ID)
+	if comment.Email != "" {
+		query = s.db.Model(&models.Comment{}).Where("LOWER(email) = LOWER(?)", comment.Email)
+	}
+	if err := query.UpdateColumn("notify_replies", false).Error; err != nil {
+		return fmt.Errorf("failed to unsubscribe: %w", err)
+	}
+	return nil
+}
+
+// notifyAdmin queues the new comment email with one-click moderation links
+func (s *CommentNotificationService) notifyAdmin(comment *models.Comment) error {
+	recipient := s.adminRecipient()
+	if recipient == "" {
+		return errors.New("no admin email address")
+	}
+
+	post, err := s.loadPost(comment.PostID)
+	if err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	author := comment.Name
+	if comment.Email != "" {
+		author += " <" + comment.Email + ">"
+	}
+	fmt.Fprintf(&body, "%s commented on \"%s\":\n\n", author, post.Title)
+	body.WriteString(quoteText(comment.Content))
+	body.WriteString("\n\n")
+	fmt.Fprintf(&body, "Status: %s\n", comment.Status)
+	if comment.SpamScore != nil {
+		fmt.Fprintf(&body, "Spam score: %.0f%%\n", *comment.SpamScore*100)
+	}
+	if comment.IPAddress != "" {
+		fmt.Fprintf(&body, "IP address: %s\n", comment.IPAddress)
+	}
+	fmt.Fprintf(&body, "Post: %s/posts/%s\n\n", s.siteURL, post.Slug)
+
+	for _, action := range []string{"approve", "hide"} {
+		if comment.Status == ModerationActionStatus(action) {
+			continue
+		}
+		link, err := s.ModerationURL(comment.ID, action)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&body, "%s: %s\n", strings.ToUpper(action[:1])+action[1:], link)
+	}
+	fmt.Fprintf(&body, "Manage comments: %s/admin/comments\n", s.siteURL)
+
+	subject := fmt.Sprintf("[%s] New comment on \"%s\"", s.blogName(), post.Title)
+	return s.mailService.Enqueue(recipient, subject, body.String())
+}
+
+// adminRecipient returns the configured notification address, or the first admin's email
+func (s *CommentNotificationService) adminRecipient() string {
+	if email, err := s.configService.GetConfig("notify_email"); err == nil && strings.TrimSpace(email) != "" {
+		return strings.TrimSpace(email)
+	}
+
+	var admin models.User
+	if err := s.db.Where("is_admin = ?", true).Order("id ASC").First(&admin).Error; err != nil {
+		return ""
+	}
+	return admin.Email
+}
+
+func (s *CommentNotificationService) loadPost(postID uint) (*models.Post, error) {
+	var post models.Post
+	if err := s.db.Unscoped().First(&post, postID).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch post: %w", err)
+	}
+	return &post, nil
+}
+
+func (s *CommentNotificationService) blogName() string {
+	blogName, err := s.configService.GetConfig("blog_name")
+	if err != nil || blogName == "" {
+		return "BlankoBlog"
+	}
+	return blogName
+}
+
+// configEnabled reports whether a boolean configuration value is switched on
+func (s *CommentNotificationService) configEnabled(key string) bool {
+	value, err := s.configService.GetConfig(key)
+	return err == nil && strings.EqualFold(strings.TrimSpace(value), "true")
+}
+
+// ModerationActionStatus maps a moderation link action to the comment status it sets, empty for unknown actions
+func ModerationActionStatus(action string) string {
+	switch action {
+	case "approve":
+		return "approved"
+	case "hide":
+		return "hidden"
+	default:
+		return ""
+	}
+}
+
+func moderationPayload(commentID uint, action, expires string) string {
+	return fmt.Sprintf("%d.%s.%s", commentID, action, expires)
+}
+
+// quoteText prefixes every line with "> " like an email reply
+func quoteText(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = "> " + strings.TrimRight(line, "\r")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+)
+
+func newNotificationTestService(t *testing.T, siteURL string) *CommentNotificationService {
+	t.Helper()
+	db := newCommentTestDB(t)
+	if err := db.AutoMigrate(&models.Config{}, &models.Post{}, &models.User{}, &models.MailOutbox{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	configService := NewConfigService(db)
+	err := configService.UpdateConfigs(map[string]string{
+		"smtp_host":              "localhost",
+		"smtp_from":              "blog@example.com",
+		"notify_email":           "admin@example.com",
+		"notify_new_comments":    "true",
+		"notify_comment_replies": "true",
+	})
+	if err != nil {
+		t.Fatalf("failed to update configs: %v", err)
+	}
+	if err := db.Create(&models.Post{ID: 1, Title: "Post", Content: "content", Slug: "post"}).Error; err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	return NewCommentNotificationService(db, configService, NewMailService(db, configService), siteURL)
+}
+
+func TestCommentNotificationLinksUseSiteURL(t *testing.T) {
+	s := newNotificationTestService(t, " https://blog.example.com/ ")
+	parent := models.Comment{PostID: 1, Name: "Reader", Email: "reader@example.com", Content: "first", Status: "approved", NotifyReplies: true}
+	s.db.Create(&parent)
+	reply := models.Comment{PostID: 1, ParentID: &parent.ID, Name: "Other", Content: "reply", Status: "approved"}
+	s.db.Create(&reply)
+
+	s.CommentCreated(&reply)
+
+	var messages []models.MailOutbox
+	s.db.Order("id").Find(&messages)
+	if len(messages) != 2 {
+		t.Fatalf("%d emails queued, want the admin notification and the reply notification", len(messages))
+	}
+	wantLinks := [][]string{
+		{"https://blog.example.com/posts/post\n", "https://blog.example.com/comments/2/moderate?", "https://blog.example.com/admin/comments"},
+		{"https://blog.example.com/posts/post#comment-2", "https://blog.example.com/comments/1/unsubscribe?sig="},
+	}
+	for i, message := range messages {
+		for _, link := range wantLinks[i] {
+			if !strings.Contains(message.Body, link) {
+				t.Errorf("email to %s doesn't link %q:\n%s", message.To, link, message.Body)
+			}
+		}
+	}
+}
+
+func TestCommentNotificationsNeedSiteURL(t *testing.T) {
+	s := newNotificationTestService(t, "")
+	if s.Enabled() || s.RepliesEnabled() {
+		t.Error("notifications enabled without a site URL")
+	}
+
+	parent := models.Comment{PostID: 1, Name: "Reader", Email: "reader@example.com", Content: "first", Status: "approved", NotifyReplies: true}
+	s.db.Create(&parent)
+	reply := models.Comment{PostID: 1, ParentID: &parent.ID, Name: "Other", Content: "reply", Status: "approved"}
+	s.db.Create(&reply)
+	s.CommentCreated(&reply)
+	s.CommentApproved(&reply)
+
+	var queued int64
+	s.db.Model(&models.MailOutbox{}).Count(&queued)
+	if queued != 0 {
+		t.Errorf("%d emails queued without a site URL, want 0", queued)
+	}
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Comment rule actions, in increasing order of precedence
+const (
+	RuleActionApprove = "approve"
+	RuleActionHide    = "hide"
+	RuleActionReject  = "reject"
+)
+
+// GuardReasonRule is recorded when a reject rule blocks a submission
+const GuardReasonRule = "rule"
+
+// ruleActionPrecedence decides between several matching rules: rejecting beats hiding beats approving
+var ruleActionPrecedence = map[string]int{
+	RuleActionApprove: 1,
+	RuleActionHide:    2,
+	RuleActionReject:  3,
+}
+
+// CommentRuleService manages the comment blocklists and allowlists and applies them to new comments
+type CommentRuleService struct {
+	db *gorm.DB
+}
+
+func NewCommentRuleService(db *gorm.DB) *CommentRuleService {
+	return &CommentRuleService{db: db}
+}
+
+// GetRules retrieves all rules, oldest first
+func (s *CommentRuleService) GetRules() ([]models.CommentRule, error) {
+	var rules []models.CommentRule
+	if err := s.db.Order("id ASC").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch comment rules: %w", err)
+	}
+	return rules, nil
+}
+
+// GetRuleByID retrieves a rule by its ID
+func (s *CommentRuleService) GetRuleByID(id uint) (*models.CommentRule, error) {
+	var rule models.CommentRule
+	if err := s.db.First(&rule, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("comment rule with ID %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to fetch comment rule: %w", err)
+	}
+	return &rule, nil
+}
+
+// CreateRule validates and stores a new rule
+func (s *CommentRuleService) CreateRule(req models.CreateCommentRuleRequest) (*models.CommentRule, error) {
+	rule := models.CommentRule{
+		Field:       req.Field,
+		MatchType:   req.MatchType,
+		Pattern:     strings.TrimSpace(req.Pattern),
+		Action:      req.Action,
+		Description: strings.TrimSpace(req.Description),
+		Enabled:     req.Enabled == nil || *req.Enabled,
+	}
+
+	if err := validateRule(&rule); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(&rule).Error; err != nil {
+		return nil, fmt.Errorf("failed to create comment rule: %w", err)
+	}
+	return &rule, nil
+}
+
+// UpdateRule applies the given changes to a rule
+func (s *CommentRuleService) UpdateRule(id uint, req models.UpdateCommentRuleRequest) (*models.CommentRule, error) {
+	rule, err := s.GetRuleByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Field != nil {
+		rule.Field = *req.Field
+	}
+	if req.MatchType != nil {
+		rule.MatchType = *req.MatchType
+	}
+	if req.Pattern != nil {
+		rule.Pattern = strings.TrimSpace(*req.Pattern)
+	}
+	if req.Action != nil {
+		rule.Action = *req.Action
+	}
+	if req.Description != nil {
+		rule.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if req.ResetHits {
+		rule.HitCount = 0
+		rule.LastHitAt = nil
+	}
+
+	if err := validateRule(rule); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(rule).Error; err != nil {
+		return nil, fmt.Errorf("failed to update comment rule: %w", err)
+	}
+	return rule, nil
+}
+
+// DeleteRule removes a rule
+func (s *CommentRuleService) DeleteRule(id uint) error {
+	result := s.db.Delete(&models.CommentRule{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete comment rule: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("comment rule with ID %d not found", id)
+	}
+
+	return nil
+}
+
+// Match returns the enabled rule that decides what happens to a new comment, nil when none matches.
+// Every matching rule has its hit counter increased.
+func (s *CommentRuleService) Match(comment *models.Comment) (*models.CommentRule, error) {
+	var rules []models.CommentRule
+	if err := s.db.Where("enabled = ?", true).Order("id ASC").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch comment rules: %w", err)
+	}
+
+	var decisive *models.CommentRule
+	var matchedIDs []uint
+	for i := range rules {
+		rule := &rules[i]
+		if !s.matches(rule, comment) {
+			continue
+		}
+
+		matchedIDs = append(matchedIDs, rule.ID)
+		if decisive == nil || ruleActionPrecedence[rule.Action] > ruleActionPrecedence[decisive.Action] {
+			decisive = rule
+		}
+	}
+
+	if len(matchedIDs) > 0 {
+		// UpdateColumns keeps updated_at for edits made by admins
+		err := s.db.Model(&models.CommentRule{}).Where("id IN ?", matchedIDs).UpdateColumns(map[string]interface{}{
+			"hit_count":   gorm.Expr("hit_count + 1"),
+			"last_hit_at": time.Now(),
+		}).Error
+		if err != nil {
+			log.Printf("Warning: failed to update comment rule hit counters: %v", err)
+		}
+	}
+
+	return decisive, nil
+}
+
+// matches reports whether a rule applies to a comment
+func (s *CommentRuleService) matches(rule *models.CommentRule, comment *models.Comment) bool {
+	value := ruleFieldValue(rule.Field, comment)
+
+	switch rule.MatchType {
+	case "exact":
+		if rule.Field == "ip" {
+			ip, pattern := net.ParseIP(value), net.ParseIP(rule.Pattern)
+			if ip != nil && pattern != nil {
+				return ip.Equal(pattern)
+			}
+		}
+		// An email pattern starting with @ matches every address at that domain
+		if rule.Field == "email" && strings.HasPrefix(rule.Pattern, "@") {
+			return value != "" && strings.HasSuffix(strings.ToLower(value), strings.ToLower(rule.Pattern))
+		}
+		return value != "" && strings.EqualFold(value, rule.Pattern)
+	case "cidr":
+		_, network, err := net.ParseCIDR(rule.Pattern)
+		ip := net.ParseIP(value)
+		return err == nil && ip != nil && network.Contains(ip)
+	case "substring":
+		return value != "" && strings.Contains(strings.ToLower(value), strings.ToLower(rule.Pattern))
+	case "regex":
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return false
+		}
+		return re.MatchString(value)
+	case "trusted":
+		return s.isTrustedEmail(comment.Email)
+	default:
+		return false
+	}
+}
+
+// isTrustedEmail reports whether a reader with this email already has an approved comment
+func (s *CommentRuleService) isTrustedEmail(email string) bool {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return false
+	}
+
+	var count int64
+	err := s.db.Model(&models.Comment{}).
+		Where("LOWER(email) = LOWER(?) AND status = ? AND is_author = ?", email, "approved", false).
+		Count(&count).Error
+	return err == nil && count > 0
+}
+
+// ruleFieldValue returns the comment field a rule looks at
+func ruleFieldValue(field string, comment *models.Comment) string {
+	switch field {
+	case "ip":
+		return comment.IPAddress
+	case "email":
+		return comment.Email
+	case "name":
+		return comment.Name
+	case "content":
+		return comment.Content
+	case "referer":
+		return comment.Referer
+	default:
+		return ""
+	}
+}
+
+// validateRule checks that a rule's pattern makes sense for its field and match type
+func validateRule(rule *models.CommentRule) error {
+	if _, ok := ruleActionPrecedence[rule.Action]; !ok {
+		return fmt.Errorf("invalid rule action: %s", rule.Action)
+	}
+
+	switch rule.MatchType {
+	case "trusted":
+		if rule.Field != "email" {
+			return errors.New("invalid rule: trusted rules apply to the email field")
+		}
+		if rule.Action != RuleActionApprove {
+			return errors.New("invalid rule: trusted rules can only approve")
+		}
+		return nil
+	case "cidr":
+		if rule.Field != "ip" {
+			return errors.New("invalid rule: cidr rules apply to the ip field")
+		}
+		if _, _, err := net.ParseCIDR(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid rule: %q is not a CIDR range", rule.Pattern)
+		}
+	case "regex":
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid rule: bad regular expression: %v", err)
+		}
+	case "exact", "substring":
+	default:
+		return fmt.Errorf("invalid rule match type: %s", rule.MatchType)
+	}
+
+	if rule.Pattern == "" {
+		return errors.New("invalid rule: pattern is required")
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+)
+
+func newRuleTestService(t *testing.T) *CommentRuleService {
+	t.Helper()
+	db := newCommentTestDB(t)
+	if err := db.AutoMigrate(&models.CommentRule{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return NewCommentRuleService(db)
+}
+
+func TestCommentRuleMatches(t *testing.T) {
+	s := newRuleTestService(t)
+	trusted := models.Comment{PostID: 1, Name: "Regular", Email: "Regular@Example.com", Content: "hi", Status: "approved"}
+	author := models.Comment{PostID: 1, Name: "Admin", Email: "admin@example.com", Content: "hi", Status: "approved", IsAuthor: true}
+	pending := models.Comment{PostID: 1, Name: "New", Email: "new@example.com", Content: "hi", Status: "pending"}
+	for _, comment := range []*models.Comment{&trusted, &author, &pending} {
+		if err := s.db.Create(comment).Error; err != nil {
+			t.Fatalf("failed to create comment: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name                      string
+		field, matchType, pattern string
+		comment                   models.Comment
+		want                      bool
+	}{
+		{"exact ip", "ip", "exact", "192.0.2.1", models.Comment{IPAddress: "192.0.2.1"}, true},
+		{"exact ip differs", "ip", "exact", "192.0.2.1", models.Comment{IPAddress: "192.0.2.10"}, false},
+		{"exact ip against IPv4-mapped address", "ip", "exact", "192.0.2.1", models.Comment{IPAddress: "::ffff:192.0.2.1"}, true},
+		{"exact IPv4-mapped pattern", "ip", "exact", "::ffff:192.0.2.1", models.Comment{IPAddress: "192.0.2.1"}, true},
+		{"exact IPv6 in another notation", "ip", "exact", "2001:db8::1", models.Comment{IPAddress: "2001:0db8:0:0:0:0:0:1"}, true},
+		{"exact email ignores case", "email", "exact", "Spam@Example.com", models.Comment{Email: "spam@example.COM"}, true},
+		{"email domain", "email", "exact", "@example.com", models.Comment{Email: "anyone@Example.com"}, true},
+		{"email domain needs the whole domain", "email", "exact", "@example.com", models.Comment{Email: "anyone@notexample.com"}, false},
+		{"email domain skips subdomains", "email", "exact", "@example.com", models.Comment{Email: "anyone@mail.example.com"}, false},
+		{"email domain without email", "email", "exact", "@example.com", models.Comment{}, false},
+		{"empty field never matches exact", "name", "exact", "", models.Comment{}, false},
+		{"cidr", "ip", "cidr", "192.0.2.0/24", models.Comment{IPAddress: "192.0.2.200"}, true},
+		{"cidr outside", "ip", "cidr", "192.0.2.0/24", models.Comment{IPAddress: "198.51.100.1"}, false},
+		{"cidr with IPv4-mapped address", "ip", "cidr", "192.0.2.0/24", models.Comment{IPAddress: "::ffff:192.0.2.7"}, true},
+		{"cidr IPv6", "ip", "cidr", "2001:db8::/32", models.Comment{IPAddress: "2001:db8:1::5"}, true},
+		{"cidr with invalid address", "ip", "cidr", "192.0.2.0/24", models.Comment{IPAddress: "unknown"}, false},
+		{"cidr with invalid range", "ip", "cidr", "192.0.2.0/99", models.Comment{IPAddress: "192.0.2.1"}, false},
+		{"substring ignores case", "content", "substring", "casino", models.Comment{Content: "Best CASINO bonus"}, true},
+		{"substring in another field", "name", "substring", "casino", models.Comment{Content: "casino"}, false},
+		{"referer substring", "referer", "substring", "spam.test", models.Comment{Referer: "https://spam.test/page"}, true},
+		{"regex", "content", "regex", `(?i)\bviagra\b`, models.Comment{Content: "Cheap Viagra here"}, true},
+		{"regex without match", "content", "regex", `^\d+$`, models.Comment{Content: "12a"}, false},
+		{"invalid regex", "content", "regex", `(unclosed`, models.Comment{Content: "(unclosed"}, false},
+		{"trusted reader", "email", "trusted", "", models.Comment{Email: "regular@example.com"}, true},
+		{"trusted ignores surrounding space", "email", "trusted", "", models.Comment{Email: " regular@example.com "}, true},
+		{"author replies don't make readers trusted", "email", "trusted", "", models.Comment{Email: "admin@example.com"}, false},
+		{"pending comments don't make readers trusted", "email", "trusted", "", models.Comment{Email: "new@example.com"}, false},
+		{"trusted without email", "email", "trusted", "", models.Comment{}, false},
+		{"unknown match type", "content", "glob", "*", models.Comment{Content: "anything"}, false},
+		{"unknown field", "website", "substring", "a", models.Comment{Content: "a"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule := models.CommentRule{Field: test.field, MatchType: test.matchType, Pattern: test.pattern}
+			if got := s.matches(&rule, &test.comment); got != test.want {
+				t.Errorf("matches() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateRule(t *testing.T) {
+	tests := []struct {
+		name                              string
+		field, matchType, pattern, action string
+		valid                             bool
+	}{
+		{"exact", "ip", "exact", "192.0.2.1", RuleActionReject, true},
+		{"email domain", "email", "exact", "@example.com", RuleActionHide, true},
+		{"substring", "content", "substring", "casino", RuleActionHide, true},
+		{"regex", "content", "regex", `\bviagra\b`, RuleActionReject, true},
+		{"cidr", "ip", "cidr", "192.0.2.0/24", RuleActionReject, true},
+		{"trusted", "email", "trusted", "", RuleActionApprove, true},
+		{"unknown action", "ip", "exact", "192.0.2.1", "delete", false},
+		{"unknown match type", "ip", "glob", "192.0.2.*", RuleActionReject, false},
+		{"missing pattern", "content", "substring", "", RuleActionHide, false},
+		{"invalid regex", "content", "regex", `(unclosed`, RuleActionReject, false},
+		{"cidr on another field", "email", "cidr", "192.0.2.0/24", RuleActionReject, false},
+		{"invalid cidr", "ip", "cidr", "192.0.2.1", RuleActionReject, false},
+		{"trusted on another field", "name", "trusted", "", RuleActionApprove, false},
+		{"trusted that hides", "email", "trusted", "", RuleActionHide, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule := models.CommentRule{Field: test.field, MatchType: test.matchType, Pattern: test.pattern, Action: test.action}
+			if err := validateRule(&rule); (err == nil) != test.valid {
+				t.Errorf("validateRule() = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestCommentRuleMatchPrecedence(t *testing.T) {
+	type rule struct {
+		action  string
+		enabled bool
+	}
+	tests := []struct {
+		name  string
+		rules []rule
+		want  string
+	}{
+		{"no rules", nil, ""},
+		{"single", []rule{{RuleActionHide, true}}, RuleActionHide},
+		{"hide beats approve", []rule{{RuleActionApprove, true}, {RuleActionHide, true}}, RuleActionHide},
+		{"reject beats hide", []rule{{RuleActionReject, true}, {RuleActionHide, true}}, RuleActionReject},
+		{"reject beats everything", []rule{{RuleActionApprove, true}, {RuleActionReject, true}, {RuleActionHide, true}}, RuleActionReject},
+		{"disabled rules are skipped", []rule{{RuleActionApprove, true}, {RuleActionReject, false}}, RuleActionApprove},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newRuleTestService(t)
+			for _, r := range test.rules {
+				created := models.CommentRule{Field: "content", MatchType: "substring", Pattern: "spam", Action: r.action, Enabled: r.enabled}
+				if err := s.db.Create(&created).Error; err != nil {
+					t.Fatalf("failed to create rule: %v", err)
+				}
+			}
+			// A rule that doesn't match never decides
+			s.db.Create(&models.CommentRule{Field: "content", MatchType: "substring", Pattern: "other", Action: RuleActionReject, Enabled: true})
+
+			decisive, err := s.Match(&models.Comment{Content: "some spam"})
+			if err != nil {
+				t.Fatalf("Match() error: %v", err)
+			}
+			got := ""
+			if decisive != nil {
+				got = decisive.Action
+			}
+			if got != test.want {
+				t.Errorf("Match() decided %q, want %q", got, test.want)
+			}
+
+			// Every enabled matching rule counts a hit
+			var rules []models.CommentRule
+			s.db.Order("id").Find(&rules)
+			for _, stored := range rules {
+				wantHits := int64(0)
+				if stored.Enabled && stored.Pattern == "spam" {
+					wantHits = 1
+				}
+				if stored.HitCount != wantHits || (wantHits > 0) != (stored.LastHitAt != nil) {
+					t.Errorf("rule %d (%s) has %d hits, last at %v, want %d", stored.ID, stored.Action, stored.HitCount, stored.LastHitAt, wantHits)
+				}
+			}
+		})
+	}
+}
@@ -3,17 +3,27 @@ package services
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/bytetopia/BlankoBlog/backend/internal/models"
 	"gorm.io/gorm"
 )
 
+// bulkCommentLimit caps how many comments one bulk action may touch
+const bulkCommentLimit = 5000
+
 type CommentService struct {
-	db *gorm.DB
+	db         *gorm.DB
+	classifier *SpamClassifier
+	notifier   *CommentNotificationService
 }
 
-func NewCommentService(db *gorm.DB) *CommentService {
-	return &CommentService{db: db}
+func NewCommentService(db *gorm.DB, classifier *SpamClassifier, notifier *CommentNotificationService) *CommentService {
+	return &CommentService{
+		db:         db,
+		classifier: classifier,
+		notifier:   notifier,
+	}
 }
 
 // GetAllCommentsForAdmin retrieves all comments for admin management with post titles
@@ -42,10 +52,20 @@ func (s *CommentService) GetAllCommentsForAdmin(page, limit int, status string)
 		Find(&comments).Error; err != nil {
 		return nil, 0, fmt.Errorf("failed to fetch comments: %w", err)
 	}
-
 	return comments, totalCount, nil
 }
 
+// GetApprovedComments retrieves the visible comments of a post, oldest first
+func (s *CommentService) GetApprovedComments(postID uint) ([]models.Comment, error) {
+	var comments []models.Comment
+	if err := s.db.Where("post_id = ? AND status = ?", postID, "approved").
+		Order("created_at ASC").
+		Find(&comments).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch comments: %w", err)
+	}
+	return comments, nil
+}
+
 // GetCommentByID retrieves a comment by its ID (admin access)
 func (s *CommentService) GetCommentByID(id uint) (*models.Comment, error) {
 	var comment models.Comment
@@ -58,7 +78,30 @@ func (s *CommentService) GetCommentByID(id uint) (*models.Comment, error) {
 	return &comment, nil
 }
 
-// UpdateCommentStatus updates the status of a comment
+// BackfillContentHTML renders the HTML of comments stored without it, as before Markdown support.
+// It runs at startup and only touches comments that still need it, in batches.
+func (s *CommentService) BackfillContentHTML() (int, error) {
+	var comments []models.Comment
+	rendered := 0
+	err := s.db.Unscoped().Select("id", "content").
+		Where("content_html = '' OR content_html IS NULL").
+		FindInBatches(&comments, 200, func(tx *gorm.DB, batch int) error {
+			for _, comment := range comments {
+				html := RenderCommentMarkdown(comment.Content)
+				if err := s.db.Unscoped().Model(&models.Comment{}).Where("id = ?", comment.ID).UpdateColumn("content_html", html).Error; err != nil {
+					return err
+				}
+				rendered++
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return rendered, fmt.Errorf("failed to render comment HTML: %w", err)
+	}
+	return rendered, nil
+}
+
+// UpdateCommentStatus updates the status of a comment and trains the spam classifier on the decision
 func (s *CommentService) UpdateCommentStatus(id uint, status string) error {
 	// Validate status
 	validStatuses := map[string]bool{
@@ -71,32 +114,235 @@ func (s *CommentService) UpdateCommentStatus(id uint, status string) error {
 		return fmt.Errorf("invalid status: %s", status)
 	}
 
-	result := s.db.Model(&models.Comment{}).Where("id = ?", id).Update("status", status)
-	if result.Error != nil {
-		return fmt.Errorf("failed to update comment status: %w", result.Error)
+	var comment models.Comment
+	if err := s.db.First(&comment, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("comment with ID %d not found", id)
+		}
+		return fmt.Errorf("failed to fetch comment: %w", err)
 	}
 
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("comment with ID %d not found", id)
+	if err := s.db.Model(&comment).Update("status", status).Error; err != nil {
+		return fmt.Errorf("failed to update comment status: %w", err)
+	}
+
+	s.classifier.LearnStatus(&comment, status)
+
+	if status == "approved" {
+		comment.Status = status
+		s.notifier.CommentApproved(&comment)
 	}
 
 	return nil
 }
 
-// DeleteComment soft deletes a comment
-func (s *CommentService) DeleteComment(id uint) error {
-	result := s.db.Delete(&models.Comment{}, id)
-	if result.Error != nil {
-		return fmt.Errorf("failed to delete comment: %w", result.Error)
+// CreateAdminReply posts an approved reply from the blog author to an existing comment.
+// Replying to a pending comment approves it, so the conversation is visible together.
+func (s *CommentService) CreateAdminReply(parentID uint, author *models.User, content string) (*models.Comment, error) {
+	parent, err := s.GetCommentByID(parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if parent.Status == "hidden" {
+		return nil, fmt.Errorf("cannot reply to a hidden comment")
+	}
+
+	reply := models.Comment{
+		PostID:      parent.PostID,
+		ParentID:    &parent.ID,
+		IsAuthor:    true,
+		Name:        author.Username,
+		Email:       author.Email,
+		Content:     content,
+		ContentHTML: RenderCommentMarkdown(content),
+		Status:      "approved",
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if parent.Status == "pending" {
+			if err := tx.Model(&models.Comment{}).Where("id = ?", parent.ID).Update("status", "approved").Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&reply).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reply: %w", err)
+	}
+
+	// Replying approves the parent, which is a moderation decision like any other
+	if parent.Status == "pending" {
+		s.classifier.LearnStatus(parent, "approved")
+		parent.Status = "approved"
+		s.notifier.CommentApproved(parent)
 	}
+	s.notifier.CommentApproved(&reply)
 
-	if result.RowsAffected == 0 {
+	return s.GetCommentByID(reply.ID)
+}
+
+// DeleteComment soft deletes a comment. Deleted comments are unlearned by the spam classifier,
+// as they are left out when it is retrained.
+func (s *CommentService) DeleteComment(id uint) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var comment models.Comment
+		if err := tx.First(&comment, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&comment).Error; err != nil {
+			return err
+		}
+		return s.classifier.LearnComments(tx, []*models.Comment{&comment}, "")
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return fmt.Errorf("comment with ID %d not found", id)
 	}
+	if err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
 
 	return nil
 }
 
+// BulkModerate approves, hides or deletes the comments picked by ID or filter in a single transaction.
+// In a dry run nothing is changed and the response previews the outcome.
+func (s *CommentService) BulkModerate(req models.BulkCommentRequest) (*models.BulkCommentResponse, error) {
+	comments, err := s.selectBulkComments(req)
+	if err != nil {
+		return nil, err
+	}
+
+	status := map[string]string{"approve": "approved", "hide": "hidden"}[req.Action]
+	response := &models.BulkCommentResponse{
+		Action:  req.Action,
+		DryRun:  req.DryRun,
+		Matched: len(comments),
+		Results: make([]models.BulkCommentResult, 0, len(req.IDs)+len(comments)),
+	}
+
+	found := make(map[uint]bool, len(comments))
+	var changed []*models.Comment
+	for i := range comments {
+		comment := &comments[i]
+		found[comment.ID] = true
+
+		result := models.BulkCommentResult{ID: comment.ID, Result: "unchanged"}
+		switch {
+		case req.Action == "delete":
+			result.Result = "deleted"
+			changed = append(changed, comment)
+		case comment.Status != status:
+			result.Result = "updated"
+			changed = append(changed, comment)
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	for _, id := range req.IDs {
+		if !found[id] {
+			found[id] = true
+			response.Results = append(response.Results, models.BulkCommentResult{ID: id, Result: "not_found"})
+		}
+	}
+
+	response.Affected = len(changed)
+	if req.DryRun || len(changed) == 0 {
+		return response, nil
+	}
+
+	ids := make([]uint, len(changed))
+	for i, comment := range changed {
+		ids[i] = comment.ID
+	}
+
+	// Bulk decisions teach the classifier just like single ones, and deleted comments are unlearned
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if req.Action == "delete" {
+			if err := tx.Where("id IN ?", ids).Delete(&models.Comment{}).Error; err != nil {
+				return err
+			}
+			return s.classifier.LearnComments(tx, changed, "")
+		}
+		if err := tx.Model(&models.Comment{}).Where("id IN ?", ids).Update("status", status).Error; err != nil {
+			return err
+		}
+		return s.classifier.LearnComments(tx, changed, LabelForStatus(status))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply bulk %s: %w", req.Action, err)
+	}
+
+	if status == "approved" {
+		for _, comment := range changed {
+			comment.Status = status
+			s.notifier.CommentApproved(comment)
+		}
+	}
+
+	return response, nil
+}
+
+// selectBulkComments loads the comments a bulk request applies to
+func (s *CommentService) selectBulkComments(req models.BulkCommentRequest) ([]models.Comment, error) {
+	query := s.db.Model(&models.Comment{})
+
+	switch {
+	case len(req.IDs) > 0 && req.Filter != nil:
+		return nil, errors.New("invalid bulk request: give either ids or a filter, not both")
+	case len(req.IDs) > 0:
+		query = query.Where("id IN ?", req.IDs)
+	case req.Filter != nil:
+		filter := req.Filter
+		empty := true
+		if filter.Status != "" {
+			query = query.Where("status = ?", filter.Status)
+			empty = false
+		}
+		if filter.PostID != 0 {
+			query = query.Where("post_id = ?", filter.PostID)
+			empty = false
+		}
+		if filter.IPAddress != "" {
+			query = query.Where("ip_address = ?", strings.TrimSpace(filter.IPAddress))
+			empty = false
+		}
+		if filter.From != nil {
+			query = query.Where("created_at >= ?", *filter.From)
+			empty = false
+		}
+		if filter.To != nil {
+			query = query.Where("created_at < ?", *filter.To)
+			empty = false
+		}
+		if text := strings.TrimSpace(filter.Text); text != "" {
+			pattern := "%" + strings.ToLower(text) + "%"
+			query = query.Where("LOWER(name) LIKE ? OR LOWER(email) LIKE ? OR LOWER(content) LIKE ?", pattern, pattern, pattern)
+			empty = false
+		}
+		// An empty filter would match every comment, which is never what a moderator means
+		if empty {
+			return nil, errors.New("invalid bulk request: the filter needs at least one criterion")
+		}
+	default:
+		return nil, errors.New("invalid bulk request: ids or a filter is required")
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to count comments: %w", err)
+	}
+	if count > bulkCommentLimit {
+		return nil, fmt.Errorf("invalid bulk request: %d comments match, more than the limit of %d", count, bulkCommentLimit)
+	}
+
+	var comments []models.Comment
+	if err := query.Order("id ASC").Find(&comments).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch comments: %w", err)
+	}
+	return comments, nil
+}
+
 // GetCommentStats returns statistics about comments
 func (s *CommentService) GetCommentStats() (map[string]int64, error) {
 	stats := make(map[string]int64)
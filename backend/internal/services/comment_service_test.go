@@ -0,0 +1,82 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newCommentTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Comment{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+func TestBackfillContentHTML(t *testing.T) {
+	db := newCommentTestDB(t)
+	service := NewCommentService(db, nil, nil)
+
+	comments := []models.Comment{
+		{PostID: 1, Name: "Reader", Content: "**old**", Status: "approved"},
+		{PostID: 1, Name: "Reader", Content: "kept", Status: "approved", ContentHTML: "<p>cached</p>"},
+		{PostID: 1, Name: "Reader", Content: "*deleted*", Status: "hidden"},
+	}
+	if err := db.Create(&comments).Error; err != nil {
+		t.Fatalf("failed to create comments: %v", err)
+	}
+	if err := db.Delete(&comments[2]).Error; err != nil {
+		t.Fatalf("failed to delete comment: %v", err)
+	}
+
+	// Reading comments leaves missing HTML to the backfill
+	if _, err := service.GetApprovedComments(1); err != nil {
+		t.Fatalf("GetApprovedComments() error: %v", err)
+	}
+	var stored models.Comment
+	if err := db.First(&stored, comments[0].ID).Error; err != nil {
+		t.Fatalf("failed to load comment: %v", err)
+	}
+	if stored.ContentHTML != "" {
+		t.Errorf("ContentHTML after a read = %q, want it left empty", stored.ContentHTML)
+	}
+
+	rendered, err := service.BackfillContentHTML()
+	if err != nil {
+		t.Fatalf("BackfillContentHTML() error: %v", err)
+	}
+	if rendered != 2 {
+		t.Errorf("BackfillContentHTML() rendered %d comments, want 2", rendered)
+	}
+
+	want := map[uint]string{
+		comments[0].ID: RenderCommentMarkdown("**old**"),
+		comments[1].ID: "<p>cached</p>",
+		comments[2].ID: RenderCommentMarkdown("*deleted*"),
+	}
+	for id, html := range want {
+		var stored models.Comment
+		if err := db.Unscoped().First(&stored, id).Error; err != nil {
+			t.Fatalf("failed to load comment %d: %v", id, err)
+		}
+		if stored.ContentHTML != html {
+			t.Errorf("comment %d ContentHTML = %q, want %q", id, stored.ContentHTML, html)
+		}
+	}
+
+	rendered, err = service.BackfillContentHTML()
+	if err != nil {
+		t.Fatalf("second BackfillContentHTML() error: %v", err)
+	}
+	if rendered != 0 {
+		t.Errorf("second BackfillContentHTML() rendered %d comments, want 0", rendered)
+	}
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// Comment modes of a post
+const (
+	CommentModeOpen      = "open"      // Comments go through the usual moderation
+	CommentModeModerated = "moderated" // Every comment waits for review, even if the filters would approve it
+	CommentModeClosed    = "closed"    // Existing comments stay visible, new ones are refused
+	CommentModeHidden    = "hidden"    // Comments and the form are not shown at all
+)
+
+// ErrCommentsClosed is returned when a post no longer accepts comments
+var ErrCommentsClosed = errors.New("comments are closed for this post")
+
+// CommentValidationError lists the fields of a comment submission that failed validation
+type CommentValidationError struct {
+	Fields map[string]string // Message per JSON field name
+}
+
+func (e *CommentValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "invalid comment: " + strings.Join(names, ", ")
+}
+
+// CommentSubmissionService runs reader comments through validation, the guards, the spam classifier
+// and the moderation rules before storing them, for both the HTML form and the JSON API
+type CommentSubmissionService struct {
+	db            *gorm.DB
+	configService *ConfigService
+	guard         *CommentGuardService
+	classifier    *SpamClassifier
+	rules         *CommentRuleService
+	notifier      *CommentNotificationService
+	validator     *validator.Validate
+}
+
+func NewCommentSubmissionService(db *gorm.DB, configService *ConfigService, guard *CommentGuardService, classifier *SpamClassifier, rules *CommentRuleService, notifier *CommentNotificationService) *CommentSubmissionService {
+	validate := validator.New()
+	// Report fields by the names clients send
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	return &CommentSubmissionService{
+		db:            db,
+		configService: configService,
+		guard:         guard,
+		classifier:    classifier,
+		rules:         rules,
+		notifier:      notifier,
+		validator:     validate,
+	}
+}
+
+// CommentMode returns the comment mode in effect for a post.
+// Open and moderated posts close automatically comment_auto_close_days after they were published.
+func (s *CommentSubmissionService) CommentMode(post *models.Post) string {
+	mode := post.CommentMode
+	if !isCommentMode(mode) {
+		mode = CommentModeOpen
+	}
+
+	if mode == CommentModeOpen || mode == CommentModeModerated {
+		days := s.configService.GetIntConfig("comment_auto_close_days", 0)
+		if days > 0 && time.Since(post.PublishedTime()) > time.Duration(days)*24*time.Hour {
+			return CommentModeClosed
+		}
+	}
+	return mode
+}
+
+// AcceptsComments reports whether a post takes new comments
+func (s *CommentSubmissionService) AcceptsComments(post *models.Post) bool {
+	mode := s.CommentMode(post)
+	return mode == CommentModeOpen || mode == CommentModeModerated
+}
+
+// NewForm issues the form token and settings a client needs to comment on a post
+func (s *CommentSubmissionService) NewForm(postID uint) (models.CommentFormResponse, error) {
+	form := models.CommentFormResponse{
+		PowDifficulty: s.guard.ProofOfWorkDifficulty(),
+		NotifyReplies: s.notifier.RepliesEnabled(),
+	}
+
+	token, err := s.guard.IssueFormToken(postID)
+	if err != nil {
+		return form, fmt.Errorf("failed to issue comment form token: %w", err)
+	}
+	form.Token = token
+	return form, nil
+}
+
+// Submit validates a comment and stores it with the status decided by the classifier and the rules.
+// It returns ErrCommentsClosed when the post takes no comments, a *CommentValidationError for bad input
+// and a *CommentRejectedError when a guard or rule blocks it.
+func (s *CommentSubmissionService) Submit(post *models.Post, req models.CreateCommentRequest, ipAddress, referer string) (*models.Comment, error) {
+	mode := s.CommentMode(post)
+	if mode != CommentModeOpen && mode != CommentModeModerated {
+		return nil, ErrCommentsClosed
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Email = strings.TrimSpace(req.Email)
+	req.Content = strings.TrimSpace(req.Content)
+
+	if err := s.validate(post, &req); err != nil {
+		return nil, err
+	}
+
+	comment := models.Comment{
+		PostID:      post.ID,
+		ParentID:    req.ParentID,
+		Name:        req.Name,
+		Email:       req.Email,
+		Content:     req.Content,
+		ContentHTML: RenderCommentMarkdown(req.Content),
+		Status:      "pending",
+		IPAddress:   ipAddress,
+		Referer:     truncateRunes(referer, 500),
+	}
+
+	// Reply emails need an address, and the admin has to have turned them on
+	if req.NotifyReplies && req.Email != "" && s.notifier.RepliesEnabled() {
+		comment.NotifyReplies = true
+	}
+
+	submission := &CommentSubmission{
+		PostID:    post.ID,
+		Name:      comment.Name,
+		Email:     comment.Email,
+		Content:   comment.Content,
+		IPAddress: comment.IPAddress,
+		Referer:   comment.Referer,
+		Honeypot:  req.Website,
+		FormToken: req.FormToken,
+		PowNonce:  req.PowNonce,
+	}
+	if err := s.guard.Check(submission); err != nil {
+		return nil, err
+	}
+
+	// Score the comment, which may approve or hide it right away
+	s.classifier.Classify(&comment)
+
+	// Admin rules take precedence over the classifier
+	rule, err := s.rules.Match(&comment)
+	if err != nil {
+		log.Printf("Warning: failed to match comment rules: %v", err)
+	}
+	if rule != nil {
+		switch rule.Action {
+		case RuleActionReject:
+			rejected := &CommentRejectedError{
+				Reason: GuardReasonRule,
+				Detail: fmt.Sprintf("rule #%d (%s %s)", rule.ID, rule.Field, rule.MatchType),
+			}
+			s.guard.Release(submission)
+			s.guard.RecordRejection(submission, rejected)
+			return nil, rejected
+		case RuleActionHide:
+			comment.Status = "hidden"
+		case RuleActionApprove:
+			comment.Status = "approved"
+		}
+	}
+
+	// Moderated posts hold everything the filters didn't hide for review
+	if mode == CommentModeModerated && comment.Status == "approved" {
+		comment.Status = "pending"
+	}
+
+	if err := s.db.Create(&comment).Error; err != nil {
+		s.guard.Release(submission)
+		return nil, fmt.Errorf("failed to create comment: %w", err)
+	}
+	s.notifier.CommentCreated(&comment)
+
+	return &comment, nil
+}
+
+// validate checks the request fields and that a reply targets an approved comment on the same post
+func (s *CommentSubmissionService) validate(post *models.Post, req *models.CreateCommentRequest) error {
+	fields := make(map[string]string)
+
+	if err := s.validator.Struct(req); err != nil {
+		var validationErrors validator.ValidationErrors
+		if !errors.As(err, &validationErrors) {
+			return fmt.Errorf("failed to validate comment: %w", err)
+		}
+		for _, fieldError := range validationErrors {
+			fields[fieldError.Field()] = validationMessage(fieldError)
+		}
+	}
+
+	if req.ParentID != nil {
+		var count int64
+		err := s.db.Model(&models.Comment{}).
+			Where("id = ? AND post_id = ? AND status = ?", *req.ParentID, post.ID, "approved").
+			Count(&count).Error
+		if err != nil {
+			return fmt.Errorf("failed to fetch parent comment: %w", err)
+		}
+		if count == 0 {
+			fields["parent_id"] = "must be an approved comment on this post"
+		}
+	}
+
+	if len(fields) > 0 {
+		return &CommentValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// isCommentMode reports whether a value is a known comment mode
+func isCommentMode(mode string) bool {
+	switch mode {
+	case CommentModeOpen, CommentModeModerated, CommentModeClosed, CommentModeHidden:
+		return true
+	default:
+		return false
+	}
+}
+
+// validationMessage turns a failed validation rule into a short message for readers
+func validationMessage(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		return fmt.Sprintf("must be at least %s characters", fieldError.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s characters", fieldError.Param())
+	default:
+		return "is invalid"
+	}
+}
@@ -1,10 +1,14 @@
 package services
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"strconv"
+	"strings"
 
 	"gorm.io/gorm"
 	"github.com/bytetopia/BlankoBlog/backend/internal/models"
@@ -91,10 +95,42 @@ func (s *ConfigService) GetConfig(key string) (string, error) {
 // setDefaultConfigs ensures default configurations exist
 func (s *ConfigService) setDefaultConfigs(configMap map[string]string) {
 	defaults := map[string]string{
-		"blog_name":        "Blanko Blog",
-		"blog_description": "A simple and elegant blog platform",
-		"jwt_secret":       "", // Will be generated if not present
-		"blog_timezone":    "UTC", // Default timezone
+		"blog_name":                   "Blanko Blog",
+		"blog_description":            "A simple and elegant blog platform",
+		"jwt_secret":                  "",        // Will be generated if not present
+		"blog_timezone":               "UTC",     // Default timezone
+		"feed_content":                "summary", // "summary" or "full" post content in feeds
+		"robots_txt":                  defaultRobotsTxt,
+		"default_share_image":         "", // Image URL used when a page has no image of its own
+		"allowed_iframe_hosts":        "", // Hosts whose iframes may be embedded in posts
+		"code_highlight_style":        defaultHighlightStyle,
+		"comment_min_submit_seconds":  "3",  // Minimum time between rendering the form and submitting it
+		"comment_ip_rate_limit":       "5",  // Comments accepted per IP address per rate window
+		"comment_post_rate_limit":     "30", // Comments accepted per post per rate window
+		"comment_rate_window_minutes": "10",
+		"comment_pow_difficulty":      "0",         // Leading zero bits of the proof-of-work hash, 0 disables it
+		"comment_auto_close_days":     "0",         // Days after publishing when comments close, 0 keeps them open
+		"avatar_source":               "local",     // "local" or "gravatar" (fetched and cached by the server)
+		"avatar_style":                "identicon", // "identicon" or "initials"
+		"image_thumbnail_width":       "320",       // Widths of the resized copies of uploaded images, 0 skips one
+		"image_medium_width":          "800",
+		"image_large_width":           "1600",
+		"image_jpeg_quality":          "82",
+		"image_webp":                  "true", // Also keep lossless WebP copies where they are smaller, in practice of PNG images
+		"upload_allowed_types":        defaultUploadAllowedTypes,
+		"upload_serve_mode":           "proxy", // proxy, or redirect to a signed URL of the object storage
+		"spam_min_training":           "10",
+		"spam_hide_threshold":         "95", // Spam score percent at or above which comments are hidden
+		"spam_approve_threshold":      "0",  // Spam score percent at or below which comments are approved, 0 disables it
+		"smtp_host":                   "",   // Email is disabled until an SMTP host is set
+		"smtp_port":                   "587",
+		"smtp_tls_mode":               "starttls", // "none", "starttls" or "tls"
+		"smtp_username":               "",
+		"smtp_password":               "",
+		"smtp_from":                   "",
+		"notify_email":                "", // Falls back to the admin user's email
+		"notify_new_comments":         "true",
+		"notify_comment_replies":      "false",
 	}
 
 	for key, defaultValue := range defaults {
@@ -107,10 +143,42 @@ func (s *ConfigService) setDefaultConfigs(configMap map[string]string) {
 // getDefaultValue returns the default value for a known configuration key
 func (s *ConfigService) getDefaultValue(key string) string {
 	defaults := map[string]string{
-		"blog_name":        "Blanko Blog",
-		"blog_description": "A simple and elegant blog platform",
-		"jwt_secret":       "", // Will be generated if not present
-		"blog_timezone":    "UTC", // Default timezone
+		"blog_name":                   "Blanko Blog",
+		"blog_description":            "A simple and elegant blog platform",
+		"jwt_secret":                  "",        // Will be generated if not present
+		"blog_timezone":               "UTC",     // Default timezone
+		"feed_content":                "summary", // "summary" or "full" post content in feeds
+		"robots_txt":                  defaultRobotsTxt,
+		"default_share_image":         "", // Image URL used when a page has no image of its own
+		"allowed_iframe_hosts":        "", // Hosts whose iframes may be embedded in posts
+		"code_highlight_style":        defaultHighlightStyle,
+		"comment_min_submit_seconds":  "3",  // Minimum time between rendering the form and submitting it
+		"comment_ip_rate_limit":       "5",  // Comments accepted per IP address per rate window
+		"comment_post_rate_limit":     "30", // Comments accepted per post per rate window
+		"comment_rate_window_minutes": "10",
+		"comment_pow_difficulty":      "0",         // Leading zero bits of the proof-of-work hash, 0 disables it
+		"comment_auto_close_days":     "0",         // Days after publishing when comments close, 0 keeps them open
+		"avatar_source":               "local",     // "local" or "gravatar" (fetched and cached by the server)
+		"avatar_style":                "identicon", // "identicon" or "initials"
+		"image_thumbnail_width":       "320",       // Widths of the resized copies of uploaded images, 0 skips one
+		"image_medium_width":          "800",
+		"image_large_width":           "1600",
+		"image_jpeg_quality":          "82",
+		"image_webp":                  "true", // Also keep lossless WebP copies where they are smaller, in practice of PNG images
+		"upload_allowed_types":        defaultUploadAllowedTypes,
+		"upload_serve_mode":           "proxy", // proxy, or redirect to a signed URL of the object storage
+		"spam_min_training":           "10",
+		"spam_hide_threshold":         "95", // Spam score percent at or above which comments are hidden
+		"spam_approve_threshold":      "0",  // Spam score percent at or below which comments are approved, 0 disables it
+		"smtp_host":                   "",   // Email is disabled until an SMTP host is set
+		"smtp_port":                   "587",
+		"smtp_tls_mode":               "starttls", // "none", "starttls" or "tls"
+		"smtp_username":               "",
+		"smtp_password":               "",
+		"smtp_from":                   "",
+		"notify_email":                "", // Falls back to the admin user's email
+		"notify_new_comments":         "true",
+		"notify_comment_replies":      "false",
 	}
 
 	return defaults[key]
@@ -139,6 +207,166 @@ func (s *ConfigService) InitializeDefaultConfigs() error {
 			Value:       "UTC",
 			Description: "Timezone for displaying dates and times throughout the blog",
 		},
+		"feed_content": {
+			Key:         "feed_content",
+			Value:       "summary",
+			Description: "Whether feeds include a summary or the full post content (summary or full)",
+		},
+		"robots_txt": {
+			Key:         "robots_txt",
+			Value:       defaultRobotsTxt,
+			Description: "Rules served at /robots.txt; a Sitemap line is added unless one is present",
+		},
+		"default_share_image": {
+			Key:         "default_share_image",
+			Value:       "",
+			Description: "Image URL shown when pages are shared on social networks and the page has no image of its own",
+		},
+		"allowed_iframe_hosts": {
+			Key:         "allowed_iframe_hosts",
+			Value:       "",
+			Description: "Comma separated hosts allowed as iframe sources in posts, e.g. www.youtube-nocookie.com, player.vimeo.com",
+		},
+		"code_highlight_style": {
+			Key:         "code_highlight_style",
+			Value:       defaultHighlightStyle,
+			Description: "Syntax highlighting style for code blocks in posts, e.g. github, monokai or dracula",
+		},
+		"comment_min_submit_seconds": {
+			Key:         "comment_min_submit_seconds",
+			Value:       "3",
+			Description: "Comments submitted sooner than this many seconds after the page was loaded are rejected",
+		},
+		"comment_ip_rate_limit": {
+			Key:         "comment_ip_rate_limit",
+			Value:       "5",
+			Description: "Maximum number of comments accepted from one IP address per rate window, 0 disables the limit",
+		},
+		"comment_post_rate_limit": {
+			Key:         "comment_post_rate_limit",
+			Value:       "30",
+			Description: "Maximum number of comments accepted on one post per rate window, 0 disables the limit",
+		},
+		"comment_rate_window_minutes": {
+			Key:         "comment_rate_window_minutes",
+			Value:       "10",
+			Description: "Length in minutes of the window used by the comment rate limits",
+		},
+		"comment_pow_difficulty": {
+			Key:         "comment_pow_difficulty",
+			Value:       "0",
+			Description: "Proof-of-work difficulty in bits that the comment form solves in JavaScript, 0 disables it (16 takes about a second)",
+		},
+		"comment_auto_close_days": {
+			Key:         "comment_auto_close_days",
+			Value:       "0",
+			Description: "Close comments on posts this many days after they were published, 0 keeps them open",
+		},
+		"avatar_source": {
+			Key:         "avatar_source",
+			Value:       "local",
+			Description: "Where commenter avatars come from: local (generated on this server) or gravatar (fetched from Gravatar and cached, so readers never contact it)",
+		},
+		"avatar_style": {
+			Key:         "avatar_style",
+			Value:       "identicon",
+			Description: "Style of generated avatars: identicon or initials",
+		},
+		"image_thumbnail_width": {
+			Key:         "image_thumbnail_width",
+			Value:       "320",
+			Description: "Width in pixels of the thumbnail copy made of uploaded images, 0 skips it",
+		},
+		"image_medium_width": {
+			Key:         "image_medium_width",
+			Value:       "800",
+			Description: "Width in pixels of the medium copy made of uploaded images, 0 skips it",
+		},
+		"image_large_width": {
+			Key:         "image_large_width",
+			Value:       "1600",
+			Description: "Width in pixels of the large copy made of uploaded images, 0 skips it",
+		},
+		"image_jpeg_quality": {
+			Key:         "image_jpeg_quality",
+			Value:       "82",
+			Description: "JPEG quality (1-100) of the resized copies of uploaded JPEG images",
+		},
+		"image_webp": {
+			Key:         "image_webp",
+			Value:       "true",
+			Description: "Also make lossless WebP copies of uploaded images, kept where they are smaller than the original format. Only PNG-like content such as screenshots and graphics gets them; JPEG photos don't, as there is no lossy WebP",
+		},
+		"upload_allowed_types": {
+			Key:         "upload_allowed_types",
+			Value:       defaultUploadAllowedTypes,
+			Description: "File types that can be uploaded with their size limits in MB, as type:MB separated by commas (image/* allows every image type). Types are detected from the file content",
+		},
+		"upload_serve_mode": {
+			Key:         "upload_serve_mode",
+			Value:       "proxy",
+			Description: "How uploads are served: proxy streams them through the blog, redirect sends readers to a short-lived signed URL of the object storage (S3 storage only)",
+		},
+		"spam_min_training": {
+			Key:         "spam_min_training",
+			Value:       "10",
+			Description: "Number of approved and of hidden comments the spam classifier needs before it scores new comments",
+		},
+		"spam_hide_threshold": {
+			Key:         "spam_hide_threshold",
+			Value:       "95",
+			Description: "New comments with a spam score of at least this percentage are hidden automatically, 0 disables it",
+		},
+		"spam_approve_threshold": {
+			Key:         "spam_approve_threshold",
+			Value:       "0",
+			Description: "New comments with a spam score of at most this percentage are approved automatically, 0 disables it",
+		},
+		"smtp_host": {
+			Key:         "smtp_host",
+			Value:       "",
+			Description: "SMTP server used to send email, leave empty to disable email",
+		},
+		"smtp_port": {
+			Key:         "smtp_port",
+			Value:       "587",
+			Description: "SMTP server port (usually 587 for STARTTLS or 465 for TLS)",
+		},
+		"smtp_tls_mode": {
+			Key:         "smtp_tls_mode",
+			Value:       "starttls",
+			Description: "How to secure the SMTP connection (none, starttls or tls)",
+		},
+		"smtp_username": {
+			Key:         "smtp_username",
+			Value:       "",
+			Description: "SMTP username, leave empty if the server doesn't require authentication",
+		},
+		"smtp_password": {
+			Key:         "smtp_password",
+			Value:       "",
+			Description: "SMTP password",
+		},
+		"smtp_from": {
+			Key:         "smtp_from",
+			Value:       "",
+			Description: "Sender address of outgoing email, e.g. Blog <blog@example.com>",
+		},
+		"notify_email": {
+			Key:         "notify_email",
+			Value:       "",
+			Description: "Address that receives new comment notifications, defaults to the admin user's email",
+		},
+		"notify_new_comments": {
+			Key:         "notify_new_comments",
+			Value:       "true",
+			Description: "Email the admin about new comments with links to approve or hide them (true or false)",
+		},
+		"notify_comment_replies": {
+			Key:         "notify_comment_replies",
+			Value:       "false",
+			Description: "Let commenters opt in to an email when their comment gets a reply (true or false)",
+		},
 	}
 
 	return s.db.Transaction(func(tx *gorm.DB) error {
@@ -156,6 +384,21 @@ func (s *ConfigService) InitializeDefaultConfigs() error {
 	})
 }
 
+// GetIntConfig retrieves a configuration value as an integer, returning the fallback
+// when it is missing or not a number
+func (s *ConfigService) GetIntConfig(key string, fallback int) int {
+	value, err := s.GetConfig(key)
+	if err != nil {
+		return fallback
+	}
+
+	number, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return fallback
+	}
+	return number
+}
+
 // GetJWTSecret retrieves or generates the JWT secret key
 func (s *ConfigService) GetJWTSecret() (string, error) {
 	// Try to get existing JWT secret from database
@@ -186,6 +429,29 @@ func (s *ConfigService) GetJWTSecret() (string, error) {
 	return newSecret, nil
 }
 
+// Sign returns the hex HMAC of a payload with a key derived from the site secret.
+// The purpose separates the keys, so a signature made for one use is never valid for another.
+func (s *ConfigService) Sign(purpose, payload string) (string, error) {
+	secret, err := s.GetJWTSecret()
+	if err != nil {
+		return "", err
+	}
+
+	key := sha256.Sum256([]byte(purpose + ":" + secret))
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifySignature reports whether a signature made with Sign matches the payload
+func (s *ConfigService) VerifySignature(purpose, payload, signature string) bool {
+	expected, err := s.Sign(purpose, payload)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
 // generateRandomSecret generates a cryptographically secure random string
 func (s *ConfigService) generateRandomSecret(length int) (string, error) {
 	bytes := make([]byte, length)
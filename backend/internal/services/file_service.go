@@ -1,102 +1,276 @@
 package services
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"github.com/bytetopia/BlankoBlog/backend/internal/storage"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// signedUploadURLExpiry is how long a signed URL handed out for an upload stays valid
+const signedUploadURLExpiry = 15 * time.Minute
+
 type FileService struct {
-	db *gorm.DB
+	db            *gorm.DB
+	configService *ConfigService
+	storage       storage.Storage
+	blobLocks     *hashLocks
+}
+
+func NewFileService(db *gorm.DB, configService *ConfigService, store storage.Storage) *FileService {
+	return &FileService{db: db, configService: configService, storage: store, blobLocks: newHashLocks()}
+}
+
+// hashLocks holds a lock per blob hash. Storing a blob and counting a reference to it, and
+// dropping the last reference and removing the blob, each happen under the lock of its hash,
+// so an upload can't count on content that a concurrent delete is removing.
+type hashLocks struct {
+	mu    sync.Mutex
+	locks map[string]*hashLock
+}
+
+type hashLock struct {
+	sync.Mutex
+	waiting int // Holders and waiters, the lock is dropped when none are left
 }
 
-func NewFileService(db *gorm.DB) *FileService {
-	return &FileService{db: db}
+func newHashLocks() *hashLocks {
+	return &hashLocks{locks: make(map[string]*hashLock)}
 }
 
-// GetBaseUploadPath returns the base path for uploads (same directory as blog.db)
-func (s *FileService) GetBaseUploadPath() string {
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./data/blog.db"
+// lock takes the lock of a hash and returns the function releasing it
+func (l *hashLocks) lock(hash string) func() {
+	l.mu.Lock()
+	lock, ok := l.locks[hash]
+	if !ok {
+		lock = &hashLock{}
+		l.locks[hash] = lock
+	}
+	lock.waiting++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		lock.waiting--
+		if lock.waiting == 0 {
+			delete(l.locks, hash)
+		}
+		l.mu.Unlock()
 	}
-	
-	// Get the directory containing blog.db
-	baseDir := filepath.Dir(dbPath)
-	return filepath.Join(baseDir, "uploads")
 }
 
-// SaveUploadedFile saves a file to disk and returns the server path
-func (s *FileService) SaveUploadedFile(file multipart.File, header *multipart.FileHeader) (string, int64, string, error) {
-	// Generate timestamp-based filename to avoid conflicts
-	timestamp := time.Now().UnixNano()
-	ext := filepath.Ext(header.Filename)
-	filename := fmt.Sprintf("%d%s", timestamp, ext)
-	
-	// Create directory structure: uploads/year/month/
-	now := time.Now()
-	yearMonth := filepath.Join(fmt.Sprintf("%d", now.Year()), fmt.Sprintf("%02d", now.Month()))
-	uploadDir := filepath.Join(s.GetBaseUploadPath(), yearMonth)
-	
-	// Ensure directory exists
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		return "", 0, "", fmt.Errorf("failed to create upload directory: %w", err)
+// SaveUploadedFile stores the content of an uploaded file as a blob keyed by its SHA-256 hash,
+// so uploading the same content again stores nothing new, and creates the file record with
+// CreateFile. The post, names and folder are taken from record, which gets the server path,
+// size, type and hash filled in.
+// The type is detected from the content and checked against the allowed upload types and their
+// size limits, returning ErrUploadTypeNotAllowed or ErrUploadTooLarge for rejected files.
+func (s *FileService) SaveUploadedFile(file multipart.File, header *multipart.FileHeader, record *models.File) error {
+	// Detect MIME type from the content, as the type sent by the browser can't be trusted
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("failed to read file: %w", err)
 	}
+	head = head[:n]
+	mimeType := DetectContentType(head)
 	
-	// Full server path
-	serverPath := filepath.Join(yearMonth, filename)
-	fullPath := filepath.Join(s.GetBaseUploadPath(), serverPath)
+	limit, allowed := s.UploadLimit(mimeType)
+	if !allowed {
+		return fmt.Errorf("%w: %s", ErrUploadTypeNotAllowed, mimeType)
+	}
+	if header.Size > limit {
+		return uploadTooLarge(mimeType, limit)
+	}
 	
-	// Create destination file
-	dst, err := os.Create(fullPath)
+	// Spool to a temporary file first, as the key depends on the hash of the content
+	tmp, err := os.CreateTemp("", "upload-*")
 	if err != nil {
-		return "", 0, "", fmt.Errorf("failed to create file: %w", err)
+		return fmt.Errorf("failed to create file: %w", err)
 	}
-	defer dst.Close()
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
 	
-	// Copy file content
-	fileSize, err := io.Copy(dst, file)
+	// Copy file content, reading one byte past the limit to notice larger files
+	hash := sha256.New()
+	fileSize, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(io.MultiReader(bytes.NewReader(head), file), limit+1))
 	if err != nil {
-		os.Remove(fullPath) // Clean up on error
-		return "", 0, "", fmt.Errorf("failed to save file: %w", err)
+		return fmt.Errorf("failed to save file: %w", err)
 	}
+	if fileSize > limit {
+		return uploadTooLarge(mimeType, limit)
+	}
+	
+	// The blob is checked, stored and referenced without a delete of the same content in between
+	sum := hex.EncodeToString(hash.Sum(nil))
+	unlock := s.blobLocks.lock(sum)
+	defer unlock()
 	
-	// Detect MIME type from header
-	mimeType := header.Header.Get("Content-Type")
-	if mimeType == "" {
-		mimeType = "application/octet-stream"
+	// Content that is already stored keeps its blob, new content is stored
+	serverPath := blobServerPath(sum, uploadExtension(header.Filename, mimeType))
+	var blob models.Blob
+	if err := s.db.First(&blob, "hash = ?", sum).Error; err == nil {
+		serverPath = blob.ServerPath
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
 	}
 	
-	return serverPath, fileSize, mimeType, nil
+	stored := false
+	if _, err := s.storage.Stat(serverPath); errors.Is(err, storage.ErrNotExist) {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to save file: %w", err)
+		}
+		if err := s.storage.Put(serverPath, tmp, fileSize, mimeType); err != nil {
+			return fmt.Errorf("failed to save file: %w", err)
+		}
+		stored = true
+	} else if err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	
+	record.OriginalFileName = header.Filename
+	record.ServerPath = serverPath
+	record.FileSize = fileSize
+	record.MimeType = mimeType
+	record.SHA256 = sum
+	if err := s.CreateFile(record); err != nil {
+		// Content stored for this upload alone would be left without a blob
+		if stored && blob.Hash == "" {
+			s.removeUpload(serverPath)
+		}
+		return fmt.Errorf("failed to create file record: %w", err)
+	}
+	return nil
+}
+
+// blobServerPath returns where the blob with a hash is stored, spread over directories by the first byte
+func blobServerPath(hash, ext string) string {
+	return filepath.ToSlash(filepath.Join("blobs", hash[:2], hash+ext))
+}
+
+// UploadLimit returns the size limit in bytes for uploads of a MIME type,
+// and false when the type is not allowed
+func (s *FileService) UploadLimit(mimeType string) (int64, bool) {
+	limits := s.uploadLimits()
+	if limit, ok := limits[mimeType]; ok {
+		return limit, true
+	}
+	major, _, _ := strings.Cut(mimeType, "/")
+	limit, ok := limits[major+"/*"]
+	return limit, ok
+}
+
+// MaxUploadSize returns the largest size an upload of any allowed type can have
+func (s *FileService) MaxUploadSize() int64 {
+	var largest int64
+	for _, limit := range s.uploadLimits() {
+		largest = max(largest, limit)
+	}
+	return largest
+}
+
+// uploadLimits returns the allowed upload types with their size limits in bytes
+func (s *FileService) uploadLimits() map[string]int64 {
+	value, err := s.configService.GetConfig("upload_allowed_types")
+	if err != nil || strings.TrimSpace(value) == "" {
+		value = defaultUploadAllowedTypes
+	}
+	return parseUploadLimits(value)
+}
+
+// uploadTooLarge describes the size limit an upload went over
+func uploadTooLarge(mimeType string, limit int64) error {
+	megabytes := strconv.FormatFloat(math.Round(float64(limit)/(1<<20)*100)/100, 'f', -1, 64)
+	return fmt.Errorf("%w: %s files are limited to %s MB", ErrUploadTooLarge, mimeType, megabytes)
 }
 
-// CreateFile creates a new file record in the database
+// CreateFile creates a new file record in the database, counting it as a reference to its blob
 func (s *FileService) CreateFile(file *models.File) error {
-	return s.db.Create(file).Error
+	file.Folder = normalizeFolder(file.Folder)
+	if file.SHA256 == "" {
+		return s.db.Create(file).Error
+	}
+	
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		blob := models.Blob{
+			Hash:       file.SHA256,
+			ServerPath: file.ServerPath,
+			FileSize:   file.FileSize,
+			MimeType:   file.MimeType,
+			RefCount:   1,
+		}
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "hash"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"ref_count": gorm.Expr("ref_count + 1")}),
+		}).Create(&blob).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(file).Error
+	})
 }
 
 // GetFile retrieves a file by ID with post information
 func (s *FileService) GetFile(id uint) (*models.File, error) {
 	var file models.File
-	if err := s.db.Preload("Post").First(&file, id).Error; err != nil {
+	if err := s.preloadFile(s.db).First(&file, id).Error; err != nil {
 		return nil, err
 	}
 	return &file, nil
 }
 
-// GetFiles retrieves files with pagination
-func (s *FileService) GetFiles(page, limit int) ([]models.File, int64, error) {
+// GetFiles retrieves the files matching a filter with pagination, newest first
+func (s *FileService) GetFiles(page, limit int, filter models.FileFilter) ([]models.File, int64, error) {
 	var files []models.File
 	var total int64
 	
 	query := s.db.Model(&models.File{})
 	
+	if filter.Type != "" {
+		mimeType := strings.ToLower(strings.TrimSpace(filter.Type))
+		if strings.Contains(mimeType, "/") {
+			query = query.Where("mime_type = ?", mimeType)
+		} else {
+			query = query.Where("mime_type LIKE ?", mimeType+"/%")
+		}
+	}
+	if filter.Folder != nil {
+		query = query.Where("folder = ?", normalizeFolder(*filter.Folder))
+	}
+	
+	// Usage only counts posts that haven't been deleted
+	usedIn := "SELECT 1 FROM post_files JOIN posts ON posts.id = post_files.post_id AND posts.deleted_at IS NULL WHERE post_files.file_id = files.id"
+	switch filter.Usage {
+	case "used":
+		query = query.Where("EXISTS (" + usedIn + ")")
+	case "unused":
+		query = query.Where("NOT EXISTS (" + usedIn + ")")
+	}
+	if filter.PostID != 0 {
+		query = query.Where("EXISTS ("+usedIn+" AND posts.id = ?)", filter.PostID)
+	}
+	
+	if filter.Query != "" {
+		query = query.Where("LOWER(display_name) LIKE ?", "%"+strings.ToLower(filter.Query)+"%")
+	}
+	
 	// Count total
 	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
@@ -104,23 +278,37 @@ func (s *FileService) GetFiles(page, limit int) ([]models.File, int64, error) {
 	
 	// Get files with pagination and preload post info
 	offset := (page - 1) * limit
-	if err := query.Preload("Post").Order("created_at DESC").Offset(offset).Limit(limit).Find(&files).Error; err != nil {
+	if err := s.preloadFile(query).Order("created_at DESC").Offset(offset).Limit(limit).Find(&files).Error; err != nil {
 		return nil, 0, err
 	}
 	
 	return files, total, nil
 }
 
-// GetFilesByPost retrieves all files for a specific post
-func (s *FileService) GetFilesByPost(postID uint) ([]models.File, error) {
-	var files []models.File
-	if err := s.db.Where("post_id = ?", postID).Order("created_at DESC").Find(&files).Error; err != nil {
+// GetFolders lists the folders holding files, with the number of files directly in each
+func (s *FileService) GetFolders() ([]models.FolderSummary, error) {
+	folders := []models.FolderSummary{}
+	err := s.db.Model(&models.File{}).
+		Select("folder AS name, COUNT(*) AS count").
+		Where("folder <> ''").
+		Group("folder").
+		Order("folder").
+		Scan(&folders).Error
+	if err != nil {
 		return nil, err
 	}
-	return files, nil
+	return folders, nil
+}
+
+// preloadFile loads what a file response shows: the post it was uploaded for, its resized
+// copies and the posts using it
+func (s *FileService) preloadFile(query *gorm.DB) *gorm.DB {
+	return query.Preload("Post").Preload("Variants").Preload("UsedIn", func(db *gorm.DB) *gorm.DB {
+		return db.Select("posts.id", "posts.title", "posts.slug").Order("posts.id")
+	})
 }
 
-// UpdateFile updates file metadata (display name and description only)
+// UpdateFile updates file metadata (display name, description and folder only)
 func (s *FileService) UpdateFile(id uint, updates *models.UpdateFileRequest) (*models.File, error) {
 	var file models.File
 	if err := s.db.First(&file, id).Error; err != nil {
@@ -135,6 +323,9 @@ func (s *FileService) UpdateFile(id uint, updates *models.UpdateFileRequest) (*m
 	if updates.Description != nil {
 		updateMap["description"] = *updates.Description
 	}
+	if updates.Folder != nil {
+		updateMap["folder"] = normalizeFolder(*updates.Folder)
+	}
 	
 	if len(updateMap) > 0 {
 		if err := s.db.Model(&file).Updates(updateMap).Error; err != nil {
@@ -143,32 +334,125 @@ func (s *FileService) UpdateFile(id uint, updates *models.UpdateFileRequest) (*m
 	}
 	
 	// Reload to get updated data
-	if err := s.db.Preload("Post").First(&file, id).Error; err != nil {
+	if err := s.preloadFile(s.db).First(&file, id).Error; err != nil {
 		return nil, err
 	}
 	
 	return &file, nil
 }
 
-// DeleteFile deletes a file record and the physical file
+// DeleteFile deletes a file record. Its blob and the resized copies are deleted from disk
+// along with the last file referencing them.
 func (s *FileService) DeleteFile(id uint) error {
 	var file models.File
 	if err := s.db.First(&file, id).Error; err != nil {
 		return err
 	}
 	
-	// Delete physical file
-	fullPath := filepath.Join(s.GetBaseUploadPath(), file.ServerPath)
-	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
-		// Log error but don't fail the operation
-		fmt.Printf("Warning: failed to delete physical file %s: %v\n", fullPath, err)
+	// Files from before deduplication have content of their own
+	if file.SHA256 == "" {
+		s.removeUpload(file.ServerPath)
+		return s.db.Delete(&file).Error
+	}
+	
+	// An upload of the same content waits until the blob is either kept or gone
+	unlock := s.blobLocks.lock(file.SHA256)
+	defer unlock()
+	
+	var orphaned *models.Blob
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Delete database record (soft delete)
+		if err := tx.Delete(&file).Error; err != nil {
+			return err
+		}
+		
+		err := tx.Model(&models.Blob{}).Where("hash = ?", file.SHA256).
+			UpdateColumn("ref_count", gorm.Expr("ref_count - 1")).Error
+		if err != nil {
+			return err
+		}
+		
+		var blob models.Blob
+		if err := tx.First(&blob, "hash = ?", file.SHA256).Error; err != nil {
+			return err
+		}
+		if blob.RefCount > 0 {
+			return nil
+		}
+		orphaned = &blob
+		return tx.Delete(&blob).Error
+	})
+	if err != nil {
+		return err
+	}
+	
+	if orphaned != nil {
+		s.removeUpload(orphaned.ServerPath)
+		return s.deleteVariants(orphaned.Hash)
+	}
+	return nil
+}
+
+// deleteVariants deletes the resized copies of an image blob from disk and the database
+func (s *FileService) deleteVariants(hash string) error {
+	var variants []models.FileVariant
+	if err := s.db.Where("blob_hash = ?", hash).Find(&variants).Error; err != nil {
+		return err
+	}
+	
+	for _, variant := range variants {
+		s.removeUpload(variant.ServerPath)
+	}
+	
+	return s.db.Where("blob_hash = ?", hash).Delete(&models.FileVariant{}).Error
+}
+
+// removeUpload deletes an uploaded file from storage, logging failures as the record is gone either way
+func (s *FileService) removeUpload(serverPath string) {
+	if err := s.storage.Delete(serverPath); err != nil {
+		fmt.Printf("Warning: failed to delete physical file %s: %v\n", serverPath, err)
+	}
+}
+
+// OpenUpload opens an uploaded file for reading, returning storage.ErrNotExist when there is none
+func (s *FileService) OpenUpload(serverPath string) (storage.Object, *storage.ObjectInfo, error) {
+	return s.storage.Get(serverPath)
+}
+
+// RedirectUploads reports whether uploads are served by redirecting to a signed URL of the
+// storage, rather than through the blog
+func (s *FileService) RedirectUploads() bool {
+	mode, err := s.configService.GetConfig("upload_serve_mode")
+	return err == nil && strings.EqualFold(strings.TrimSpace(mode), "redirect")
+}
+
+// SignedUploadURL returns a short-lived URL of an uploaded file in storage. Files of types that
+// can't be shown inline are sent as downloads. It returns storage.ErrNotExist for files that are
+// not stored, as signing doesn't check, and storage.ErrSignedURLUnsupported for storage that can
+// only be reached through the blog, such as the local disk.
+func (s *FileService) SignedUploadURL(serverPath, contentType string) (string, error) {
+	if _, err := s.storage.Stat(serverPath); err != nil {
+		return "", err
 	}
 	
-	// Delete database record (soft delete)
-	return s.db.Delete(&file).Error
+	options := storage.URLOptions{ContentType: contentType}
+	if !IsInlineType(contentType) {
+		options.ContentDisposition = "attachment"
+	}
+	return s.storage.SignedURL(serverPath, signedUploadURLExpiry, options)
+}
+
+// readUpload returns the content of an uploaded file
+func (s *FileService) readUpload(serverPath string) ([]byte, error) {
+	object, _, err := s.storage.Get(serverPath)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	return io.ReadAll(object)
 }
 
-// GetFullPath returns the full filesystem path for a file
-func (s *FileService) GetFullPath(serverPath string) string {
-	return filepath.Join(s.GetBaseUploadPath(), serverPath)
+// writeUpload stores the content of an uploaded file, replacing what was stored before
+func (s *FileService) writeUpload(serverPath string, data []byte, mimeType string) error {
+	return s.storage.Put(serverPath, bytes.NewReader(data), int64(len(data)), mimeType)
 }
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"github.com/bytetopia/BlankoBlog/backend/internal/storage"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// uploadedFile is an in-memory multipart.File
+type uploadedFile struct {
+	*bytes.Reader
+}
+
+func (uploadedFile) Close() error { return nil }
+
+func newFileTestService(t *testing.T) *FileService {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "test.db")+"?_busy_timeout=5000"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Config{}, &models.Blob{}, &models.File{}, &models.FileVariant{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return NewFileService(db, NewConfigService(db), storage.NewDisk(filepath.Join(dir, "uploads")))
+}
+
+func upload(s *FileService, content string) (*models.File, error) {
+	header := &multipart.FileHeader{Filename: "notes.txt", Size: int64(len(content))}
+	record := &models.File{DisplayName: "notes.txt"}
+	err := s.SaveUploadedFile(uploadedFile{bytes.NewReader([]byte(content))}, header, record)
+	return record, err
+}
+
+func TestSaveUploadedFileSharesBlobs(t *testing.T) {
+	s := newFileTestService(t)
+
+	first, err := upload(s, "same content")
+	if err != nil {
+		t.Fatalf("first upload failed: %v", err)
+	}
+	second, err := upload(s, "same content")
+	if err != nil {
+		t.Fatalf("second upload failed: %v", err)
+	}
+	if first.ServerPath != second.ServerPath {
+		t.Errorf("uploads of the same content got %s and %s, want one blob", first.ServerPath, second.ServerPath)
+	}
+
+	if err := s.DeleteFile(first.ID); err != nil {
+		t.Fatalf("DeleteFile() error: %v", err)
+	}
+	if _, err := s.storage.Stat(second.ServerPath); err != nil {
+		t.Errorf("blob removed while a file still uses it: %v", err)
+	}
+
+	if err := s.DeleteFile(second.ID); err != nil {
+		t.Fatalf("DeleteFile() error: %v", err)
+	}
+	if _, err := s.storage.Stat(second.ServerPath); !errors.Is(err, storage.ErrNotExist) {
+		t.Errorf("blob kept after its last file was deleted: %v", err)
+	}
+}
+
+func TestSaveUploadedFileRemovesContentWhenRecordFails(t *testing.T) {
+	s := newFileTestService(t)
+	if err := s.db.Migrator().DropTable(&models.File{}); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := upload(s, "orphan content")
+	if err == nil {
+		t.Fatal("upload succeeded without a files table")
+	}
+	if _, err := s.storage.Stat(record.ServerPath); !errors.Is(err, storage.ErrNotExist) {
+		t.Errorf("content of the failed upload was left in storage: %v", err)
+	}
+	var blobs int64
+	s.db.Model(&models.Blob{}).Count(&blobs)
+	if blobs != 0 {
+		t.Errorf("%d blobs left after the failed upload, want 0", blobs)
+	}
+}
+
+func TestDeleteFileRacingUploadOfSameContent(t *testing.T) {
+	s := newFileTestService(t)
+
+	for i := 0; i < 50; i++ {
+		existing, err := upload(s, "raced content")
+		if err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+
+		var uploaded *models.File
+		var uploadErr, deleteErr error
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			deleteErr = s.DeleteFile(existing.ID)
+		}()
+		go func() {
+			defer wg.Done()
+			uploaded, uploadErr = upload(s, "raced content")
+		}()
+		wg.Wait()
+
+		if deleteErr != nil || uploadErr != nil {
+			t.Fatalf("delete error %v, upload error %v", deleteErr, uploadErr)
+		}
+		if _, err := s.storage.Stat(uploaded.ServerPath); err != nil {
+			t.Fatalf("round %d: uploaded file has no content in storage: %v", i, err)
+		}
+		if err := s.DeleteFile(uploaded.ID); err != nil {
+			t.Fatalf("DeleteFile() error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// uploadReferenceRegex finds links to uploads in post content, whether Markdown, HTML or bare URLs
+var uploadReferenceRegex = regexp.MustCompile(`/uploads/([^\s"'<>()\[\]?#]+)`)
+
+// uploadReferences returns the server paths of the uploads a text links to
+func uploadReferences(content string) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, match := range uploadReferenceRegex.FindAllStringSubmatch(content, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			paths = append(paths, match[1])
+		}
+	}
+	return paths
+}
+
+// syncPostFiles records which files a post uses: those its content links to, including through
+// a resized copy, and its cover. Files sharing a blob are all used by a link to it.
+func syncPostFiles(db *gorm.DB, post *models.Post) error {
+	var fileIDs []uint
+	if paths := uploadReferences(post.Content); len(paths) > 0 {
+		variantBlobs := db.Model(&models.FileVariant{}).Select("blob_hash").Where("server_path IN ?", paths)
+		err := db.Model(&models.File{}).
+			Where("server_path IN ? OR sha256 IN (?)", paths, variantBlobs).
+			Pluck("id", &fileIDs).Error
+		if err != nil {
+			return fmt.Errorf("failed to find files used by post: %w", err)
+		}
+	}
+	if post.CoverFileID != nil {
+		fileIDs = append(fileIDs, *post.CoverFileID)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("post_id = ?", post.ID).Delete(&models.PostFile{}).Error; err != nil {
+			return err
+		}
+
+		seen := make(map[uint]bool)
+		var usages []models.PostFile
+		for _, fileID := range fileIDs {
+			if !seen[fileID] {
+				seen[fileID] = true
+				usages = append(usages, models.PostFile{PostID: post.ID, FileID: fileID})
+			}
+		}
+		if len(usages) == 0 {
+			return nil
+		}
+		return tx.Create(&usages).Error
+	})
+}
+
+// RescanFileUsage records the files used by every post again, such as after upgrading from a
+// version that didn't track usage. It returns the number of posts scanned.
+func (s *FileService) RescanFileUsage() (int, error) {
+	var posts []models.Post
+	if err := s.db.Select("id", "content", "cover_file_id").Find(&posts).Error; err != nil {
+		return 0, err
+	}
+
+	for i := range posts {
+		if err := syncPostFiles(s.db, &posts[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(posts), nil
+}
+
+// BackfillFileUsage scans every post while no usage is recorded at all, as after upgrading
+func (s *FileService) BackfillFileUsage() error {
+	var recorded int64
+	if err := s.db.Model(&models.PostFile{}).Count(&recorded).Error; err != nil {
+		return err
+	}
+	if recorded > 0 {
+		return nil
+	}
+	_, err := s.RescanFileUsage()
+	return err
+}
+
+// normalizeFolder cleans up a folder name, so "/logos//dark/" and "logos/dark" are the same folder
+func normalizeFolder(folder string) string {
+	var parts []string
+	for _, part := range strings.Split(folder, "/") {
+		if part = strings.TrimSpace(part); part != "" && part != "." && part != ".." {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/draw"
+)
+
+const (
+	exifTagOrientation = 0x0112
+	exifTagGPSInfo     = 0x8825
+)
+
+// Markers of the metadata stripLocation looks for
+const (
+	pngSignature          = "\x89PNG\r\n\x1a\n"
+	xmpNamespace          = "http://ns.adobe.com/xap/1.0/"
+	xmpExtensionNamespace = "http://ns.adobe.com/xmp/extension/"
+	webpXMPFlag           = 0x04 // Bit of the VP8X chunk's flags telling an XMP chunk follows
+)
+
+// exifTypeSizes is the size in bytes of each TIFF field type
+var exifTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// jpegExif returns the TIFF structure of the EXIF segment of a JPEG file, or nil when it has none.
+// The returned slice shares memory with data.
+func jpegExif(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil
+	}
+
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xff {
+			return nil
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte before a marker
+			pos++
+			continue
+		case marker == 0xda, marker == 0xd9:
+			// Metadata segments all come before the image data
+			return nil
+		case marker >= 0xd0 && marker <= 0xd7, marker == 0x01:
+			pos += 2
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xe1 && len(segment) > 14 && string(segment[:6]) == "Exif\x00\x00" {
+			return segment[6:]
+		}
+		pos += 2 + length
+	}
+	return nil
+}
+
+// tiffIFD is one image file directory within EXIF data
+type tiffIFD struct {
+	data   []byte
+	order  binary.ByteOrder
+	offset int
+	count  int
+}
+
+// parseTIFF returns the first directory of TIFF data
+func parseTIFF(data []byte) (*tiffIFD, bool) {
+	if len(data) < 8 {
+		return nil, false
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, false
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return nil, false
+	}
+	return readIFD(data, order, int(order.Uint32(data[4:])))
+}
+
+func readIFD(data []byte, order binary.ByteOrder, offset int) (*tiffIFD, bool) {
+	if offset < 8 || offset+2 > len(data) {
+		return nil, false
+	}
+	count := int(order.Uint16(data[offset:]))
+	if offset+2+count*12 > len(data) {
+		return nil, false
+	}
+	return &tiffIFD{data: data, order: order, offset: offset, count: count}, true
+}
+
+// find returns the position of the entry for a tag
+func (d *tiffIFD) find(tag uint16) (int, bool) {
+	for i := 0; i < d.count; i++ {
+		entry := d.offset + 2 + i*12
+		if d.order.Uint16(d.data[entry:]) == tag {
+			return entry, true
+		}
+	}
+	return 0, false
+}
+
+// exifOrientation returns the EXIF orientation (1-8) of a JPEG file, 1 when it has none
+func exifOrientation(data []byte) int {
+	ifd, ok := parseTIFF(jpegExif(data))
+	if !ok {
+		return 1
+	}
+	entry, ok := ifd.find(exifTagOrientation)
+	if !ok || ifd.order.Uint16(ifd.data[entry+2:]) != 3 {
+		return 1
+	}
+	orientation := int(ifd.order.Uint16(ifd.data[entry+8:]))
+	if orientation < 1 || orientation > 8 {
+		return 1
+	}
+	return orientation
+}
+
+// stripLocation removes location data from an image file: the GPS directory of its EXIF data,
+// and its XMP metadata, which can hold the location too and is dropped whole. It covers the
+// EXIF segment and XMP segments of JPEG files, the eXIf chunk and XMP text chunks of PNG files,
+// including ImageMagick's "Raw profile type" ones, and the EXIF and XMP chunks of WebP files.
+// EXIF data is changed in place, so the returned file may share memory with data.
+// It reports whether anything was removed.
+func stripLocation(data []byte, format string) ([]byte, bool) {
+	switch format {
+	case "jpeg":
+		return stripJPEGLocation(data)
+	case "png":
+		return stripPNGLocation(data)
+	case "webp":
+		return stripWebPLocation(data)
+	}
+	return data, false
+}
+
+// stripJPEGLocation erases the GPS directory from the EXIF segment of a JPEG file in place
+// and removes its XMP segments
+func stripJPEGLocation(data []byte) ([]byte, bool) {
+	stripped := eraseGPS(jpegExif(data))
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return data, stripped
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	removed := false
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xff {
+		marker := data[pos+1]
+		if marker == 0xda || marker == 0xd9 || marker == 0xff || (marker >= 0xd0 && marker <= 0xd7) || marker == 0x01 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xe1 && (bytes.HasPrefix(segment, []byte(xmpNamespace+"\x00")) || bytes.HasPrefix(segment, []byte(xmpExtensionNamespace+"\x00"))) {
+			removed = true
+		} else {
+			out = append(out, data[pos:pos+2+length]...)
+		}
+		pos += 2 + length
+	}
+	if !removed {
+		return data, stripped
+	}
+	return append(out, data[pos:]...), true
+}
+
+// stripPNGLocation erases the GPS directory from the eXIf chunk of a PNG file and removes
+// its XMP and raw profile text chunks
+func stripPNGLocation(data []byte) ([]byte, bool) {
+	if len(data) < 8 || string(data[:8]) != pngSignature {
+		return data, false
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:8]...)
+	changed := false
+	for pos := 8; pos+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if length > len(data)-pos-12 {
+			// A damaged chunk and anything after it are kept as they are
+			return append(out, data[pos:]...), changed
+		}
+		chunkType := string(data[pos+4 : pos+8])
+		chunk := data[pos : pos+12+length]
+		content := chunk[8 : 8+length]
+		pos += 12 + length
+
+		switch chunkType {
+		case "eXIf":
+			if eraseGPS(content) {
+				binary.BigEndian.PutUint32(chunk[8+length:], crc32.ChecksumIEEE(chunk[4:8+length]))
+				changed = true
+			}
+		case "iTXt", "tEXt", "zTXt":
+			keyword, _, _ := bytes.Cut(content, []byte{0})
+			if string(keyword) == "XML:com.adobe.xmp" || bytes.HasPrefix(keyword, []byte("Raw profile type")) {
+				changed = true
+				continue
+			}
+		}
+		out = append(out, chunk...)
+	}
+	if !changed {
+		return data, false
+	}
+	return out, true
+}
+
+// stripWebPLocation erases the GPS directory from the EXIF chunk of a WebP file and removes its XMP chunk
+func stripWebPLocation(data []byte) ([]byte, bool) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return data, false
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+	changed, removedXMP := false, false
+	for pos := 12; pos+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2
+		if size > len(data)-pos-8 {
+			return append(out, data[pos:]...), changed
+		}
+		end = min(end, len(data))
+		chunk := data[pos:end]
+		pos = end
+
+		switch string(chunk[:4]) {
+		case "EXIF":
+			// Some writers keep the "Exif\0\0" header of JPEG segments
+			exif := chunk[8 : 8+size]
+			changed = eraseGPS(bytes.TrimPrefix(exif, []byte("Exif\x00\x00"))) || changed
+		case "XMP ":
+			changed, removedXMP = true, true
+			continue
+		}
+		out = append(out, chunk...)
+	}
+	if !changed {
+		return data, false
+	}
+
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	if removedXMP && len(out) >= 21 && string(out[12:16]) == "VP8X" {
+		out[20] &^= webpXMPFlag
+	}
+	return out, true
+}
+
+// eraseGPS erases the GPS directory of TIFF data in place, leaving the rest of it byte for byte
+// the same. It reports whether anything was erased.
+func eraseGPS(tiff []byte) bool {
+	ifd, ok := parseTIFF(tiff)
+	if !ok {
+		return false
+	}
+	entry, ok := ifd.find(exifTagGPSInfo)
+	if !ok {
+		return false
+	}
+	gps, ok := readIFD(ifd.data, ifd.order, int(ifd.order.Uint32(ifd.data[entry+8:])))
+	if !ok || gps.count == 0 {
+		return false
+	}
+
+	// Values over four bytes are stored elsewhere and erased there too
+	for i := 0; i < gps.count; i++ {
+		field := gps.offset + 2 + i*12
+		size := exifTypeSizes[gps.order.Uint16(gps.data[field+2:])] * int(gps.order.Uint32(gps.data[field+4:]))
+		if size > 4 {
+			valueOffset := int(gps.order.Uint32(gps.data[field+8:]))
+			if valueOffset >= 8 && size <= len(gps.data)-valueOffset {
+				clear(gps.data[valueOffset : valueOffset+size])
+			}
+		}
+	}
+
+	// An empty directory is left behind, followed by a zero offset to the next one
+	clear(gps.data[gps.offset : gps.offset+2+gps.count*12])
+	return true
+}
+
+// orientImage applies an EXIF orientation to an image, so it is stored the way it is meant to be seen
+func orientImage(src image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	in := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(in, in.Bounds(), src, b.Min, draw.Src)
+
+	var out *image.RGBA
+	if orientation >= 5 {
+		out = image.NewRGBA(image.Rect(0, 0, h, w))
+	} else {
+		out = image.NewRGBA(image.Rect(0, 0, w, h))
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // Rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // Transposed
+				dx, dy = y, x
+			case 6: // Rotated 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // Transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotated 90° counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			copy(out.Pix[out.PixOffset(dx, dy):out.PixOffset(dx, dy)+4], in.Pix[in.PixOffset(x, y):in.PixOffset(x, y)+4])
+		}
+	}
+	return out
+}
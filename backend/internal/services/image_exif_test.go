@@ -0,0 +1,198 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/webp"
+	xwebp "golang.org/x/image/webp"
+)
+
+// gpsLatitude is the value of the GPS latitude in testExif, which must not survive stripping
+var gpsLatitude = []byte{0xef, 0xbe, 0xad, 0xde, 0x01, 0x00, 0x00, 0x00}
+
+// testXMP is XMP metadata holding a location
+const testXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+	`<rdf:Description xmlns:exif="http://ns.adobe.com/exif/1.0/" exif:GPSLatitude="37,48.5N"/></rdf:RDF></x:xmpmeta>`
+
+// testExif returns little-endian TIFF data with an orientation of 6 and a GPS directory
+func testExif() []byte {
+	data := make([]byte, 92)
+	le := binary.LittleEndian
+	copy(data, "II*\x00")
+	le.PutUint32(data[4:], 8)
+
+	// First directory at 8: orientation and the offset of the GPS directory
+	le.PutUint16(data[8:], 2)
+	putTIFFEntry(data[10:], exifTagOrientation, 3, 1, 6)
+	putTIFFEntry(data[22:], exifTagGPSInfo, 4, 1, 38)
+
+	// GPS directory at 38: latitude reference and three rationals stored at 68
+	le.PutUint16(data[38:], 2)
+	putTIFFEntry(data[40:], 1, 2, 2, uint32('N'))
+	putTIFFEntry(data[52:], 2, 5, 3, 68)
+	for i := 0; i < 3; i++ {
+		copy(data[68+i*8:], gpsLatitude)
+	}
+	return data
+}
+
+func putTIFFEntry(data []byte, tag, fieldType uint16, count, value uint32) {
+	binary.LittleEndian.PutUint16(data, tag)
+	binary.LittleEndian.PutUint16(data[2:], fieldType)
+	binary.LittleEndian.PutUint32(data[4:], count)
+	binary.LittleEndian.PutUint32(data[8:], value)
+}
+
+func testImage() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 8))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	img.SetNRGBA(3, 4, color.NRGBA{200, 10, 10, 255})
+	return img
+}
+
+// assertNoLocation fails when the GPS latitude or XMP location is still in data
+func assertNoLocation(t *testing.T, data []byte) {
+	t.Helper()
+	if bytes.Contains(data, gpsLatitude) {
+		t.Error("stripped file still holds the GPS latitude")
+	}
+	if bytes.Contains(data, []byte("GPSLatitude")) {
+		t.Error("stripped file still holds the XMP location")
+	}
+}
+
+func TestStripJPEGLocation(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	segment := func(payload []byte) []byte {
+		header := []byte{0xff, 0xe1, 0, 0}
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)+2))
+		return append(header, payload...)
+	}
+	var data []byte
+	data = append(data, encoded.Bytes()[:2]...)
+	data = append(data, segment(append([]byte("Exif\x00\x00"), testExif()...))...)
+	data = append(data, segment([]byte(xmpNamespace+"\x00"+testXMP))...)
+	data = append(data, encoded.Bytes()[2:]...)
+
+	stripped, ok := stripLocation(data, "jpeg")
+	if !ok {
+		t.Fatal("stripLocation() removed nothing")
+	}
+	assertNoLocation(t, stripped)
+	if orientation := exifOrientation(stripped); orientation != 6 {
+		t.Errorf("orientation = %d after stripping, want 6", orientation)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("stripped file doesn't decode: %v", err)
+	}
+
+	if _, ok := stripLocation(stripped, "jpeg"); ok {
+		t.Error("stripLocation() of a stripped file removed something")
+	}
+}
+
+func TestStripPNGLocation(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, testImage()); err != nil {
+		t.Fatal(err)
+	}
+
+	chunk := func(chunkType string, content []byte) []byte {
+		data := binary.BigEndian.AppendUint32(nil, uint32(len(content)))
+		data = append(data, chunkType...)
+		data = append(data, content...)
+		return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data[4:]))
+	}
+	// The signature and header chunk take 33 bytes
+	var data []byte
+	data = append(data, encoded.Bytes()[:33]...)
+	data = append(data, chunk("eXIf", testExif())...)
+	data = append(data, chunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"+testXMP))...)
+	data = append(data, chunk("tEXt", []byte("Comment\x00kept"))...)
+	data = append(data, encoded.Bytes()[33:]...)
+
+	stripped, ok := stripLocation(data, "png")
+	if !ok {
+		t.Fatal("stripLocation() removed nothing")
+	}
+	assertNoLocation(t, stripped)
+	if !bytes.Contains(stripped, []byte("eXIf")) || !bytes.Contains(stripped, []byte("Comment\x00kept")) {
+		t.Error("stripLocation() removed chunks without a location")
+	}
+	// The decoder checks the CRC of every chunk
+	if _, err := png.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("stripped file doesn't decode: %v", err)
+	}
+}
+
+func TestStripWebPLocation(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := webp.Encode(&encoded, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	// The simple file is RIFF, size, WEBP and a single VP8L chunk
+	imageChunk := encoded.Bytes()[12:]
+
+	chunk := func(fourCC string, content []byte) []byte {
+		data := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(content)))...)
+		data = append(data, content...)
+		if len(content)%2 == 1 {
+			data = append(data, 0)
+		}
+		return data
+	}
+	for _, exifHeader := range []string{"", "Exif\x00\x00"} {
+		vp8x := make([]byte, 10)
+		vp8x[0] = 0x08 | webpXMPFlag
+		vp8x[4] = 16 - 1
+		vp8x[7] = 8 - 1
+
+		data := []byte("RIFF\x00\x00\x00\x00WEBP")
+		data = append(data, chunk("VP8X", vp8x)...)
+		data = append(data, imageChunk...)
+		data = append(data, chunk("EXIF", append([]byte(exifHeader), testExif()...))...)
+		data = append(data, chunk("XMP ", []byte(testXMP+" "))...)
+		binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+
+		stripped, ok := stripLocation(data, "webp")
+		if !ok {
+			t.Fatalf("stripLocation() with EXIF header %q removed nothing", exifHeader)
+		}
+		assertNoLocation(t, stripped)
+		if size := binary.LittleEndian.Uint32(stripped[4:]); int(size) != len(stripped)-8 {
+			t.Errorf("RIFF size = %d, want %d", size, len(stripped)-8)
+		}
+		if stripped[20]&webpXMPFlag != 0 {
+			t.Error("VP8X chunk still announces XMP metadata")
+		}
+		if _, err := xwebp.Decode(bytes.NewReader(stripped)); err != nil {
+			t.Errorf("stripped file doesn't decode: %v", err)
+		}
+	}
+}
+
+func TestStripLocationKeepsFilesWithout(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	data := encoded.Bytes()
+
+	stripped, ok := stripLocation(data, "png")
+	if ok || !bytes.Equal(stripped, data) {
+		t.Error("stripLocation() changed a file without location data")
+	}
+}
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"github.com/bytetopia/BlankoBlog/backend/internal/webp"
+	"golang.org/x/image/draw"
+	"gorm.io/gorm"
+
+	_ "golang.org/x/image/webp" // Registers the WebP decoder with image.Decode
+)
+
+// Names of the resized copies made of uploaded images
+const (
+	ImageVariantThumbnail = "thumbnail"
+	ImageVariantMedium    = "medium"
+	ImageVariantLarge     = "large"
+)
+
+// maxImagePixels keeps a small file that decodes to a huge image from exhausting memory
+const maxImagePixels = 50_000_000
+
+// imageFormats maps the MIME types of images that get resized copies to their formats.
+// GIFs may be animated and SVGs scale by themselves, so both are served as uploaded.
+var imageFormats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/webp": "webp",
+}
+
+// imageFormatTypes maps image formats to their file extensions and MIME types
+var imageFormatTypes = map[string]struct{ ext, mimeType string }{
+	"jpeg": {".jpg", "image/jpeg"},
+	"png":  {".png", "image/png"},
+	"webp": {".webp", "image/webp"},
+}
+
+// ImageService makes resized copies of uploaded images, so pages can serve each reader a fitting size
+type ImageService struct {
+	db            *gorm.DB
+	configService *ConfigService
+	fileService   *FileService
+}
+
+func NewImageService(db *gorm.DB, configService *ConfigService, fileService *FileService) *ImageService {
+	return &ImageService{
+		db:            db,
+		configService: configService,
+		fileService:   fileService,
+	}
+}
+
+// imageVariantSize is the configured width of a resized copy
+type imageVariantSize struct {
+	name  string
+	width int
+}
+
+// variantSizes returns the configured widths, smallest first
+func (s *ImageService) variantSizes() []imageVariantSize {
+	return []imageVariantSize{
+		{ImageVariantThumbnail, s.configService.GetIntConfig("image_thumbnail_width", 320)},
+		{ImageVariantMedium, s.configService.GetIntConfig("image_medium_width", 800)},
+		{ImageVariantLarge, s.configService.GetIntConfig("image_large_width", 1600)},
+	}
+}
+
+// ProcessImage strips location data from an uploaded image, records its size and makes its
+// resized copies in its own format and WebP, replacing any made before.
+// EXIF orientation is applied to the copies, which carry no metadata at all.
+// Files that are not JPEG, PNG or WebP images are left alone, as are images whose blob was
+// already processed for another file, which only get its size recorded.
+func (s *ImageService) ProcessImage(file *models.File) error {
+	if _, ok := imageFormats[file.MimeType]; !ok {
+		return nil
+	}
+	if file.SHA256 == "" {
+		return fmt.Errorf("invalid image: %s has no content hash, run dedupe-uploads first", file.ServerPath)
+	}
+
+	var processed models.File
+	err := s.db.Where("sha256 = ? AND width > 0 AND id <> ?", file.SHA256, file.ID).First(&processed).Error
+	if err == nil {
+		file.Width, file.Height = processed.Width, processed.Height
+		return s.db.Model(file).Updates(map[string]interface{}{
+			"width":  processed.Width,
+			"height": processed.Height,
+		}).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return s.processBlob(file.SHA256, file.ServerPath, file.MimeType)
+}
+
+// processBlob does the work of ProcessImage for an image blob and records its size on every
+// file using it. The blob keeps the hash of the content as uploaded, so uploading the same
+// image again still finds it after location data was stripped.
+func (s *ImageService) processBlob(hash, serverPath, mimeType string) error {
+	format := imageFormats[mimeType]
+	data, err := s.fileService.readUpload(serverPath)
+	if err != nil {
+		return fmt.Errorf("failed to read image: %w", err)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("invalid image: %w", err)
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return fmt.Errorf("invalid image: %dx%d pixels is too large to resize", config.Width, config.Height)
+	}
+
+	// The original keeps its orientation tag, which browsers apply themselves
+	orientation := 1
+	if format == "jpeg" {
+		orientation = exifOrientation(data)
+	}
+	if stripped, ok := stripLocation(data, format); ok {
+		data = stripped
+		if err := s.fileService.writeUpload(serverPath, data, mimeType); err != nil {
+			return fmt.Errorf("failed to strip location from image: %w", err)
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("invalid image: %w", err)
+	}
+	img = orientImage(img, orientation)
+	bounds := img.Bounds()
+
+	if err := s.fileService.deleteVariants(hash); err != nil {
+		return err
+	}
+
+	variants, err := s.makeVariants(serverPath, img, format)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for i := range variants {
+			variants[i].BlobHash = hash
+			if err := tx.Create(&variants[i]).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.File{}).Where("sha256 = ?", hash).Updates(map[string]interface{}{
+			"width":  bounds.Dx(),
+			"height": bounds.Dy(),
+		}).Error
+	})
+	if err != nil {
+		for _, variant := range variants {
+			s.fileService.removeUpload(variant.ServerPath)
+		}
+		return fmt.Errorf("failed to record image variants: %w", err)
+	}
+
+	return nil
+}
+
+// makeVariants writes the resized copies of an image next to the original.
+// Widths at or above the width of the image are skipped, as images are never enlarged.
+// Lossless WebP copies are only kept when they are smaller than the copy in the original format,
+// so JPEG photos practically never get one.
+func (s *ImageService) makeVariants(serverPath string, img image.Image, format string) ([]models.FileVariant, error) {
+	bounds := img.Bounds()
+	base := strings.TrimSuffix(serverPath, filepath.Ext(serverPath))
+	withWebP := format != "webp" && s.webpEnabled()
+
+	var variants []models.FileVariant
+	cleanup := func() {
+		for _, variant := range variants {
+			s.fileService.removeUpload(variant.ServerPath)
+		}
+	}
+
+	made := make(map[int]bool)
+	for _, size := range s.variantSizes() {
+		if size.width <= 0 || size.width >= bounds.Dx() || made[size.width] {
+			continue
+		}
+		made[size.width] = true
+
+		height := max(1, int(math.Round(float64(bounds.Dy())*float64(size.width)/float64(bounds.Dx()))))
+		resized := image.NewRGBA(image.Rect(0, 0, size.width, height))
+		draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Src, nil)
+
+		encoded, err := s.encodeImage(resized, format)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		variant, err := s.saveVariant(base, size.name, format, encoded, resized)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		variants = append(variants, variant)
+
+		if !withWebP {
+			continue
+		}
+		encodedWebP, err := s.encodeImage(resized, "webp")
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		if len(encodedWebP) >= len(encoded) {
+			continue
+		}
+		variant, err = s.saveVariant(base, size.name, "webp", encodedWebP, resized)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+
+	return variants, nil
+}
+
+// saveVariant writes an encoded copy to disk, named after the original and the variant
+func (s *ImageService) saveVariant(base, name, format string, data []byte, img image.Image) (models.FileVariant, error) {
+	serverPath := base + "-" + name + imageFormatTypes[format].ext
+	if err := s.fileService.writeUpload(serverPath, data, imageFormatTypes[format].mimeType); err != nil {
+		return models.FileVariant{}, fmt.Errorf("failed to save image variant: %w", err)
+	}
+
+	return models.FileVariant{
+		Name:       name,
+		Format:     format,
+		ServerPath: serverPath,
+		Width:      img.Bounds().Dx(),
+		Height:     img.Bounds().Dy(),
+		FileSize:   int64(len(data)),
+		MimeType:   imageFormatTypes[format].mimeType,
+	}, nil
+}
+
+// encodeImage encodes an image in one of the supported formats
+func (s *ImageService) encodeImage(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		quality := min(100, max(1, s.configService.GetIntConfig("image_jpeg_quality", 82)))
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case "png":
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(&buf, img)
+	case "webp":
+		err = webp.Encode(&buf, img)
+	default:
+		err = fmt.Errorf("unsupported image format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// webpEnabled reports whether lossless WebP copies are tried for JPEG and PNG images
+func (s *ImageService) webpEnabled() bool {
+	value, err := s.configService.GetConfig("image_webp")
+	return err == nil && strings.EqualFold(strings.TrimSpace(value), "true")
+}
+
+// ProcessImages makes resized copies of the images that have none yet, such as those
+// uploaded before copies were made on upload. With all set, every image is processed again,
+// which picks up changed widths. It returns the number of images processed.
+func (s *ImageService) ProcessImages(all bool) (int, error) {
+	mimeTypes := make([]string, 0, len(imageFormats))
+	for mimeType := range imageFormats {
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+
+	query := s.db.Where("mime_type IN ?", mimeTypes)
+	if !all {
+		query = query.Where("hash IN (?)", s.db.Model(&models.File{}).Select("sha256").Where("width = 0"))
+	}
+
+	var blobs []models.Blob
+	if err := query.Order("created_at").Find(&blobs).Error; err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for _, blob := range blobs {
+		if err := s.processBlob(blob.Hash, blob.ServerPath, blob.MimeType); err != nil {
+			log.Printf("Warning: failed to process image %s: %v", blob.ServerPath, err)
+			continue
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// ResponsiveImages returns the processed images among the given server paths with their
+// resized copies, smallest first, keyed by server path
+func (s *ImageService) ResponsiveImages(serverPaths []string) (map[string]models.File, error) {
+	var files []models.File
+	err := s.db.Preload("Variants", func(db *gorm.DB) *gorm.DB {
+		return db.Order("width, format")
+	}).Where("server_path IN ? AND width > 0", serverPaths).Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	images := make(map[string]models.File, len(files))
+	for _, file := range files {
+		images[file.ServerPath] = file
+	}
+	return images, nil
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// MailOutboxWorker periodically sends queued email, and right away when new email is queued
+type MailOutboxWorker struct {
+	mailService *MailService
+	interval    time.Duration
+	stop        chan struct{}
+	once        sync.Once
+}
+
+func NewMailOutboxWorker(mailService *MailService, interval time.Duration) *MailOutboxWorker {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	return &MailOutboxWorker{
+		mailService: mailService,
+		interval:    interval,
+		stop:        make(chan struct{}),
+	}
+}
+
+// Start runs the worker in a background goroutine
+func (w *MailOutboxWorker) Start() {
+	go func() {
+		// Send anything left in the outbox while the server was down
+		w.processOutbox()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.processOutbox()
+			case <-w.mailService.Wake():
+				w.processOutbox()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the background worker
+func (w *MailOutboxWorker) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+}
+
+// processOutbox runs a single sending pass and logs the outcome
+func (w *MailOutboxWorker) processOutbox() {
+	count, err := w.mailService.ProcessOutbox()
+	if err != nil {
+		log.Printf("Warning: sending queued email failed: %v", err)
+		return
+	}
+
+	if count > 0 {
+		log.Printf("Sent %d queued email(s)", count)
+	}
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// SMTP TLS modes
+const (
+	SMTPTLSNone     = "none"     // Plain connection, for local mail sinks
+	SMTPTLSStartTLS = "starttls" // Upgrade with STARTTLS, usually on port 587
+	SMTPTLSImplicit = "tls"      // TLS from the start, usually on port 465
+)
+
+// maxMailAttempts is how many times the outbox tries to deliver an email before giving up
+const maxMailAttempts = 6
+
+// smtpTimeout bounds connecting to and talking with the SMTP server
+const smtpTimeout = 30 * time.Second
+
+// ErrMailNotConfigured is returned when no SMTP host is configured
+var ErrMailNotConfigured = errors.New("SMTP is not configured")
+
+// SMTPSettings holds the SMTP server configuration
+type SMTPSettings struct {
+	Host     string
+	Port     int
+	TLSMode  string
+	Username string
+	Password string
+	From     string
+}
+
+// MailService sends email over SMTP through a retrying outbox table
+type MailService struct {
+	db            *gorm.DB
+	configService *ConfigService
+	wake          chan struct{}
+}
+
+func NewMailService(db *gorm.DB, configService *ConfigService) *MailService {
+	return &MailService{
+		db:            db,
+		configService: configService,
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// Settings returns the configured SMTP settings
+func (s *MailService) Settings() SMTPSettings {
+	settings := SMTPSettings{
+		Port:    s.configService.GetIntConfig("smtp_port", 587),
+		TLSMode: SMTPTLSStartTLS,
+	}
+	settings.Host, _ = s.configService.GetConfig("smtp_host")
+	settings.Username, _ = s.configService.GetConfig("smtp_username")
+	settings.Password, _ = s.configService.GetConfig("smtp_password")
+	settings.From, _ = s.configService.GetConfig("smtp_from")
+	if mode, err := s.configService.GetConfig("smtp_tls_mode"); err == nil && mode != "" {
+		settings.TLSMode = strings.ToLower(strings.TrimSpace(mode))
+	}
+
+	settings.Host = strings.TrimSpace(settings.Host)
+	settings.From = strings.TrimSpace(settings.From)
+	return settings
+}
+
+// IsConfigured reports whether an SMTP host and sender address are set
+func (s *MailService) IsConfigured() bool {
+	settings := s.Settings()
+	return settings.Host != "" && settings.From != ""
+}
+
+// Enqueue adds an email to the outbox and wakes the worker to send it
+func (s *MailService) Enqueue(to, subject, body string) error {
+	if !s.IsConfigured() {
+		return ErrMailNotConfigured
+	}
+
+	if _, err := mail.ParseAddress(to); err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", to, err)
+	}
+
+	message := models.MailOutbox{
+		To:            to,
+		Subject:       subject,
+		Body:          body,
+		Status:        "pending",
+		NextAttemptAt: time.Now(),
+	}
+	if err := s.db.Create(&message).Error; err != nil {
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Wake returns a channel that receives when new email is queued
+func (s *MailService) Wake() <-chan struct{} {
+	return s.wake
+}
+
+// ProcessOutbox tries to send every queued email that is due and returns how many were sent
+func (s *MailService) ProcessOutbox() (int, error) {
+	var messages []models.MailOutbox
+	if err := s.db.Where("status = ? AND next_attempt_at <= ?", "pending", time.Now()).
+		Order("next_attempt_at ASC").
+		Limit(50).
+		Find(&messages).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch queued email: %w", err)
+	}
+
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	settings := s.Settings()
+	sent := 0
+	for i := range messages {
+		message := &messages[i]
+		message.Attempts++
+
+		if err := s.send(settings, message.To, message.Subject, message.Body); err != nil {
+			message.LastError = truncateRunes(err.Error(), 500)
+			if message.Attempts >= maxMailAttempts {
+				message.Status = "failed"
+			} else {
+				// Back off 1, 2, 4, 8... minutes between attempts
+				message.NextAttemptAt = time.Now().Add(time.Duration(1<<(message.Attempts-1)) * time.Minute)
+			}
+		} else {
+			now := time.Now()
+			message.Status = "sent"
+			message.SentAt = &now
+			message.LastError = ""
+			sent++
+		}
+
+		if err := s.db.Save(message).Error; err != nil {
+			return sent, fmt.Errorf("failed to update queued email: %w", err)
+		}
+	}
+
+	return sent, nil
+}
+
+// GetOutbox returns queued and sent email, newest first, optionally filtered by status
+func (s *MailService) GetOutbox(page, limit int, status string) ([]models.MailOutbox, int64, error) {
+	var messages []models.MailOutbox
+	var totalCount int64
+
+	query := s.db.Model(&models.MailOutbox{})
+	if status != "" && status != "all" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&totalCount).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count email: %w", err)
+	}
+
+	offset := (page - 1) * limit
+	if err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&messages).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch email: %w", err)
+	}
+
+	return messages, totalCount, nil
+}
+
+// RetryMessage puts a failed email back in the queue
+func (s *MailService) RetryMessage(id uint) error {
+	result := s.db.Model(&models.MailOutbox{}).
+		Where("id = ? AND status <> ?", id, "sent").
+		Updates(map[string]interface{}{
+			"status":          "pending",
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to retry email: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("unsent email with ID %d not found", id)
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// SendTest sends an email right away, bypassing the outbox, so SMTP settings can be checked
+func (s *MailService) SendTest(to string) error {
+	if !s.IsConfigured() {
+		return ErrMailNotConfigured
+	}
+
+	blogName, err := s.configService.GetConfig("blog_name")
+	if err != nil {
+		blogName = "BlankoBlog"
+	}
+
+	return s.send(s.Settings(), to, "["+blogName+"] Test email",
+		"This is a test email from "+blogName+".\n\nYour SMTP settings work.\n")
+}
+
+// send delivers one email over SMTP
+func (s *MailService) send(settings SMTPSettings, to, subject, body string) error {
+	if settings.Host == "" || settings.From == "" {
+		return ErrMailNotConfigured
+	}
+
+	from, err := mail.ParseAddress(settings.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+	recipient, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %w", err)
+	}
+
+	message, err := buildMessage(from, recipient, subject, body)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(settings.Host, strconv.Itoa(settings.Port))
+	tlsConfig := &tls.Config{ServerName: settings.Host}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	switch settings.TLSMode {
+	case SMTPTLSImplicit:
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	case SMTPTLSStartTLS, SMTPTLSNone:
+		conn, err = dialer.Dial("tcp", addr)
+	default:
+		return fmt.Errorf("unknown SMTP TLS mode %q", settings.TLSMode)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, settings.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if settings.TLSMode == SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+
+	if settings.Username != "" {
+		// PlainAuth refuses to send credentials without TLS unless the server is on localhost
+		auth := smtp.PlainAuth("", settings.Username, settings.Password, settings.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	if err := client.Rcpt(recipient.Address); err != nil {
+		return fmt.Errorf("SMTP RCPT TO failed: %w", err)
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := writer.Write(message); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// buildMessage renders a plain text UTF-8 email with quoted-printable body
+func buildMessage(from, to *mail.Address, subject, body string) ([]byte, error) {
+	messageID := make([]byte, 12)
+	if _, err := rand.Read(messageID); err != nil {
+		return nil, fmt.Errorf("failed to generate message ID: %w", err)
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("From: " + from.String() + "\r\n")
+	buf.WriteString("To: " + to.String() + "\r\n")
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("Message-ID: <" + hex.EncodeToString(messageID) + "@" + domain + ">\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+
+	writer := quotedprintable.NewWriter(&buf)
+	if _, err := writer.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/russross/blackfriday/v2"
+)
+
+// defaultHighlightStyle is the code highlighting style used when none is configured
+const defaultHighlightStyle = "github"
+
+// minTOCHeadings is the number of headings a post needs before it gets a table of contents
+const minTOCHeadings = 2
+
+// TOCEntry represents a heading in a post's table of contents
+type TOCEntry struct {
+	Level    int
+	Text     string
+	ID       string
+	Children []TOCEntry
+}
+
+// RenderedMarkdown is the result of rendering a post body
+type RenderedMarkdown struct {
+	HTML string
+	TOC  []TOCEntry
+}
+
+// MarkdownService renders post Markdown to sanitized HTML with server-side
+// syntax highlighting and heading anchors
+type MarkdownService struct {
+	configService *ConfigService
+	sanitizer     *SanitizerService
+	formatter     *chromahtml.Formatter
+}
+
+func NewMarkdownService(configService *ConfigService, sanitizer *SanitizerService) *MarkdownService {
+	return &MarkdownService{
+		configService: configService,
+		sanitizer:     sanitizer,
+		// Classes rather than inline styles, so the sanitizer can keep style attributes out
+		formatter: chromahtml.New(chromahtml.WithClasses(true)),
+	}
+}
+
+// Render converts Markdown to sanitized HTML and builds the table of contents
+func (s *MarkdownService) Render(content string) RenderedMarkdown {
+	parser := blackfriday.New(blackfriday.WithExtensions(blackfriday.CommonExtensions))
+	document := parser.Parse([]byte(content))
+
+	headings := assignHeadingIDs(document)
+
+	renderer := &highlightRenderer{
+		HTMLRenderer: blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+			Flags: blackfriday.CommonHTMLFlags,
+		}),
+		formatter: s.formatter,
+		style:     s.HighlightStyle(),
+	}
+
+	var buf bytes.Buffer
+	renderer.RenderHeader(&buf, document)
+	document.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		return renderer.RenderNode(&buf, node, entering)
+	})
+	renderer.RenderFooter(&buf, document)
+
+	rendered := RenderedMarkdown{HTML: s.sanitizer.SanitizeHTML(buf.String())}
+	if len(headings) >= minTOCHeadings {
+		rendered.TOC = buildTOC(headings)
+	}
+	return rendered
+}
+
+// HighlightStyle returns the name of the configured code highlighting style
+func (s *MarkdownService) HighlightStyle() string {
+	name, err := s.configService.GetConfig("code_highlight_style")
+	if err != nil || styles.Get(name) == styles.Fallback {
+		return defaultHighlightStyle
+	}
+	return name
+}
+
+// HighlightCSS returns the stylesheet for a highlighting style, or the configured one when name is empty
+func (s *MarkdownService) HighlightCSS(name string) (string, error) {
+	if name == "" {
+		name = s.HighlightStyle()
+	}
+	style := styles.Get(name)
+
+	var buf bytes.Buffer
+	if err := s.formatter.WriteCSS(&buf, style); err != nil {
+		return "", fmt.Errorf("failed to generate highlight CSS: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// highlightRenderer is the blackfriday HTML renderer with code blocks highlighted by chroma
+type highlightRenderer struct {
+	*blackfriday.HTMLRenderer
+	formatter *chromahtml.Formatter
+	style     string
+}
+
+// RenderNode renders fenced code blocks with chroma and everything else with the HTML renderer
+func (r *highlightRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	if node.Type != blackfriday.CodeBlock {
+		return r.HTMLRenderer.RenderNode(w, node, entering)
+	}
+
+	language := strings.Fields(string(node.Info))
+	lexer := lexers.Fallback
+	if len(language) > 0 {
+		if match := lexers.Get(language[0]); match != nil {
+			lexer = match
+		}
+	}
+
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, string(node.Literal))
+	if err == nil {
+		err = r.formatter.Format(w, styles.Get(r.style), iterator)
+	}
+	if err != nil {
+		// Fall back to a plain code block
+		return r.HTMLRenderer.RenderNode(w, node, entering)
+	}
+	return blackfriday.GoToNext
+}
+
+// assignHeadingIDs gives every heading a stable anchor derived from its text and returns them in order.
+// Repeated headings get a numeric suffix, e.g. "setup", "setup-1".
+func assignHeadingIDs(document *blackfriday.Node) []TOCEntry {
+	var headings []TOCEntry
+	used := make(map[string]int)
+
+	document.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if !entering || node.Type != blackfriday.Heading {
+			return blackfriday.GoToNext
+		}
+
+		text := headingText(node)
+		id := headingSlug(text)
+		if id == "" {
+			id = "section"
+		}
+		if _, exists := used[id]; exists {
+			// Count on from the last suffix, skipping IDs other headings already took
+			base := id
+			for count := used[base] + 1; ; count++ {
+				id = fmt.Sprintf("%s-%d", base, count)
+				if _, exists := used[id]; !exists {
+					used[base] = count
+					break
+				}
+			}
+		}
+		used[id] = 0
+
+		node.HeadingID = id
+		headings = append(headings, TOCEntry{Level: node.Level, Text: text, ID: id})
+		return blackfriday.SkipChildren
+	})
+
+	return headings
+}
+
+// headingText returns the plain text of a heading
+func headingText(heading *blackfriday.Node) string {
+	var builder strings.Builder
+	heading.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && (node.Type == blackfriday.Text || node.Type == blackfriday.Code) {
+			builder.Write(node.Literal)
+		}
+		return blackfriday.GoToNext
+	})
+	return strings.TrimSpace(builder.String())
+}
+
+// headingSlug turns heading text into an anchor, keeping letters and digits of any script
+func headingSlug(text string) string {
+	var builder strings.Builder
+	lastDash := true
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			builder.WriteRune(r)
+			lastDash = false
+		case !lastDash:
+			builder.WriteRune('-')
+			lastDash = true
+		}
+	}
+	return strings.TrimSuffix(builder.String(), "-")
+}
+
+// buildTOC nests a flat list of headings by level
+func buildTOC(headings []TOCEntry) []TOCEntry {
+	// build collects the headings deeper than parentLevel starting at index
+	var build func(index, parentLevel int) ([]TOCEntry, int)
+	build = func(index, parentLevel int) ([]TOCEntry, int) {
+		var entries []TOCEntry
+		for index < len(headings) && headings[index].Level > parentLevel {
+			entry := headings[index]
+			// Deeper headings that follow belong to this entry, even when a level is skipped
+			entry.Children, index = build(index+1, entry.Level)
+			entries = append(entries, entry)
+		}
+		return entries, index
+	}
+
+	toc, _ := build(0, 0)
+	return toc
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+func TestAssignHeadingIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     []string
+	}{
+		{"unique", "# One\n## Two", []string{"one", "two"}},
+		{"repeated", "# Setup\n# Setup\n# Setup", []string{"setup", "setup-1", "setup-2"}},
+		{"suffix taken by a heading", "# Setup 1\n# Setup\n# Setup", []string{"setup-1", "setup", "setup-2"}},
+		{"suffix taken later", "# Setup\n# Setup\n# Setup 1", []string{"setup", "setup-1", "setup-1-1"}},
+		{"no letters", "# ???\n# !!!", []string{"section", "section-1"}},
+		{"other scripts", "# 安装 步骤", []string{"安装-步骤"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parser := blackfriday.New(blackfriday.WithExtensions(blackfriday.CommonExtensions))
+			headings := assignHeadingIDs(parser.Parse([]byte(test.markdown)))
+			ids := make([]string, len(headings))
+			for i, heading := range headings {
+				ids[i] = heading.ID
+			}
+			if !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("IDs = %q, want %q", ids, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildTOC(t *testing.T) {
+	heading := func(level int, id string, children ...TOCEntry) TOCEntry {
+		return TOCEntry{Level: level, Text: id, ID: id, Children: children}
+	}
+	flat := func(entries ...TOCEntry) []TOCEntry { return entries }
+
+	tests := []struct {
+		name     string
+		headings []TOCEntry
+		want     []TOCEntry
+	}{
+		{"flat", flat(heading(2, "a"), heading(2, "b")), flat(heading(2, "a"), heading(2, "b"))},
+		{"nested", flat(heading(2, "a"), heading(3, "b"), heading(2, "c")),
+			flat(heading(2, "a", heading(3, "b")), heading(2, "c"))},
+		{"skipped level", flat(heading(2, "a"), heading(4, "b"), heading(3, "c")),
+			flat(heading(2, "a", heading(4, "b"), heading(3, "c")))},
+		{"deep then back up", flat(heading(1, "a"), heading(2, "b"), heading(3, "c"), heading(2, "d"), heading(1, "e")),
+			flat(heading(1, "a", heading(2, "b", heading(3, "c")), heading(2, "d")), heading(1, "e"))},
+		{"starts deeper", flat(heading(3, "a"), heading(2, "b"), heading(3, "c")),
+			flat(heading(3, "a"), heading(2, "b", heading(3, "c")))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := buildTOC(test.headings); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("buildTOC() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/bytetopia/BlankoBlog/backend/internal/models"
@@ -21,6 +23,13 @@ func NewPostService(db *gorm.DB) *PostService {
 	}
 }
 
+// PublishedPosts is a GORM scope limiting a query to posts visible to readers.
+// Scheduled posts show up as soon as their publish time has passed, even if the
+// background publisher has not flipped them yet.
+func PublishedPosts(db *gorm.DB) *gorm.DB {
+	return db.Where("(posts.published = ? OR (posts.publish_at IS NOT NULL AND posts.publish_at <= ?))", true, time.Now().UTC())
+}
+
 // GetPosts retrieves posts with pagination
 func (s *PostService) GetPosts(page, limit int, publishedOnly bool) ([]models.Post, int64, error) {
 	var posts []models.Post
@@ -28,7 +37,7 @@ func (s *PostService) GetPosts(page, limit int, publishedOnly bool) ([]models.Po
 
 	query := s.db.Model(&models.Post{})
 	if publishedOnly {
-		query = query.Where("published = ?", true)
+		query = query.Scopes(PublishedPosts)
 	}
 
 	// Count total
@@ -51,7 +60,7 @@ func (s *PostService) GetPostByID(id uint, publishedOnly bool) (*models.Post, er
 	query := s.db.Preload("Tags")
 
 	if publishedOnly {
-		query = query.Where("published = ?", true)
+		query = query.Scopes(PublishedPosts)
 	}
 
 	if err := query.First(&post, id).Error; err != nil {
@@ -67,7 +76,7 @@ func (s *PostService) GetPostBySlug(slug string, publishedOnly bool) (*models.Po
 	query := s.db.Preload("Tags").Where("slug = ?", slug)
 
 	if publishedOnly {
-		query = query.Where("published = ?", true)
+		query = query.Scopes(PublishedPosts)
 	}
 
 	if err := query.First(&post).Error; err != nil {
@@ -79,6 +88,10 @@ func (s *PostService) GetPostBySlug(slug string, publishedOnly bool) (*models.Po
 
 // CreatePost creates a new blog post
 func (s *PostService) CreatePost(req models.CreatePostRequest) (*models.Post, error) {
+	if req.CommentMode != "" && !isCommentMode(req.CommentMode) {
+		return nil, fmt.Errorf("invalid comment mode: %s", req.CommentMode)
+	}
+
 	var slug string
 	
 	// Use user-provided slug if available, otherwise generate from title
@@ -95,11 +108,20 @@ func (s *PostService) CreatePost(req models.CreatePostRequest) (*models.Post, er
 	}
 
 	post := models.Post{
-		Title:     req.Title,
-		Content:   req.Content,
-		Summary:   req.Summary,
-		Slug:      finalSlug,
-		Published: req.Published,
+		Title:       req.Title,
+		Content:     req.Content,
+		Summary:     req.Summary,
+		Slug:        finalSlug,
+		CommentMode: req.CommentMode,
+	}
+	applyPublishState(&post, req.Published, req.PublishAt)
+
+	if req.CoverFileID != nil {
+		coverFileID, err := s.resolveCoverFile(*req.CoverFileID)
+		if err != nil {
+			return nil, err
+		}
+		post.CoverFileID = coverFileID
 	}
 
 	// Set custom created_at if provided
@@ -112,6 +134,10 @@ func (s *PostService) CreatePost(req models.CreatePostRequest) (*models.Post, er
 		return nil, err
 	}
 
+	if err := syncPostFiles(s.db, &post); err != nil {
+		return nil, err
+	}
+
 	// Handle tags if provided
 	if len(req.TagIDs) > 0 {
 		tags, err := s.tagService.GetTagsByIDs(req.TagIDs)
@@ -140,6 +166,14 @@ func (s *PostService) UpdatePost(id uint, req models.UpdatePostRequest) (*models
 		return nil, err
 	}
 
+	// Keep a snapshot of the previous text so the edit can be undone
+	revision := models.PostRevision{
+		PostID:  post.ID,
+		Title:   post.Title,
+		Content: post.Content,
+		Summary: post.Summary,
+	}
+
 	// Update fields if provided
 	if req.Title != nil {
 		post.Title = *req.Title
@@ -167,34 +201,72 @@ func (s *PostService) UpdatePost(id uint, req models.UpdatePostRequest) (*models
 	if req.Summary != nil {
 		post.Summary = *req.Summary
 	}
-	if req.Published != nil {
-		post.Published = *req.Published
+	if req.PublishAt.Set {
+		// An explicit null cancels the schedule, leaving the post as published says
+		published := post.Published
+		if req.Published != nil {
+			published = *req.Published
+		}
+		applyPublishState(&post, published, req.PublishAt.Value)
+	} else if req.Published != nil && *req.Published != post.Published {
+		// Publishing or unpublishing cancels any pending schedule
+		applyPublishState(&post, *req.Published, nil)
+	}
+	if req.CoverFileID != nil {
+		coverFileID, err := s.resolveCoverFile(*req.CoverFileID)
+		if err != nil {
+			return nil, err
+		}
+		post.CoverFileID = coverFileID
+	}
+	if req.CommentMode != nil {
+		if !isCommentMode(*req.CommentMode) {
+			return nil, fmt.Errorf("invalid comment mode: %s", *req.CommentMode)
+		}
+		post.CommentMode = *req.CommentMode
 	}
 	if req.CreatedAt != nil {
 		post.CreatedAt = *req.CreatedAt
 	}
 
-	// Handle tag updates if provided
-	if req.TagIDs != nil {
-		// Clear existing tags
-		if err := s.db.Model(&post).Association("Tags").Clear(); err != nil {
-			return nil, fmt.Errorf("failed to clear existing tags: %w", err)
+	var tags []models.Tag
+	if req.TagIDs != nil && len(*req.TagIDs) > 0 {
+		var err error
+		if tags, err = s.tagService.GetTagsByIDs(*req.TagIDs); err != nil {
+			return nil, fmt.Errorf("failed to get tags: %w", err)
 		}
+	}
 
-		// Add new tags if any provided
-		if len(*req.TagIDs) > 0 {
-			tags, err := s.tagService.GetTagsByIDs(*req.TagIDs)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get tags: %w", err)
+	// Save the revision, the tags and the post together, so a failed save leaves no trace
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if revision.Title != post.Title || revision.Content != post.Content || revision.Summary != post.Summary {
+			if err := tx.Create(&revision).Error; err != nil {
+				return fmt.Errorf("failed to save post revision: %w", err)
 			}
+		}
 
-			if err := s.db.Model(&post).Association("Tags").Append(tags); err != nil {
-				return nil, fmt.Errorf("failed to associate tags: %w", err)
+		// Handle tag updates if provided
+		if req.TagIDs != nil {
+			// Clear existing tags
+			if err := tx.Model(&post).Association("Tags").Clear(); err != nil {
+				return fmt.Errorf("failed to clear existing tags: %w", err)
+			}
+
+			// Add new tags if any provided
+			if len(tags) > 0 {
+				if err := tx.Model(&post).Association("Tags").Append(tags); err != nil {
+					return fmt.Errorf("failed to associate tags: %w", err)
+				}
 			}
 		}
-	}
 
-	if err := s.db.Save(&post).Error; err != nil {
+		if err := tx.Save(&post).Error; err != nil {
+			return err
+		}
+
+		return syncPostFiles(tx, &post)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -206,6 +278,26 @@ func (s *PostService) UpdatePost(id uint, req models.UpdatePostRequest) (*models
 	return &post, nil
 }
 
+// resolveCoverFile checks that a file can be used as a post cover, 0 meaning no cover
+func (s *PostService) resolveCoverFile(fileID uint) (*uint, error) {
+	if fileID == 0 {
+		return nil, nil
+	}
+
+	var file models.File
+	if err := s.db.First(&file, fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("cover file not found")
+		}
+		return nil, fmt.Errorf("failed to fetch cover image: %w", err)
+	}
+	if !strings.HasPrefix(file.MimeType, "image/") {
+		return nil, errors.New("cover file must be an image")
+	}
+
+	return &file.ID, nil
+}
+
 // DeletePost soft deletes a blog post
 func (s *PostService) DeletePost(id uint) error {
 	var post models.Post
@@ -216,6 +308,52 @@ func (s *PostService) DeletePost(id uint) error {
 	return s.db.Delete(&post).Error
 }
 
+// PublishDuePosts publishes every scheduled post whose publish time has passed.
+// The post date is moved to the publish time so it sorts as a fresh post.
+func (s *PostService) PublishDuePosts() (int64, error) {
+	now := time.Now().UTC()
+	result := s.db.Model(&models.Post{}).
+		Where("published = ? AND publish_at IS NOT NULL AND publish_at <= ?", false, now).
+		Updates(map[string]interface{}{
+			"published":    true,
+			"published_at": gorm.Expr("publish_at"),
+			"created_at":   gorm.Expr("publish_at"),
+			"publish_at":   nil,
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to publish scheduled posts: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+// applyPublishState sets the published flag and schedule of a post.
+// A publish time in the future schedules the post and keeps it unpublished;
+// a publish time in the past publishes it right away.
+// Publishing a draft records when it went live.
+func applyPublishState(post *models.Post, published bool, publishAt *time.Time) {
+	wasPublished := post.Published
+	publishedAt := time.Now().UTC()
+
+	if publishAt == nil {
+		post.Published = published
+		post.PublishAt = nil
+	} else if publishAt.After(time.Now()) {
+		// Stored in UTC so SQLite's textual time comparison stays correct
+		scheduled := publishAt.UTC()
+		post.Published = false
+		post.PublishAt = &scheduled
+	} else {
+		post.Published = true
+		post.PublishAt = nil
+		publishedAt = publishAt.UTC()
+	}
+
+	if post.Published && !wasPublished {
+		post.PublishedAt = &publishedAt
+	}
+}
+
 // ensureUniqueSlug ensures the slug is unique by appending a number if needed
 func (s *PostService) ensureUniqueSlug(baseSlug string) (string, error) {
 	slug := baseSlug
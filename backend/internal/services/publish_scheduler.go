@@ -0,0 +1,67 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// PublishScheduler periodically publishes posts whose scheduled time has arrived
+type PublishScheduler struct {
+	postService *PostService
+	interval    time.Duration
+	stop        chan struct{}
+	once        sync.Once
+}
+
+func NewPublishScheduler(postService *PostService, interval time.Duration) *PublishScheduler {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	return &PublishScheduler{
+		postService: postService,
+		interval:    interval,
+		stop:        make(chan struct{}),
+	}
+}
+
+// Start runs the publisher in a background goroutine
+func (s *PublishScheduler) Start() {
+	go func() {
+		// Catch up on anything that became due while the server was down
+		s.publishDuePosts()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.publishDuePosts()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the background publisher
+func (s *PublishScheduler) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+}
+
+// publishDuePosts runs a single publishing pass and logs the outcome
+func (s *PublishScheduler) publishDuePosts() {
+	count, err := s.postService.PublishDuePosts()
+	if err != nil {
+		log.Printf("Warning: scheduled publishing failed: %v", err)
+		return
+	}
+
+	if count > 0 {
+		log.Printf("Published %d scheduled post(s)", count)
+	}
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// maxDiffLines caps the input size of the line diff to keep its running time bounded
+const maxDiffLines = 5000
+
+type RevisionService struct {
+	db          *gorm.DB
+	postService *PostService
+}
+
+func NewRevisionService(db *gorm.DB) *RevisionService {
+	return &RevisionService{
+		db:          db,
+		postService: NewPostService(db),
+	}
+}
+
+// GetRevisions retrieves all revisions of a post, newest first
+func (s *RevisionService) GetRevisions(postID uint) ([]models.PostRevision, error) {
+	// Make sure the post exists so callers can tell "no post" from "no revisions"
+	var post models.Post
+	if err := s.db.First(&post, postID).Error; err != nil {
+		return nil, err
+	}
+
+	var revisions []models.PostRevision
+	if err := s.db.Where("post_id = ?", postID).Order("created_at DESC, id DESC").Find(&revisions).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch revisions: %w", err)
+	}
+
+	return revisions, nil
+}
+
+// GetRevision retrieves a single revision belonging to a post
+func (s *RevisionService) GetRevision(postID, revisionID uint) (*models.PostRevision, error) {
+	var revision models.PostRevision
+	if err := s.db.Where("post_id = ?", postID).First(&revision, revisionID).Error; err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// DiffRevisions computes a line diff between two versions of a post.
+// Each version is either a revision ID or "current" for the live post.
+func (s *RevisionService) DiffRevisions(postID uint, from, to string) (*models.RevisionDiffResponse, error) {
+	fromRevision, err := s.resolveVersion(postID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	toRevision, err := s.resolveVersion(postID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	contentDiff, err := diffLines(fromRevision.Content, toRevision.Content)
+	if err != nil {
+		return nil, err
+	}
+	titleDiff, _ := diffLines(fromRevision.Title, toRevision.Title)
+	summaryDiff, _ := diffLines(fromRevision.Summary, toRevision.Summary)
+
+	return &models.RevisionDiffResponse{
+		From:    from,
+		To:      to,
+		Title:   titleDiff,
+		Summary: summaryDiff,
+		Content: contentDiff,
+	}, nil
+}
+
+// RestoreRevision makes a revision the current version of its post.
+// The replaced version is itself kept as a new revision.
+func (s *RevisionService) RestoreRevision(postID, revisionID uint) (*models.Post, error) {
+	revision, err := s.GetRevision(postID, revisionID)
+	if err != nil {
+		return nil, err
+	}
+
+	post, err := s.postService.GetPostByID(postID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the current slug so restoring a title doesn't break existing links
+	return s.postService.UpdatePost(postID, models.UpdatePostRequest{
+		Title:   &revision.Title,
+		Content: &revision.Content,
+		Summary: &revision.Summary,
+		Slug:    &post.Slug,
+	})
+}
+
+// resolveVersion loads a revision by ID, or the live post for "current"
+func (s *RevisionService) resolveVersion(postID uint, version string) (*models.PostRevision, error) {
+	if version == "" || version == "current" {
+		post, err := s.postService.GetPostByID(postID, false)
+		if err != nil {
+			return nil, err
+		}
+		return &models.PostRevision{
+			PostID:  post.ID,
+			Title:   post.Title,
+			Content: post.Content,
+			Summary: post.Summary,
+		}, nil
+	}
+
+	revisionID, err := strconv.ParseUint(version, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid revision: %s", version)
+	}
+
+	return s.GetRevision(postID, uint(revisionID))
+}
+
+// diffLines computes a line-based diff of two texts using the longest common subsequence
+func diffLines(oldText, newText string) ([]models.DiffLine, error) {
+	oldLines := splitLines(oldText)
+	newLines := splitLines(newText)
+
+	if len(oldLines) > maxDiffLines || len(newLines) > maxDiffLines {
+		return nil, errors.New("text too large to diff")
+	}
+
+	// Trim the common prefix and suffix, which is usually most of a post
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	oldMiddle := oldLines[prefix : len(oldLines)-suffix]
+	newMiddle := newLines[prefix : len(newLines)-suffix]
+
+	result := make([]models.DiffLine, 0, len(oldLines)+len(newLines))
+	for i := 0; i < prefix; i++ {
+		result = append(result, models.DiffLine{Type: "equal", OldLine: i + 1, NewLine: i + 1, Text: oldLines[i]})
+	}
+
+	// Compare lines by number rather than by text
+	ids := make(map[string]int)
+	lineIDs := func(lines []string) []int {
+		numbered := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			numbered[i] = id
+		}
+		return numbered
+	}
+	differ := lineDiffer{
+		oldLines: oldMiddle,
+		newLines: newMiddle,
+		oldIDs:   lineIDs(oldMiddle),
+		newIDs:   lineIDs(newMiddle),
+		offset:   prefix,
+		result:   result,
+	}
+	differ.diff(0, len(oldMiddle), 0, len(newMiddle))
+	result = differ.result
+
+	for k := 0; k < suffix; k++ {
+		oldIndex := len(oldLines) - suffix + k
+		newIndex := len(newLines) - suffix + k
+		result = append(result, models.DiffLine{Type: "equal", OldLine: oldIndex + 1, NewLine: newIndex + 1, Text: oldLines[oldIndex]})
+	}
+
+	return result, nil
+}
+
+// lineDiffer finds a longest common subsequence of two lists of lines with Hirschberg's
+// algorithm, which needs memory linear in the number of lines rather than quadratic
+type lineDiffer struct {
+	oldLines, newLines []string
+	oldIDs, newIDs     []int
+	offset             int // Number of equal lines before the compared ones
+	result             []models.DiffLine
+}
+
+// diff appends the diff of oldLines[oldStart:oldEnd] and newLines[newStart:newEnd] to the result
+func (d *lineDiffer) diff(oldStart, oldEnd, newStart, newEnd int) {
+	switch {
+	case oldStart == oldEnd:
+		for j := newStart; j < newEnd; j++ {
+			d.insert(j)
+		}
+		return
+	case newStart == newEnd:
+		for i := oldStart; i < oldEnd; i++ {
+			d.delete(i)
+		}
+		return
+	case oldEnd-oldStart == 1:
+		for j := newStart; j < newEnd; j++ {
+			if d.oldIDs[oldStart] == d.newIDs[j] {
+				for k := newStart; k < j; k++ {
+					d.insert(k)
+				}
+				d.result = append(d.result, models.DiffLine{Type: "equal", OldLine: d.offset + oldStart + 1, NewLine: d.offset + j + 1, Text: d.oldLines[oldStart]})
+				for k := j + 1; k < newEnd; k++ {
+					d.insert(k)
+				}
+				return
+			}
+		}
+		d.delete(oldStart)
+		for j := newStart; j < newEnd; j++ {
+			d.insert(j)
+		}
+		return
+	}
+
+	// Split the old lines in half and find where the new lines split along a longest common subsequence
+	oldMid := (oldStart + oldEnd) / 2
+	forward := d.lcsLengths(oldStart, oldMid, newStart, newEnd, false)
+	backward := d.lcsLengths(oldMid, oldEnd, newStart, newEnd, true)
+
+	newMid, best := newStart, -1
+	for j := 0; j <= newEnd-newStart; j++ {
+		if length := forward[j] + backward[j]; length > best {
+			newMid, best = newStart+j, length
+		}
+	}
+
+	d.diff(oldStart, oldMid, newStart, newMid)
+	d.diff(oldMid, oldEnd, newMid, newEnd)
+}
+
+// lcsLengths returns, for every j, the LCS length of the old lines and newLines[newStart:newStart+j],
+// or with reverse of the old lines and newLines[newStart+j:newEnd], keeping only two rows
+func (d *lineDiffer) lcsLengths(oldStart, oldEnd, newStart, newEnd int, reverse bool) []int {
+	width := newEnd - newStart
+	previous := make([]int, width+1)
+	current := make([]int, width+1)
+
+	for n := 0; n < oldEnd-oldStart; n++ {
+		i := oldStart + n
+		if reverse {
+			i = oldEnd - 1 - n
+		}
+		for k := 1; k <= width; k++ {
+			j := newStart + k - 1
+			if reverse {
+				j = newEnd - k
+			}
+			if d.oldIDs[i] == d.newIDs[j] {
+				current[k] = previous[k-1] + 1
+			} else {
+				current[k] = max(previous[k], current[k-1])
+			}
+		}
+		previous, current = current, previous
+	}
+
+	if reverse {
+		// Index by where the new lines start rather than by how many are used
+		for left, right := 0, width; left < right; left, right = left+1, right-1 {
+			previous[left], previous[right] = previous[right], previous[left]
+		}
+	}
+	return previous
+}
+
+func (d *lineDiffer) insert(j int) {
+	d.result = append(d.result, models.DiffLine{Type: "insert", NewLine: d.offset + j + 1, Text: d.newLines[j]})
+}
+
+func (d *lineDiffer) delete(i int) {
+	d.result = append(d.result, models.DiffLine{Type: "delete", OldLine: d.offset + i + 1, Text: d.oldLines[i]})
+}
+
+// splitLines splits text into lines, treating an empty text as having no lines
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(text, "\n")
+}
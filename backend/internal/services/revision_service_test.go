@@ -0,0 +1,138 @@
+package services
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+)
+
+func TestDiffLines(t *testing.T) {
+	equal := func(oldLine, newLine int, text string) models.DiffLine {
+		return models.DiffLine{Type: "equal", OldLine: oldLine, NewLine: newLine, Text: text}
+	}
+	insert := func(newLine int, text string) models.DiffLine {
+		return models.DiffLine{Type: "insert", NewLine: newLine, Text: text}
+	}
+	remove := func(oldLine int, text string) models.DiffLine {
+		return models.DiffLine{Type: "delete", OldLine: oldLine, Text: text}
+	}
+
+	tests := []struct {
+		name     string
+		old, new string
+		want     []models.DiffLine
+	}{
+		{"both empty", "", "", []models.DiffLine{}},
+		{"identical", "a\nb", "a\nb", []models.DiffLine{equal(1, 1, "a"), equal(2, 2, "b")}},
+		{"windows line endings", "a\r\nb", "a\nb", []models.DiffLine{equal(1, 1, "a"), equal(2, 2, "b")}},
+		{"from empty", "", "a\nb", []models.DiffLine{insert(1, "a"), insert(2, "b")}},
+		{"to empty", "a\nb", "", []models.DiffLine{remove(1, "a"), remove(2, "b")}},
+		{"insert in the middle", "a\nc", "a\nb\nc", []models.DiffLine{equal(1, 1, "a"), insert(2, "b"), equal(2, 3, "c")}},
+		{"delete in the middle", "a\nb\nc", "a\nc", []models.DiffLine{equal(1, 1, "a"), remove(2, "b"), equal(3, 2, "c")}},
+		{"replace between common prefix and suffix", "head\nold\ntail", "head\nnew\ntail", []models.DiffLine{
+			equal(1, 1, "head"), remove(2, "old"), insert(2, "new"), equal(3, 3, "tail"),
+		}},
+		{"append", "a", "a\nb", []models.DiffLine{equal(1, 1, "a"), insert(2, "b")}},
+		{"prepend", "b", "a\nb", []models.DiffLine{insert(1, "a"), equal(1, 2, "b")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := diffLines(test.old, test.new)
+			if err != nil {
+				t.Fatalf("diffLines() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("diffLines(%q, %q) = %+v, want %+v", test.old, test.new, got, test.want)
+			}
+		})
+	}
+}
+
+// TestDiffLinesRandom checks random diffs rebuild both texts and keep as many lines as a
+// longest common subsequence has
+func TestDiffLinesRandom(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	randomText := func() []string {
+		lines := make([]string, random.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + random.Intn(4)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 500; i++ {
+		oldLines, newLines := randomText(), randomText()
+		diff, err := diffLines(strings.Join(oldLines, "\n"), strings.Join(newLines, "\n"))
+		if err != nil {
+			t.Fatalf("diffLines() error: %v", err)
+		}
+		var rebuiltOld, rebuiltNew []string
+		equal := 0
+		for _, line := range diff {
+			switch line.Type {
+			case "equal":
+				equal++
+				if line.OldLine != len(rebuiltOld)+1 || line.NewLine != len(rebuiltNew)+1 {
+					t.Fatalf("equal line numbered %d/%d, want %d/%d", line.OldLine, line.NewLine, len(rebuiltOld)+1, len(rebuiltNew)+1)
+				}
+				rebuiltOld = append(rebuiltOld, line.Text)
+				rebuiltNew = append(rebuiltNew, line.Text)
+			case "delete":
+				if line.OldLine != len(rebuiltOld)+1 {
+					t.Fatalf("deleted line numbered %d, want %d", line.OldLine, len(rebuiltOld)+1)
+				}
+				rebuiltOld = append(rebuiltOld, line.Text)
+			case "insert":
+				if line.NewLine != len(rebuiltNew)+1 {
+					t.Fatalf("inserted line numbered %d, want %d", line.NewLine, len(rebuiltNew)+1)
+				}
+				rebuiltNew = append(rebuiltNew, line.Text)
+			}
+		}
+
+		if strings.Join(rebuiltOld, "\n") != strings.Join(oldLines, "\n") || strings.Join(rebuiltNew, "\n") != strings.Join(newLines, "\n") {
+			t.Fatalf("diff of %q and %q doesn't rebuild them: %+v", oldLines, newLines, diff)
+		}
+		if want := lcsLength(oldLines, newLines); equal != want {
+			t.Fatalf("diff of %q and %q keeps %d lines, want %d", oldLines, newLines, equal, want)
+		}
+	}
+}
+
+func TestDiffLinesTooLarge(t *testing.T) {
+	atLimit := strings.Repeat("line\n", maxDiffLines-1) + "line"
+	changed := strings.Repeat("line\nother\n", maxDiffLines/2-1) + "line\nother"
+	if _, err := diffLines(atLimit, changed); err != nil {
+		t.Errorf("diffLines() of %d lines error: %v", maxDiffLines, err)
+	}
+
+	overLimit := atLimit + "\nline"
+	if _, err := diffLines(overLimit, "a"); err == nil {
+		t.Error("diffLines() of an old text over the limit succeeded, want an error")
+	}
+	if _, err := diffLines("a", overLimit); err == nil {
+		t.Error("diffLines() of a new text over the limit succeeded, want an error")
+	}
+}
+
+// lcsLength is the textbook quadratic longest common subsequence length
+func lcsLength(a, b []string) int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				lengths[i][j] = lengths[i-1][j-1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i-1][j], lengths[i][j-1])
+			}
+		}
+	}
+	return lengths[len(a)][len(b)]
+}
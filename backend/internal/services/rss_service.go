@@ -1,6 +1,7 @@
 package services
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"html"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"github.com/russross/blackfriday/v2"
 	"gorm.io/gorm"
 )
 
@@ -41,45 +43,124 @@ type Item struct {
 	Category    []string `xml:"category,omitempty"`
 }
 
+// Atom structs following the Atom 1.0 specification (RFC 4287)
+type AtomFeed struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Subtitle  string      `xml:"subtitle,omitempty"`
+	Updated   string      `xml:"updated"`
+	Links     []AtomLink  `xml:"link"`
+	Author    AtomPerson  `xml:"author"`
+	Generator string      `xml:"generator"`
+	Entries   []AtomEntry `xml:"entry"`
+}
+
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+type AtomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type AtomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type AtomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       AtomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Summary    *AtomText      `xml:"summary,omitempty"`
+	Content    *AtomText      `xml:"content,omitempty"`
+	Categories []AtomCategory `xml:"category,omitempty"`
+}
+
+// JSON Feed structs following the JSON Feed 1.1 specification
+type JSONFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Description string           `json:"description,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Authors     []JSONFeedAuthor `json:"authors,omitempty"`
+	Items       []JSONFeedItem   `json:"items"`
+}
+
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type JSONFeedItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	Title         string   `json:"title"`
+	ContentHTML   string   `json:"content_html,omitempty"`
+	ContentText   string   `json:"content_text,omitempty"`
+	Summary       string   `json:"summary,omitempty"`
+	DatePublished string   `json:"date_published"`
+	DateModified  string   `json:"date_modified"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// feedInfo holds the channel-level metadata shared by all feed formats
+type feedInfo struct {
+	Title       string
+	Description string
+	Language    string
+	Author      string
+	Updated     time.Time
+	PagePath    string // Path of the HTML page the feed mirrors, e.g. "/" or "/tags/1/posts"
+	FeedPath    string // Prefix of the feed URLs, e.g. "" or "/tags/1"
+}
+
 type RSSService struct {
 	db            *gorm.DB
 	configService *ConfigService
+	sanitizer     *SanitizerService
 }
 
 func NewRSSService(db *gorm.DB, configService *ConfigService) *RSSService {
 	return &RSSService{
 		db:            db,
 		configService: configService,
+		sanitizer:     NewSanitizerService(configService),
 	}
 }
 
-// GenerateRSSFeed generates RSS XML feed for published posts
-func (s *RSSService) GenerateRSSFeed(baseURL string, limit int) (string, error) {
-	// Get site configuration
-	configs, err := s.configService.GetAllConfigs()
-	if err != nil {
-		return "", fmt.Errorf("failed to get site configs: %w", err)
+// UseFullContent resolves the feed content mode from a request value ("full" or "summary"),
+// falling back to the feed_content site setting
+func (s *RSSService) UseFullContent(mode string) bool {
+	if mode == "" {
+		mode, _ = s.configService.GetConfig("feed_content")
 	}
+	return mode == "full"
+}
 
-	// Set defaults if configs are empty
-	siteName := getConfigFromMap(configs, "site_name", "Blog")
-	siteDescription := getConfigFromMap(configs, "site_description", "A Blog Site")
-	
-	// Get recent published posts
-	var posts []models.Post
-	if err := s.db.Where("published = ?", true).
-		Preload("Tags").
-		Order("created_at DESC").
-		Limit(limit).
-		Find(&posts).Error; err != nil {
-		return "", fmt.Errorf("failed to fetch posts: %w", err)
+// GenerateRSSFeed generates RSS XML feed for published posts.
+// A non-zero tagID restricts the feed to posts with that tag.
+func (s *RSSService) GenerateRSSFeed(baseURL string, tagID uint, limit int, fullContent bool) (string, error) {
+	info, posts, err := s.loadFeed(tagID, limit)
+	if err != nil {
+		return "", err
 	}
 
 	// Build RSS feed
 	channel := Channel{
-		Title:         siteName,
-		Link:          baseURL,
-		Description:   siteDescription,
+		Title:         info.Title,
+		Link:          baseURL + info.PagePath,
+		Description:   info.Description,
 		Language:      "en-us",
 		LastBuildDate: time.Now().Format(time.RFC1123Z),
 		PubDate:       time.Now().Format(time.RFC1123Z),
@@ -90,12 +171,17 @@ func (s *RSSService) GenerateRSSFeed(baseURL string, limit int) (string, error)
 
 	// Add posts as RSS items
 	for _, post := range posts {
+		description := html.EscapeString(s.generateDescription(post))
+		if fullContent {
+			description = s.renderFeedContent(post)
+		}
+
 		item := Item{
 			Title:       html.EscapeString(post.Title),
-			Link:        fmt.Sprintf("%s/posts/%s", baseURL, post.Slug),
-			Description: html.EscapeString(s.generateDescription(post)),
+			Link:        postURL(baseURL, post),
+			Description: description,
 			PubDate:     post.CreatedAt.Format(time.RFC1123Z),
-			GUID:        fmt.Sprintf("%s/posts/%s", baseURL, post.Slug),
+			GUID:        postURL(baseURL, post),
 		}
 
 		// Add tags as categories
@@ -123,6 +209,154 @@ func (s *RSSService) GenerateRSSFeed(baseURL string, limit int) (string, error)
 	return xmlString, nil
 }
 
+// GenerateAtomFeed generates an Atom 1.0 XML feed for published posts.
+// A non-zero tagID restricts the feed to posts with that tag.
+func (s *RSSService) GenerateAtomFeed(baseURL string, tagID uint, limit int, fullContent bool) (string, error) {
+	info, posts, err := s.loadFeed(tagID, limit)
+	if err != nil {
+		return "", err
+	}
+
+	feed := AtomFeed{
+		ID:       baseURL + info.PagePath,
+		Title:    info.Title,
+		Subtitle: info.Description,
+		Updated:  info.Updated.UTC().Format(time.RFC3339),
+		Links: []AtomLink{
+			{Href: baseURL + info.FeedPath + "/atom.xml", Rel: "self", Type: "application/atom+xml"},
+			{Href: baseURL + info.PagePath, Rel: "alternate", Type: "text/html"},
+		},
+		Author:    AtomPerson{Name: info.Author},
+		Generator: "BlankoBlog",
+		Entries:   make([]AtomEntry, 0, len(posts)),
+	}
+
+	for _, post := range posts {
+		entry := AtomEntry{
+			ID:        postURL(baseURL, post),
+			Title:     post.Title,
+			Link:      AtomLink{Href: postURL(baseURL, post), Rel: "alternate", Type: "text/html"},
+			Published: post.CreatedAt.UTC().Format(time.RFC3339),
+			Updated:   post.UpdatedAt.UTC().Format(time.RFC3339),
+			Summary:   &AtomText{Type: "text", Body: s.generateDescription(post)},
+		}
+		if fullContent {
+			entry.Content = &AtomText{Type: "html", Body: s.renderFeedContent(post)}
+		}
+
+		for _, tag := range post.Tags {
+			entry.Categories = append(entry.Categories, AtomCategory{Term: tag.Name})
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	xmlData, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal Atom XML: %w", err)
+	}
+
+	return xml.Header + string(xmlData), nil
+}
+
+// GenerateJSONFeed generates a JSON Feed 1.1 document for published posts.
+// A non-zero tagID restricts the feed to posts with that tag.
+func (s *RSSService) GenerateJSONFeed(baseURL string, tagID uint, limit int, fullContent bool) ([]byte, error) {
+	info, posts, err := s.loadFeed(tagID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := JSONFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       info.Title,
+		HomePageURL: baseURL + info.PagePath,
+		FeedURL:     baseURL + info.FeedPath + "/feed.json",
+		Description: info.Description,
+		Language:    info.Language,
+		Authors:     []JSONFeedAuthor{{Name: info.Author}},
+		Items:       make([]JSONFeedItem, 0, len(posts)),
+	}
+
+	for _, post := range posts {
+		item := JSONFeedItem{
+			ID:            postURL(baseURL, post),
+			URL:           postURL(baseURL, post),
+			Title:         post.Title,
+			DatePublished: post.CreatedAt.UTC().Format(time.RFC3339),
+			DateModified:  post.UpdatedAt.UTC().Format(time.RFC3339),
+		}
+		if fullContent {
+			item.ContentHTML = s.renderFeedContent(post)
+			item.Summary = s.generateDescription(post)
+		} else {
+			item.ContentText = s.generateDescription(post)
+		}
+
+		for _, tag := range post.Tags {
+			item.Tags = append(item.Tags, tag.Name)
+		}
+
+		feed.Items = append(feed.Items, item)
+	}
+
+	jsonData, err := json.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON feed: %w", err)
+	}
+
+	return jsonData, nil
+}
+
+// loadFeed fetches the channel metadata and the most recent published posts,
+// limited to a single tag when tagID is non-zero
+func (s *RSSService) loadFeed(tagID uint, limit int) (*feedInfo, []models.Post, error) {
+	// Get site configuration
+	configs, err := s.configService.GetAllConfigs()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get site configs: %w", err)
+	}
+
+	blogName := getConfigFromMap(configs, "blog_name", "Blog")
+	info := &feedInfo{
+		Title:       blogName,
+		Description: getConfigFromMap(configs, "blog_description", "A Blog Site"),
+		Language:    getConfigFromMap(configs, "language", "en"),
+		Author:      blogName,
+		PagePath:    "/",
+	}
+
+	query := s.db.Scopes(PublishedPosts)
+	if tagID != 0 {
+		var tag models.Tag
+		if err := s.db.First(&tag, tagID).Error; err != nil {
+			return nil, nil, err
+		}
+
+		info.Title = fmt.Sprintf("%s - %s", blogName, tag.Name)
+		info.Description = fmt.Sprintf("Posts tagged %s on %s", tag.Name, blogName)
+		info.PagePath = fmt.Sprintf("/tags/%d/posts", tag.ID)
+		info.FeedPath = fmt.Sprintf("/tags/%d", tag.ID)
+
+		query = query.Joins("JOIN post_tags ON post_tags.post_id = posts.id").
+			Where("post_tags.tag_id = ?", tag.ID)
+	}
+
+	// Get recent published posts
+	var posts []models.Post
+	if err := query.
+		Preload("Tags").
+		Order("posts.created_at DESC").
+		Limit(limit).
+		Find(&posts).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch posts: %w", err)
+	}
+
+	info.Updated = latestUpdate(posts)
+
+	return info, posts, nil
+}
+
 // generateDescription creates a description for RSS item
 func (s *RSSService) generateDescription(post models.Post) string {
 	// Use summary if available
@@ -145,6 +379,30 @@ func (s *RSSService) generateDescription(post models.Post) string {
 	return content
 }
 
+// renderFeedContent renders the full post body as sanitized HTML for feed readers
+func (s *RSSService) renderFeedContent(post models.Post) string {
+	return s.sanitizer.SanitizeHTML(string(blackfriday.Run([]byte(post.Content))))
+}
+
+// postURL returns the permalink of a post
+func postURL(baseURL string, post models.Post) string {
+	return fmt.Sprintf("%s/posts/%s", baseURL, post.Slug)
+}
+
+// latestUpdate returns the most recent modification time among posts
+func latestUpdate(posts []models.Post) time.Time {
+	var latest time.Time
+	for _, post := range posts {
+		if post.UpdatedAt.After(latest) {
+			latest = post.UpdatedAt
+		}
+	}
+	if latest.IsZero() {
+		latest = time.Now()
+	}
+	return latest
+}
+
 // stripHTMLTags removes HTML tags from content
 func stripHTMLTags(content string) string {
 	// Simple HTML tag removal - could be enhanced with a proper HTML parser
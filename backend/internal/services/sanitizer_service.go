@@ -0,0 +1,332 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/css/scanner"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// allowedCSSAtRules lists the at-rules custom CSS may use. Others, such as @import, are removed
+// with their prelude and block.
+var allowedCSSAtRules = map[string]bool{
+	"@media":               true,
+	"@supports":            true,
+	"@container":           true,
+	"@layer":               true,
+	"@font-face":           true,
+	"@keyframes":           true,
+	"@-webkit-keyframes":   true,
+	"@page":                true,
+	"@counter-style":       true,
+	"@font-feature-values": true,
+}
+
+// cssURLFunctions take URLs as string arguments, besides url() itself
+var cssURLFunctions = map[string]bool{
+	"src":               true,
+	"image":             true,
+	"image-set":         true,
+	"-webkit-image-set": true,
+	"cross-fade":        true,
+}
+
+// unsafeCSSFunctions and unsafeCSSIdents are legacy CSS features that run script or load behaviors
+var (
+	unsafeCSSFunctions = map[string]bool{"expression": true}
+	unsafeCSSIdents    = map[string]bool{"behavior": true, "-moz-binding": true}
+)
+
+// SanitizerService cleans user-authored HTML and CSS before it is rendered on public pages.
+// The HTML allowlist is derived from the site configuration and rebuilt when it changes.
+type SanitizerService struct {
+	configService *ConfigService
+
+	mu          sync.Mutex
+	policy      *bluemonday.Policy
+	iframeHosts string // Config value the current policy was built from
+}
+
+func NewSanitizerService(configService *ConfigService) *SanitizerService {
+	return &SanitizerService{
+		configService: configService,
+	}
+}
+
+// SanitizeHTML removes every element and attribute not on the allowlist from rendered post HTML
+func (s *SanitizerService) SanitizeHTML(html string) string {
+	return s.currentPolicy().Sanitize(html)
+}
+
+// currentPolicy returns the policy for the configured iframe hosts, rebuilding it if they changed
+func (s *SanitizerService) currentPolicy() *bluemonday.Policy {
+	iframeHosts, err := s.configService.GetConfig("allowed_iframe_hosts")
+	if err != nil {
+		iframeHosts = ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.policy == nil || iframeHosts != s.iframeHosts {
+		s.policy = newContentPolicy(parseHostList(iframeHosts))
+		s.iframeHosts = iframeHosts
+	}
+	return s.policy
+}
+
+// newContentPolicy builds the allowlist for post content: the common formatting,
+// link, image and table elements of user generated content, and iframes only from the given hosts
+func newContentPolicy(iframeHosts []string) *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+
+	// Links in posts are written by the blog's authors, so they don't need rel="nofollow"
+	policy.RequireNoFollowOnLinks(false)
+
+	policy.AllowAttrs("loading").Matching(regexp.MustCompile(`^(lazy|eager)$`)).OnElements("img", "iframe")
+	policy.AllowAttrs("id").Matching(regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-zA-Z0-9_ -]+$`)).OnElements("pre", "code", "span", "div")
+
+	if len(iframeHosts) > 0 {
+		quoted := make([]string, len(iframeHosts))
+		for i, host := range iframeHosts {
+			quoted[i] = regexp.QuoteMeta(host)
+		}
+		iframeSrc := regexp.MustCompile(`^https://(` + strings.Join(quoted, "|") + `)(/|$)`)
+
+		policy.AllowElements("iframe")
+		policy.AllowAttrs("src").Matching(iframeSrc).OnElements("iframe")
+		policy.AllowAttrs("width", "height").Matching(bluemonday.NumberOrPercent).OnElements("iframe")
+		policy.AllowAttrs("title", "allow", "allowfullscreen", "frameborder", "referrerpolicy").OnElements("iframe")
+	}
+
+	return policy
+}
+
+// parseHostList splits a comma or whitespace separated list of host names
+func parseHostList(value string) []string {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+
+	hosts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		host := strings.ToLower(strings.TrimSpace(field))
+		host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+		host = strings.TrimSuffix(host, "/")
+		if host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// SanitizeCSS neutralizes custom CSS so it can't close the surrounding style element, load
+// other style sheets or run script. The CSS is tokenized and escapes are decoded before names
+// and URLs are checked, so "@\69mport" is caught like "@import". Only the at-rules in
+// allowedCSSAtRules are kept, and URLs must be relative or use http, https or data:image.
+func SanitizeCSS(css string) string {
+	var out strings.Builder
+	var functions []string // Open functions and parentheses, innermost last
+	tokens := scanner.New(css)
+
+	for {
+		token := tokens.Next()
+		switch token.Type {
+		case scanner.TokenEOF, scanner.TokenError:
+			// An unclosed string or comment drops the rest, as browsers would read it differently.
+			// "<" has no meaning in CSS outside of strings, where the escape keeps its value.
+			return strings.ReplaceAll(out.String(), "<", `\3c `)
+
+		case scanner.TokenAtKeyword:
+			if !allowedCSSAtRules[strings.ToLower(decodeCSSEscapes(token.Value))] {
+				skipCSSAtRule(tokens)
+				out.WriteString("/* removed */")
+				continue
+			}
+
+		case scanner.TokenFunction:
+			name := strings.ToLower(decodeCSSEscapes(strings.TrimSuffix(token.Value, "(")))
+			if name == "url" {
+				// Browsers also read "URL(" and "u\72l(" as url(), which the scanner doesn't
+				arguments := readCSSArguments(tokens)
+				if !safeCSSURL(cssStringValue(strings.TrimSpace(arguments))) {
+					out.WriteString(`url("")`)
+				} else {
+					out.WriteString(token.Value + arguments + ")")
+				}
+				continue
+			}
+			functions = append(functions, name)
+			if unsafeCSSFunctions[name] {
+				out.WriteString("/* removed */(")
+				continue
+			}
+
+		case scanner.TokenChar:
+			switch token.Value {
+			case "(":
+				functions = append(functions, "")
+			case ")":
+				if len(functions) > 0 {
+					functions = functions[:len(functions)-1]
+				}
+			}
+
+		case scanner.TokenIdent:
+			if unsafeCSSIdents[strings.ToLower(decodeCSSEscapes(token.Value))] {
+				out.WriteString("/* removed */")
+				continue
+			}
+
+		case scanner.TokenURI:
+			value := strings.TrimSuffix(strings.TrimPrefix(token.Value, "url("), ")")
+			if !safeCSSURL(cssStringValue(strings.TrimSpace(value))) {
+				out.WriteString(`url("")`)
+				continue
+			}
+
+		case scanner.TokenString:
+			if len(functions) > 0 && cssURLFunctions[functions[len(functions)-1]] && !safeCSSURL(cssStringValue(token.Value)) {
+				out.WriteString(`""`)
+				continue
+			}
+		}
+
+		out.WriteString(token.Value)
+	}
+}
+
+// skipCSSAtRule consumes the rest of an at-rule: its prelude up to a semicolon, or its block
+func skipCSSAtRule(tokens *scanner.Scanner) {
+	depth := 0
+	for {
+		token := tokens.Next()
+		if token.Type == scanner.TokenEOF || token.Type == scanner.TokenError {
+			return
+		}
+		if token.Type != scanner.TokenChar {
+			continue
+		}
+		switch token.Value {
+		case ";":
+			if depth == 0 {
+				return
+			}
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth <= 0 {
+				return
+			}
+		}
+	}
+}
+
+// readCSSArguments consumes the arguments of a function up to its closing parenthesis
+// and returns them as written
+func readCSSArguments(tokens *scanner.Scanner) string {
+	var arguments strings.Builder
+	depth := 0
+	for {
+		token := tokens.Next()
+		switch {
+		case token.Type == scanner.TokenEOF || token.Type == scanner.TokenError:
+			return arguments.String()
+		case token.Type == scanner.TokenFunction || token.Value == "(":
+			depth++
+		case token.Type == scanner.TokenChar && token.Value == ")":
+			if depth == 0 {
+				return arguments.String()
+			}
+			depth--
+		}
+		arguments.WriteString(token.Value)
+	}
+}
+
+// cssStringValue returns the decoded value of a CSS string, or of unquoted text
+func cssStringValue(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	return decodeCSSEscapes(value)
+}
+
+// decodeCSSEscapes replaces CSS escapes such as "\69" and "\i" with the characters they stand for
+func decodeCSSEscapes(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+
+	var decoded strings.Builder
+	for i := 0; i < len(value); {
+		if value[i] != '\\' {
+			r, size := utf8.DecodeRuneInString(value[i:])
+			decoded.WriteRune(r)
+			i += size
+			continue
+		}
+
+		i++
+		end := i
+		for end < len(value) && end-i < 6 && isHexDigit(value[end]) {
+			end++
+		}
+		switch {
+		case end > i:
+			code, _ := strconv.ParseUint(value[i:end], 16, 32)
+			r := rune(code)
+			if r == 0 || r > unicode.MaxRune || (r >= 0xD800 && r <= 0xDFFF) {
+				r = utf8.RuneError
+			}
+			decoded.WriteRune(r)
+			i = end
+			// A single white space ends a hex escape and belongs to it
+			if i < len(value) && (value[i] == ' ' || value[i] == '\t' || value[i] == '\n') {
+				i++
+			}
+		case i < len(value) && value[i] == '\n':
+			// An escaped newline continues a string on the next line
+			i++
+		case i < len(value):
+			r, size := utf8.DecodeRuneInString(value[i:])
+			decoded.WriteRune(r)
+			i += size
+		}
+	}
+	return decoded.String()
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// safeCSSURL reports whether a URL in CSS is relative or uses a scheme that can't run script
+func safeCSSURL(value string) bool {
+	// Browsers ignore white space and control characters in URLs, as in "java\tscript:"
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, value)
+
+	scheme, rest, found := strings.Cut(value, ":")
+	if !found || strings.ContainsAny(scheme, "/?#") {
+		return true
+	}
+	switch strings.ToLower(scheme) {
+	case "http", "https":
+		return true
+	case "data":
+		return strings.HasPrefix(strings.ToLower(rest), "image/")
+	}
+	return false
+}
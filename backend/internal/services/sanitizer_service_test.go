@@ -0,0 +1,189 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContentPolicyRemovesXSSVectors(t *testing.T) {
+	policy := newContentPolicy(nil)
+
+	tests := []struct {
+		name      string
+		input     string
+		forbidden []string
+	}{
+		{"script element", `<p>hi</p><script>alert(1)</script>`, []string{"<script", "alert"}},
+		{"script with odd case", `<ScRiPt>alert(1)</sCrIpT>`, []string{"<script", "alert"}},
+		{"event handler", `<img src="/a.png" onerror="alert(1)">`, []string{"onerror", "alert"}},
+		{"javascript link", `<a href="javascript:alert(1)">x</a>`, []string{"javascript:"}},
+		{"mixed case javascript link", `<a href="JaVaScRiPt:alert(1)">x</a>`, []string{"javascript", "JaVaScRiPt"}},
+		{"entity encoded javascript link", `<a href="&#106;avascript:alert(1)">x</a>`, []string{"avascript:"}},
+		{"vbscript link", `<a href="vbscript:msgbox(1)">x</a>`, []string{"vbscript:"}},
+		{"data html link", `<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">x</a>`, []string{"data:"}},
+		{"svg onload", `<svg onload="alert(1)"><circle r="1"/></svg>`, []string{"<svg", "onload"}},
+		{"math xlink", `<math><mi xlink:href="javascript:alert(1)">x</mi></math>`, []string{"xlink", "javascript:"}},
+		{"iframe without allowed hosts", `<iframe src="https://www.youtube.com/embed/x"></iframe>`, []string{"<iframe"}},
+		{"object", `<object data="https://evil.example/x.swf"></object>`, []string{"<object"}},
+		{"embed", `<embed src="https://evil.example/x.swf">`, []string{"<embed"}},
+		{"style element", `<style>body{background:red}</style>`, []string{"<style"}},
+		{"style attribute", `<p style="background:url(javascript:alert(1))">x</p>`, []string{"style=", "javascript:"}},
+		{"form", `<form action="https://evil.example/"><input name="password"></form>`, []string{"<form", "<input"}},
+		{"meta refresh", `<meta http-equiv="refresh" content="0;url=https://evil.example/">`, []string{"<meta"}},
+		{"base", `<base href="https://evil.example/">`, []string{"<base"}},
+		{"class with markup", `<code class="x&quot; onmouseover=&quot;alert(1)">x</code>`, []string{"onmouseover"}},
+		{"heading id with markup", `<h2 id="x&quot;><script>">x</h2>`, []string{"<script"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := policy.Sanitize(test.input)
+			for _, forbidden := range test.forbidden {
+				if strings.Contains(output, forbidden) {
+					t.Errorf("Sanitize(%q) = %q, contains %q", test.input, output, forbidden)
+				}
+			}
+		})
+	}
+}
+
+func TestContentPolicyKeepsPostMarkup(t *testing.T) {
+	policy := newContentPolicy(nil)
+
+	tests := []string{
+		`<h2 id="getting-started">Getting started</h2>`,
+		`<p><a href="https://example.com/">link</a> and <a href="/posts/hello">relative</a></p>`,
+		`<p><img src="/uploads/a.png" alt="A" loading="lazy"></p>`,
+		`<pre class="chroma"><code class="language-go"><span class="kw">func</span></code></pre>`,
+		`<table><thead><tr><th>a</th></tr></thead><tbody><tr><td>1</td></tr></tbody></table>`,
+		`<blockquote><p><strong>bold</strong> <em>italic</em> <del>gone</del></p></blockquote>`,
+	}
+
+	for _, input := range tests {
+		if output := policy.Sanitize(input); output != input {
+			t.Errorf("Sanitize(%q) = %q, want it unchanged", input, output)
+		}
+	}
+}
+
+func TestContentPolicyIframeHosts(t *testing.T) {
+	policy := newContentPolicy([]string{"www.youtube.com", "player.vimeo.com"})
+
+	tests := []struct {
+		input string
+		kept  bool
+	}{
+		{`<iframe src="https://www.youtube.com/embed/abc" width="560" height="315" allowfullscreen></iframe>`, true},
+		{`<iframe src="https://player.vimeo.com/video/1"></iframe>`, true},
+		{`<iframe src="https://www.youtube.com"></iframe>`, true},
+		{`<iframe src="http://www.youtube.com/embed/abc"></iframe>`, false},
+		{`<iframe src="https://www.youtube.com.evil.example/embed/abc"></iframe>`, false},
+		{`<iframe src="https://evil.example/?https://www.youtube.com/"></iframe>`, false},
+		{`<iframe src="javascript:alert(1)"></iframe>`, false},
+		{`<iframe srcdoc="&lt;script&gt;alert(1)&lt;/script&gt;"></iframe>`, false},
+	}
+
+	for _, test := range tests {
+		output := policy.Sanitize(test.input)
+		kept := strings.Contains(output, "src=")
+		if kept != test.kept {
+			t.Errorf("Sanitize(%q) = %q, kept source %v, want %v", test.input, output, kept, test.kept)
+		}
+		if strings.Contains(output, "onload") || strings.Contains(output, "srcdoc") {
+			t.Errorf("Sanitize(%q) = %q, contains an unsafe attribute", test.input, output)
+		}
+	}
+}
+
+func TestParseHostList(t *testing.T) {
+	got := parseHostList(" www.YouTube.com, https://player.vimeo.com/\nhttp://example.com ,, ")
+	want := []string{"www.youtube.com", "player.vimeo.com", "example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseHostList() = %q, want %q", got, want)
+	}
+}
+
+func TestSanitizeCSSRemovesXSSVectors(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		forbidden []string
+	}{
+		{"closing style element", `body { color: red } </style><script>alert(1)</script>`, []string{"<"}},
+		{"import", `@import url(//evil.example/x.css); body { color: red }`, []string{"@import", "evil.example"}},
+		{"import with string", `@import "https://evil.example/x.css";`, []string{"@import", "evil.example"}},
+		{"escaped import", `@\69mport url(//evil.example/x.css);`, []string{"mport", "evil.example"}},
+		{"upper case import", `@IMPORT url(//evil.example/x.css);`, []string{"IMPORT", "evil.example"}},
+		{"namespace", `@namespace url(http://evil.example/);`, []string{"@namespace"}},
+		{"expression", `p { width: expression(alert(1)) }`, []string{"expression"}},
+		{"escaped expression", `p { width: expr\65ssion(alert(1)) }`, []string{"expression", `expr\65ssion`}},
+		{"javascript url", `p { background: url(javascript:alert(1)) }`, []string{"javascript"}},
+		{"quoted javascript url", `p { background: url("javascript:alert(1)") }`, []string{"javascript"}},
+		{"escaped javascript url", `p { background: url("javas\63ript:alert(1)") }`, []string{"javas"}},
+		{"upper case url", `p { background: URL(javascript:alert(1)) }`, []string{"javascript"}},
+		{"escaped url function", `p { background: u\72l(javascript:alert(1)) }`, []string{"javascript"}},
+		{"tab in scheme", "p { background: url(\"java\tscript:alert(1)\") }", []string{"script:"}},
+		{"vbscript url", `p { background: url(vbscript:msgbox(1)) }`, []string{"vbscript"}},
+		{"data html url", `p { background: url(data:text/html,<script>alert(1)</script>) }`, []string{"data:", "<"}},
+		{"image-set", `p { background: image-set("javascript:alert(1)" 1x) }`, []string{"javascript"}},
+		{"moz binding", `p { -moz-binding: url(https://evil.example/x.xml#x) }`, []string{"-moz-binding"}},
+		{"escaped moz binding", `p { -moz-b\69nding: url(https://evil.example/x.xml#x) }`, []string{"nding"}},
+		{"behavior", `p { behavior: url(x.htc) }`, []string{"behavior"}},
+		{"unclosed string", `p { content: "</style><script>alert(1)`, []string{"<", "script"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := SanitizeCSS(test.input)
+			for _, forbidden := range test.forbidden {
+				// "<" is kept as the escape \3c, anything else must not come back when decoding escapes
+				haystack := decodeCSSEscapes(output)
+				if forbidden == "<" {
+					haystack = output
+				}
+				if strings.Contains(haystack, forbidden) {
+					t.Errorf("SanitizeCSS(%q) = %q, contains %q", test.input, output, forbidden)
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizeCSSKeepsStyles(t *testing.T) {
+	tests := []string{
+		`body { color: #333; font-family: "Inter", sans-serif; }`,
+		`.post a:hover::after { content: "note: see below"; }`,
+		`@media (max-width: 600px) { .sidebar { display: none } }`,
+		`@font-face { font-family: Inter; src: url("/uploads/inter.woff2") format("woff2"); }`,
+		`header { background: url(/uploads/header.png) no-repeat, url('https://cdn.example.com/bg.jpg'); }`,
+		`.logo { background-image: url(data:image/png;base64,iVBORw0KGgo=); }`,
+		`@keyframes fade { from { opacity: 0 } to { opacity: 1 } }`,
+		`.box { width: calc(100% - 2rem); transform: translateX(-50%) rotate(3deg); }`,
+		`p::before { content: "\201C"; }`,
+	}
+
+	for _, input := range tests {
+		if output := SanitizeCSS(input); output != input {
+			t.Errorf("SanitizeCSS(%q) = %q, want it unchanged", input, output)
+		}
+	}
+}
+
+func TestDecodeCSSEscapes(t *testing.T) {
+	tests := map[string]string{
+		`plain`:            "plain",
+		`@\69mport`:        "@import",
+		`\69 mport`:        "import",
+		`expr\000065ssion`: "expression",
+		`\j\z`:             "jz",
+		"a\\\nb":           "ab",
+		`\0`:               "�",
+	}
+
+	for input, want := range tests {
+		if got := decodeCSSEscapes(input); got != want {
+			t.Errorf("decodeCSSEscapes(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
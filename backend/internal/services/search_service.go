@@ -0,0 +1,335 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Highlight markers from the Unicode private use area, replaced by <mark> after escaping
+const (
+	highlightStart = "\uE000"
+	highlightEnd   = "\uE001"
+)
+
+// highlightMarkers removes the highlight markers from text, which the search index also drops,
+// so post text can't add marks of its own
+var highlightMarkers = strings.NewReplacer(highlightStart, "", highlightEnd, "")
+
+// maxSearchQueryLength limits how much user input is turned into a search expression
+const maxSearchQueryLength = 200
+
+// SearchResult represents a post matched by a search, with highlighted fragments
+type SearchResult struct {
+	Post           models.Post
+	TitleHighlight string // HTML-escaped title with matches wrapped in <mark>
+	Snippet        string // HTML-escaped excerpt with matches wrapped in <mark>
+}
+
+type SearchService struct {
+	db         *gorm.DB
+	ftsEnabled bool
+}
+
+func NewSearchService(db *gorm.DB) *SearchService {
+	// The index only works when SQLite was built with FTS5, so probe it once
+	var rowID int64
+	ftsEnabled := db.Raw("SELECT rowid FROM posts_fts LIMIT 1").Scan(&rowID).Error == nil
+
+	return &SearchService{
+		db:         db,
+		ftsEnabled: ftsEnabled,
+	}
+}
+
+// SearchPosts searches post titles, summaries, content and tag names with pagination.
+// Results are ranked by relevance when the FTS5 index is available, otherwise by date.
+func (s *SearchService) SearchPosts(query string, page, limit int, publishedOnly bool) ([]SearchResult, int64, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []SearchResult{}, 0, nil
+	}
+
+	if s.ftsEnabled {
+		return s.searchIndex(terms, page, limit, publishedOnly)
+	}
+	return s.searchLike(terms, page, limit, publishedOnly)
+}
+
+// searchIndex runs the search against the FTS5 index
+func (s *SearchService) searchIndex(terms []string, page, limit int, publishedOnly bool) ([]SearchResult, int64, error) {
+	match := buildMatchQuery(terms)
+
+	baseQuery := func() *gorm.DB {
+		query := s.db.Table("posts_fts").
+			Joins("JOIN posts ON posts.id = posts_fts.rowid").
+			Where("posts_fts MATCH ?", match).
+			Where("posts.deleted_at IS NULL")
+		if publishedOnly {
+			query = query.Scopes(PublishedPosts)
+		}
+		return query
+	}
+
+	var total int64
+	if err := baseQuery().Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	var hits []struct {
+		ID             uint
+		TitleHighlight string
+		SummarySnippet string
+		ContentSnippet string
+	}
+	offset := (page - 1) * limit
+	if err := baseQuery().
+		Select(`posts.id AS id,
+			highlight(posts_fts, 0, ?, ?) AS title_highlight,
+			snippet(posts_fts, 1, ?, ?, '…', 32) AS summary_snippet,
+			snippet(posts_fts, 2, ?, ?, '…', 32) AS content_snippet`,
+			highlightStart, highlightEnd, highlightStart, highlightEnd, highlightStart, highlightEnd).
+		Order("bm25(posts_fts, 10.0, 5.0, 1.0, 3.0)").
+		Offset(offset).
+		Limit(limit).
+		Scan(&hits).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to search posts: %w", err)
+	}
+
+	ids := make([]uint, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	postsByID, err := s.loadPosts(ids)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	results := make([]SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		post, ok := postsByID[hit.ID]
+		if !ok {
+			continue
+		}
+
+		// Prefer a content excerpt, but fall back to the summary when only it matched
+		snippet := hit.ContentSnippet
+		if !strings.Contains(snippet, highlightStart) && strings.Contains(hit.SummarySnippet, highlightStart) {
+			snippet = hit.SummarySnippet
+		}
+
+		results = append(results, SearchResult{
+			Post:           post,
+			TitleHighlight: markHighlights(hit.TitleHighlight),
+			Snippet:        markHighlights(snippet),
+		})
+	}
+
+	return results, total, nil
+}
+
+// searchLike runs a LIKE based search for builds without FTS5
+func (s *SearchService) searchLike(terms []string, page, limit int, publishedOnly bool) ([]SearchResult, int64, error) {
+	query := s.db.Model(&models.Post{})
+	for _, term := range terms {
+		pattern := "%" + escapeLike(term) + "%"
+		query = query.Where(`(posts.title LIKE ? ESCAPE '\' OR posts.summary LIKE ? ESCAPE '\' OR posts.content LIKE ? ESCAPE '\'
+			OR EXISTS (SELECT 1 FROM post_tags JOIN tags ON tags.id = post_tags.tag_id
+				WHERE post_tags.post_id = posts.id AND tags.deleted_at IS NULL AND tags.name LIKE ? ESCAPE '\'))`,
+			pattern, pattern, pattern, pattern)
+	}
+	if publishedOnly {
+		query = query.Scopes(PublishedPosts)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	var posts []models.Post
+	offset := (page - 1) * limit
+	if err := query.Preload("Tags").Order("created_at DESC").Offset(offset).Limit(limit).Find(&posts).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to search posts: %w", err)
+	}
+
+	results := make([]SearchResult, len(posts))
+	for i, post := range posts {
+		source := highlightMarkers.Replace(post.Content)
+		if summary := highlightMarkers.Replace(post.Summary); !containsAnyTerm(source, terms) && containsAnyTerm(summary, terms) {
+			source = summary
+		}
+		results[i] = SearchResult{
+			Post:           post,
+			TitleHighlight: markHighlights(highlightTerms(highlightMarkers.Replace(post.Title), terms)),
+			Snippet:        markHighlights(highlightTerms(excerptAround(source, terms, 160), terms)),
+		}
+	}
+
+	return results, total, nil
+}
+
+// loadPosts loads posts with tags keyed by ID
+func (s *SearchService) loadPosts(ids []uint) (map[uint]models.Post, error) {
+	postsByID := make(map[uint]models.Post, len(ids))
+	if len(ids) == 0 {
+		return postsByID, nil
+	}
+
+	var posts []models.Post
+	if err := s.db.Preload("Tags").Where("id IN ?", ids).Find(&posts).Error; err != nil {
+		return nil, fmt.Errorf("failed to load search results: %w", err)
+	}
+	for _, post := range posts {
+		postsByID[post.ID] = post
+	}
+
+	return postsByID, nil
+}
+
+// searchTerms splits a user query into terms
+func searchTerms(query string) []string {
+	query = strings.TrimSpace(query)
+	if len(query) > maxSearchQueryLength {
+		query = query[:maxSearchQueryLength]
+		// Don't leave a partial UTF-8 sequence at the end
+		for !utf8.ValidString(query) {
+			query = query[:len(query)-1]
+		}
+	}
+	return strings.Fields(highlightMarkers.Replace(query))
+}
+
+// buildMatchQuery turns terms into an FTS5 expression matching all terms as prefixes.
+// Every term is quoted so user input can't inject FTS5 operators.
+func buildMatchQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// escapeLike escapes LIKE wildcards using backslash as the escape character
+func escapeLike(term string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(term)
+}
+
+// containsAnyTerm reports whether text contains any of the terms, ignoring case
+func containsAnyTerm(text string, terms []string) bool {
+	lower := strings.ToLower(text)
+	for _, term := range terms {
+		if strings.Contains(lower, strings.ToLower(term)) {
+			return true
+		}
+	}
+	return false
+}
+
+// excerptAround returns about maxRunes of text centered on the first term match
+func excerptAround(text string, terms []string, maxRunes int) string {
+	runes := []rune(text)
+	if len(runes) <= maxRunes {
+		return text
+	}
+
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		// Case folding changed the length, so match positions can't be mapped back
+		lower = runes
+	}
+	first := -1
+	for _, term := range terms {
+		if index := runeIndex(lower, []rune(strings.ToLower(term))); index >= 0 && (first < 0 || index < first) {
+			first = index
+		}
+	}
+
+	start := 0
+	if first > maxRunes/3 {
+		start = first - maxRunes/3
+	}
+	end := start + maxRunes
+	if end > len(runes) {
+		end = len(runes)
+		start = end - maxRunes
+	}
+
+	excerpt := string(runes[start:end])
+	if start > 0 {
+		excerpt = "…" + excerpt
+	}
+	if end < len(runes) {
+		excerpt += "…"
+	}
+	return excerpt
+}
+
+// highlightTerms wraps case-insensitive term matches in highlight markers
+func highlightTerms(text string, terms []string) string {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		// Case folding changed the length, matching positions would be unreliable
+		return text
+	}
+
+	marked := make([]bool, len(runes))
+	for _, term := range terms {
+		needle := []rune(strings.ToLower(term))
+		if len(needle) == 0 {
+			continue
+		}
+		for offset := 0; offset+len(needle) <= len(lower); {
+			index := runeIndex(lower[offset:], needle)
+			if index < 0 {
+				break
+			}
+			for k := offset + index; k < offset+index+len(needle); k++ {
+				marked[k] = true
+			}
+			offset += index + len(needle)
+		}
+	}
+
+	var builder strings.Builder
+	for i, r := range runes {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			builder.WriteString(highlightStart)
+		}
+		builder.WriteRune(r)
+		if marked[i] && (i == len(runes)-1 || !marked[i+1]) {
+			builder.WriteString(highlightEnd)
+		}
+	}
+	return builder.String()
+}
+
+// runeIndex returns the index of needle in haystack, or -1
+func runeIndex(haystack, needle []rune) int {
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		match := true
+		for j := range needle {
+			if haystack[i+j] != needle[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// markHighlights HTML-escapes text and turns highlight markers into <mark> tags
+func markHighlights(text string) string {
+	escaped := html.EscapeString(text)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightEnd, "</mark>")
+}
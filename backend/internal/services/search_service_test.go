@@ -0,0 +1,62 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMarkHighlights(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"plain", "hello", "hello"},
+		{"escaped", "<b>&", "&lt;b&gt;&amp;"},
+		{"marked", "a " + highlightStart + "<term>" + highlightEnd + " b", "a <mark>&lt;term&gt;</mark> b"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := markHighlights(test.text); got != test.want {
+				t.Errorf("markHighlights(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSearchLikeIgnoresMarkersInPosts(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Post{}, &models.Tag{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	post := models.Post{
+		Title:     "Broken " + highlightEnd + "title",
+		Summary:   highlightStart + "summary",
+		Content:   "Some " + highlightStart + "content" + highlightEnd + highlightEnd + " about gophers",
+		Slug:      "markers",
+		Published: true,
+	}
+	if err := db.Create(&post).Error; err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+
+	s := &SearchService{db: db}
+	results, total, err := s.SearchPosts("gophers "+highlightStart, 1, 10, true)
+	if err != nil {
+		t.Fatalf("SearchPosts() error: %v", err)
+	}
+	if total != 1 || len(results) != 1 {
+		t.Fatalf("SearchPosts() found %d results, want 1", total)
+	}
+	if want := "Broken title"; results[0].TitleHighlight != want {
+		t.Errorf("TitleHighlight = %q, want %q", results[0].TitleHighlight, want)
+	}
+	if want := "Some content about <mark>gophers</mark>"; results[0].Snippet != want {
+		t.Errorf("Snippet = %q, want %q", results[0].Snippet, want)
+	}
+}
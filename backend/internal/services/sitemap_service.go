@@ -0,0 +1,238 @@
+package services
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// sitemapURLLimit is the number of URLs per sitemap file before splitting into a sitemap index.
+// The protocol allows up to 50,000, a smaller chunk keeps each response cheap to generate.
+const sitemapURLLimit = 1000
+
+// sitemapListPageSize matches the page size of the public post lists
+const sitemapListPageSize = 10
+
+// defaultRobotsTxt is used when no robots_txt is configured
+const defaultRobotsTxt = "User-agent: *\nDisallow: /admin\nDisallow: /api/"
+
+// ErrSitemapPageNotFound is returned for sitemap pages beyond the last one
+var ErrSitemapPageNotFound = errors.New("sitemap page not found")
+
+// Sitemap structs following the sitemaps.org 0.9 protocol
+type URLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []SitemapURL `xml:"url"`
+}
+
+type SitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type SitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []SitemapRef `xml:"sitemap"`
+}
+
+type SitemapRef struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// sitemapEntry is a site path with its optional modification time
+type sitemapEntry struct {
+	Path    string
+	LastMod time.Time
+}
+
+type SitemapService struct {
+	db            *gorm.DB
+	configService *ConfigService
+}
+
+func NewSitemapService(db *gorm.DB, configService *ConfigService) *SitemapService {
+	return &SitemapService{
+		db:            db,
+		configService: configService,
+	}
+}
+
+// GenerateSitemap generates /sitemap.xml: a plain URL set for small sites,
+// or a sitemap index pointing at numbered sitemap pages once the URL count exceeds the limit
+func (s *SitemapService) GenerateSitemap(baseURL string) (string, error) {
+	entries, err := s.collectEntries()
+	if err != nil {
+		return "", err
+	}
+
+	if len(entries) <= sitemapURLLimit {
+		return marshalSitemap(buildURLSet(baseURL, entries))
+	}
+
+	index := SitemapIndex{}
+	for start := 0; start < len(entries); start += sitemapURLLimit {
+		chunk := entries[start:min(start+sitemapURLLimit, len(entries))]
+		index.Sitemaps = append(index.Sitemaps, SitemapRef{
+			Loc:     fmt.Sprintf("%s/sitemaps/%d.xml", baseURL, start/sitemapURLLimit+1),
+			LastMod: formatLastMod(latestEntry(chunk)),
+		})
+	}
+
+	return marshalSitemap(index)
+}
+
+// GenerateSitemapPage generates one page (starting at 1) of a split sitemap
+func (s *SitemapService) GenerateSitemapPage(baseURL string, page int) (string, error) {
+	entries, err := s.collectEntries()
+	if err != nil {
+		return "", err
+	}
+
+	start := (page - 1) * sitemapURLLimit
+	if page < 1 || start >= len(entries) {
+		return "", ErrSitemapPageNotFound
+	}
+
+	chunk := entries[start:min(start+sitemapURLLimit, len(entries))]
+	return marshalSitemap(buildURLSet(baseURL, chunk))
+}
+
+// GenerateRobotsTxt returns the configured robots.txt rules with a reference to the sitemap
+func (s *SitemapService) GenerateRobotsTxt(baseURL string) string {
+	robots, err := s.configService.GetConfig("robots_txt")
+	if err != nil || strings.TrimSpace(robots) == "" {
+		robots = defaultRobotsTxt
+	}
+	robots = strings.TrimRight(strings.ReplaceAll(robots, "\r\n", "\n"), "\n")
+
+	// Only add the sitemap when the configured rules don't already point at one
+	if !strings.Contains(strings.ToLower(robots), "sitemap:") {
+		robots += "\n\nSitemap: " + baseURL + "/sitemap.xml"
+	}
+
+	return robots + "\n"
+}
+
+// collectEntries lists the home page and its archive pages, the tag pages and every published post
+func (s *SitemapService) collectEntries() ([]sitemapEntry, error) {
+	var posts []models.Post
+	if err := s.db.Scopes(PublishedPosts).
+		Select("id", "slug", "updated_at").
+		Order("created_at DESC").
+		Find(&posts).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch posts: %w", err)
+	}
+
+	var tags []struct {
+		ID        uint
+		PostCount int
+		LastMod   string
+	}
+	if err := s.db.Table("tags").
+		Select("tags.id AS id, COUNT(posts.id) AS post_count, MAX(posts.updated_at) AS last_mod").
+		Joins("JOIN post_tags ON post_tags.tag_id = tags.id").
+		Joins("JOIN posts ON posts.id = post_tags.post_id AND posts.deleted_at IS NULL").
+		Where("tags.deleted_at IS NULL").
+		Scopes(PublishedPosts).
+		Group("tags.id").
+		Order("tags.id").
+		Scan(&tags).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch tags: %w", err)
+	}
+
+	var latest time.Time
+	for _, post := range posts {
+		if post.UpdatedAt.After(latest) {
+			latest = post.UpdatedAt
+		}
+	}
+
+	entries := []sitemapEntry{{Path: "/", LastMod: latest}}
+	entries = append(entries, archivePages("/", len(posts))...)
+
+	if len(tags) > 0 {
+		entries = append(entries, sitemapEntry{Path: "/tags", LastMod: latest})
+	}
+	for _, tag := range tags {
+		tagPath := fmt.Sprintf("/tags/%d/posts", tag.ID)
+		entries = append(entries, sitemapEntry{Path: tagPath, LastMod: parseSQLiteTime(tag.LastMod)})
+		entries = append(entries, archivePages(tagPath, tag.PostCount)...)
+	}
+
+	for _, post := range posts {
+		entries = append(entries, sitemapEntry{Path: "/posts/" + post.Slug, LastMod: post.UpdatedAt})
+	}
+
+	return entries, nil
+}
+
+// archivePages returns the paginated list pages after the first one
+func archivePages(path string, postCount int) []sitemapEntry {
+	totalPages := (postCount + sitemapListPageSize - 1) / sitemapListPageSize
+	var pages []sitemapEntry
+	for page := 2; page <= totalPages; page++ {
+		pages = append(pages, sitemapEntry{Path: fmt.Sprintf("%s?page=%d", path, page)})
+	}
+	return pages
+}
+
+// buildURLSet turns entries into absolute sitemap URLs
+func buildURLSet(baseURL string, entries []sitemapEntry) URLSet {
+	urlSet := URLSet{URLs: make([]SitemapURL, len(entries))}
+	for i, entry := range entries {
+		urlSet.URLs[i] = SitemapURL{
+			Loc:     baseURL + entry.Path,
+			LastMod: formatLastMod(entry.LastMod),
+		}
+	}
+	return urlSet
+}
+
+// latestEntry returns the most recent modification time among entries
+func latestEntry(entries []sitemapEntry) time.Time {
+	var latest time.Time
+	for _, entry := range entries {
+		if entry.LastMod.After(latest) {
+			latest = entry.LastMod
+		}
+	}
+	return latest
+}
+
+// formatLastMod formats a time in W3C datetime format, or empty when unknown
+func formatLastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseSQLiteTime parses a timestamp as returned by an aggregate over a datetime column
+func parseSQLiteTime(value string) time.Time {
+	layouts := []string{
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02 15:04:05.999999999",
+		time.RFC3339Nano,
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// marshalSitemap renders a sitemap document with the XML declaration
+func marshalSitemap(document interface{}) (string, error) {
+	xmlData, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal sitemap XML: %w", err)
+	}
+	return xml.Header + string(xmlData), nil
+}
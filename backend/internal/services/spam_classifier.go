@@ -0,0 +1,362 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Training labels of the spam classifier
+const (
+	SpamLabelSpam = "spam"
+	SpamLabelHam  = "ham"
+)
+
+// maxClassifierTokens limits how many distinct tokens of a comment are used
+const maxClassifierTokens = 200
+
+// urlHostRegex matches the host of http(s) links in comment text
+var urlHostRegex = regexp.MustCompile(`(?i)https?://([a-z0-9.-]+)`)
+
+// SpamClassifier is a naive Bayes classifier that learns from comment moderation decisions.
+// Approved comments are learned as ham and hidden ones as spam; everything stays in the local database.
+type SpamClassifier struct {
+	db            *gorm.DB
+	configService *ConfigService
+}
+
+func NewSpamClassifier(db *gorm.DB, configService *ConfigService) *SpamClassifier {
+	return &SpamClassifier{
+		db:            db,
+		configService: configService,
+	}
+}
+
+// LabelForStatus maps a comment status to the training label it implies, empty for pending
+func LabelForStatus(status string) string {
+	switch status {
+	case "approved":
+		return SpamLabelHam
+	case "hidden":
+		return SpamLabelSpam
+	default:
+		return ""
+	}
+}
+
+// Learn records the moderation decision for a comment. A comment learned with a different
+// label before is unlearned first, and an empty label only unlearns it.
+func (s *SpamClassifier) Learn(comment *models.Comment, label string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return s.LearnComments(tx, []*models.Comment{comment}, label)
+	})
+}
+
+// LearnComments records the same moderation decision for several comments within the caller's
+// transaction, like Learn does for one. The token counts of all comments are summed first,
+// so every token is written once.
+func (s *SpamClassifier) LearnComments(tx *gorm.DB, comments []*models.Comment, label string) error {
+	ids := make([]uint, 0, len(comments))
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var existing []models.SpamTrainingLabel
+	if err := tx.Where("comment_id IN ?", ids).Find(&existing).Error; err != nil {
+		return err
+	}
+	previous := make(map[uint]string, len(existing))
+	for _, row := range existing {
+		previous[row.CommentID] = row.Label
+	}
+
+	deltas := make(tokenDeltas)
+	var unlearned []uint
+	var learned []models.SpamTrainingLabel
+	for _, comment := range comments {
+		// Replies from the blog author are not moderation decisions
+		if comment.IsAuthor || previous[comment.ID] == label {
+			continue
+		}
+
+		tokens := classifierTokens(comment)
+		if previous[comment.ID] != "" {
+			deltas.add(tokens, previous[comment.ID], -1)
+		}
+		if label == "" {
+			unlearned = append(unlearned, comment.ID)
+			continue
+		}
+		deltas.add(tokens, label, 1)
+		learned = append(learned, models.SpamTrainingLabel{CommentID: comment.ID, Label: label})
+	}
+
+	if err := deltas.apply(tx); err != nil {
+		return err
+	}
+	if len(unlearned) > 0 {
+		if err := tx.Where("comment_id IN ?", unlearned).Delete(&models.SpamTrainingLabel{}).Error; err != nil {
+			return err
+		}
+	}
+	if len(learned) > 0 {
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "comment_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"label", "updated_at"}),
+		}).CreateInBatches(learned, 500).Error
+	}
+	return nil
+}
+
+// LearnStatus trains on a comment's new status, logging instead of failing so moderation isn't blocked
+func (s *SpamClassifier) LearnStatus(comment *models.Comment, status string) {
+	if err := s.Learn(comment, LabelForStatus(status)); err != nil {
+		log.Printf("Warning: failed to train spam classifier on comment %d: %v", comment.ID, err)
+	}
+}
+
+// Score returns the probability that a comment is spam.
+// ok is false until enough spam and ham comments have been learned.
+func (s *SpamClassifier) Score(comment *models.Comment) (score float64, ok bool, err error) {
+	spamDocs, hamDocs, err := s.documentCounts()
+	if err != nil {
+		return 0, false, err
+	}
+
+	minTraining := s.minTraining()
+	if spamDocs < int64(minTraining) || hamDocs < int64(minTraining) {
+		return 0, false, nil
+	}
+
+	tokens := classifierTokens(comment)
+	var rows []models.SpamToken
+	if len(tokens) > 0 {
+		if err := s.db.Where("token IN ?", tokens).Find(&rows).Error; err != nil {
+			return 0, false, fmt.Errorf("failed to load token counts: %w", err)
+		}
+	}
+
+	// Bernoulli naive Bayes over the tokens present, with Laplace smoothing, in log space
+	logSpam := math.Log(float64(spamDocs) / float64(spamDocs+hamDocs))
+	logHam := math.Log(float64(hamDocs) / float64(spamDocs+hamDocs))
+	for _, row := range rows {
+		logSpam += math.Log(float64(row.SpamCount+1) / float64(spamDocs+2))
+		logHam += math.Log(float64(row.HamCount+1) / float64(hamDocs+2))
+	}
+
+	return 1 / (1 + math.Exp(logHam-logSpam)), true, nil
+}
+
+// Classify scores a new comment and applies the configured thresholds to its status.
+// Comments are left untouched until the classifier has been trained enough.
+func (s *SpamClassifier) Classify(comment *models.Comment) {
+	score, ok, err := s.Score(comment)
+	if err != nil {
+		log.Printf("Warning: failed to score comment: %v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	comment.SpamScore = &score
+
+	hideThreshold := s.configService.GetIntConfig("spam_hide_threshold", 0)
+	approveThreshold := s.configService.GetIntConfig("spam_approve_threshold", 0)
+	switch {
+	case hideThreshold > 0 && score*100 >= float64(hideThreshold):
+		comment.Status = "hidden"
+	case approveThreshold > 0 && score*100 <= float64(approveThreshold):
+		comment.Status = "approved"
+	}
+}
+
+// Retrain rebuilds the classifier from the current status of every moderated comment
+func (s *SpamClassifier) Retrain() (*models.SpamClassifierStats, error) {
+	var comments []models.Comment
+	if err := s.db.Where("status IN ? AND is_author = ?", []string{"approved", "hidden"}, false).Find(&comments).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch comments: %w", err)
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.SpamToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("1 = 1").Delete(&models.SpamTrainingLabel{}).Error; err != nil {
+			return err
+		}
+
+		deltas := make(tokenDeltas)
+		labels := make([]models.SpamTrainingLabel, len(comments))
+		for i := range comments {
+			label := LabelForStatus(comments[i].Status)
+			deltas.add(classifierTokens(&comments[i]), label, 1)
+			labels[i] = models.SpamTrainingLabel{CommentID: comments[i].ID, Label: label}
+		}
+		if err := deltas.apply(tx); err != nil {
+			return err
+		}
+		if len(labels) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(labels, 500).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrain classifier: %w", err)
+	}
+
+	return s.Stats()
+}
+
+// Stats returns how much the classifier has learned and its thresholds
+func (s *SpamClassifier) Stats() (*models.SpamClassifierStats, error) {
+	spamDocs, hamDocs, err := s.documentCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens int64
+	if err := s.db.Model(&models.SpamToken{}).Where("spam_count > 0 OR ham_count > 0").Count(&tokens).Error; err != nil {
+		return nil, fmt.Errorf("failed to count tokens: %w", err)
+	}
+
+	minTraining := s.minTraining()
+	return &models.SpamClassifierStats{
+		SpamComments:     spamDocs,
+		HamComments:      hamDocs,
+		Tokens:           tokens,
+		MinTraining:      minTraining,
+		Ready:            spamDocs >= int64(minTraining) && hamDocs >= int64(minTraining),
+		HideThreshold:    s.configService.GetIntConfig("spam_hide_threshold", 0),
+		ApproveThreshold: s.configService.GetIntConfig("spam_approve_threshold", 0),
+	}, nil
+}
+
+// documentCounts returns how many comments were learned as spam and as ham
+func (s *SpamClassifier) documentCounts() (spamDocs, hamDocs int64, err error) {
+	if err := s.db.Model(&models.SpamTrainingLabel{}).Where("label = ?", SpamLabelSpam).Count(&spamDocs).Error; err != nil {
+		return 0, 0, fmt.Errorf("failed to count spam comments: %w", err)
+	}
+	if err := s.db.Model(&models.SpamTrainingLabel{}).Where("label = ?", SpamLabelHam).Count(&hamDocs).Error; err != nil {
+		return 0, 0, fmt.Errorf("failed to count ham comments: %w", err)
+	}
+	return spamDocs, hamDocs, nil
+}
+
+// minTraining returns the number of comments of each kind needed before scoring
+func (s *SpamClassifier) minTraining() int {
+	minTraining := s.configService.GetIntConfig("spam_min_training", 10)
+	if minTraining < 1 {
+		return 1
+	}
+	return minTraining
+}
+
+// tokenDelta is the change to the spam and ham counts of a token
+type tokenDelta struct {
+	spam, ham int64
+}
+
+// tokenDeltas sums the count changes of a batch of training decisions per token
+type tokenDeltas map[string]*tokenDelta
+
+// add adds delta to the spam or ham count of every token
+func (d tokenDeltas) add(tokens []string, label string, delta int64) {
+	for _, token := range tokens {
+		counts, ok := d[token]
+		if !ok {
+			counts = &tokenDelta{}
+			d[token] = counts
+		}
+		if label == SpamLabelSpam {
+			counts.spam += delta
+		} else {
+			counts.ham += delta
+		}
+	}
+}
+
+// apply writes the summed changes with one upsert per token, never going below zero
+func (d tokenDeltas) apply(tx *gorm.DB) error {
+	for token, counts := range d {
+		if counts.spam == 0 && counts.ham == 0 {
+			continue
+		}
+
+		row := models.SpamToken{Token: token, SpamCount: max(counts.spam, 0), HamCount: max(counts.ham, 0)}
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "token"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"spam_count": gorm.Expr("MAX(spam_count + ?, 0)", counts.spam),
+				"ham_count":  gorm.Expr("MAX(ham_count + ?, 0)", counts.ham),
+			}),
+		}).Create(&row).Error
+		if err != nil {
+			return fmt.Errorf("failed to update token %q: %w", token, err)
+		}
+	}
+	return nil
+}
+
+// classifierTokens extracts the distinct features of a comment: words of the content and name,
+// link hosts and the email domain. Runs of CJK characters are split into bigrams.
+func classifierTokens(comment *models.Comment) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	add := func(token string) {
+		if len(tokens) >= maxClassifierTokens || seen[token] || len(token) > 100 {
+			return
+		}
+		seen[token] = true
+		tokens = append(tokens, token)
+	}
+
+	for _, match := range urlHostRegex.FindAllStringSubmatch(comment.Content, -1) {
+		add("host:" + strings.ToLower(strings.TrimPrefix(match[1], "www.")))
+	}
+
+	if at := strings.LastIndex(comment.Email, "@"); at >= 0 {
+		add("email:" + strings.ToLower(comment.Email[at+1:]))
+	}
+
+	for _, word := range classifierWords(comment.Name) {
+		add("name:" + word)
+	}
+	for _, word := range classifierWords(comment.Content) {
+		add(word)
+	}
+
+	return tokens
+}
+
+// classifierWords lowercases text and splits it into words of 2 to 30 characters
+func classifierWords(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	var words []string
+	for _, field := range fields {
+		runes := []rune(field)
+		if unicode.Is(unicode.Han, runes[0]) {
+			for i := 0; i+1 < len(runes); i++ {
+				words = append(words, string(runes[i:i+2]))
+			}
+			continue
+		}
+		if len(runes) >= 2 && len(runes) <= 30 {
+			words = append(words, field)
+		}
+	}
+	return words
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newClassifierTestService(t *testing.T, configs map[string]string) *SpamClassifier {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Config{}, &models.Comment{}, &models.SpamToken{}, &models.SpamTrainingLabel{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	configService := NewConfigService(db)
+	if err := configService.UpdateConfigs(configs); err != nil {
+		t.Fatalf("failed to update configs: %v", err)
+	}
+	return NewSpamClassifier(db, configService)
+}
+
+// createTrainingComments stores comments with the given contents and teaches them to the classifier
+func createTrainingComments(t *testing.T, s *SpamClassifier, label string, contents ...string) []models.Comment {
+	t.Helper()
+	comments := make([]models.Comment, len(contents))
+	for i, content := range contents {
+		comments[i] = models.Comment{PostID: 1, Name: "Reader", Content: content, Status: "pending"}
+		if err := s.db.Create(&comments[i]).Error; err != nil {
+			t.Fatalf("failed to create comment: %v", err)
+		}
+		if err := s.Learn(&comments[i], label); err != nil {
+			t.Fatalf("Learn() error: %v", err)
+		}
+	}
+	return comments
+}
+
+// tokenCounts returns the stored spam and ham counts of a token
+func tokenCounts(t *testing.T, s *SpamClassifier, token string) (spam, ham int64) {
+	t.Helper()
+	var row models.SpamToken
+	if err := s.db.Where("token = ?", token).Limit(1).Find(&row).Error; err != nil {
+		t.Fatalf("failed to load token: %v", err)
+	}
+	return row.SpamCount, row.HamCount
+}
+
+func TestClassifierTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		comment models.Comment
+		want    []string
+	}{
+		{"words", models.Comment{Content: "Great post, Great READ!"}, []string{"great", "post", "read"}},
+		{"short and long words", models.Comment{Content: "a ok " + strings.Repeat("x", 31)}, []string{"ok"}},
+		{"numbers", models.Comment{Content: "version 42"}, []string{"version", "42"}},
+		{"link hosts", models.Comment{Content: "see https://www.Example.com/page and http://spam.test"},
+			[]string{"host:example.com", "host:spam.test", "see", "https", "www", "example", "com", "page", "and", "http", "spam", "test"}},
+		{"email domain and name", models.Comment{Name: "Cheap Pills", Email: "Someone@Mail.Example"},
+			[]string{"email:mail.example", "name:cheap", "name:pills"}},
+		{"CJK bigrams", models.Comment{Content: "垃圾邮件"}, []string{"垃圾", "圾邮", "邮件"}},
+		{"single CJK character", models.Comment{Content: "好"}, nil},
+		{"CJK next to latin", models.Comment{Content: "买便宜药 now"}, []string{"买便", "便宜", "宜药", "now"}},
+		{"repeated bigrams", models.Comment{Content: "哈哈哈"}, []string{"哈哈"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := classifierTokens(&test.comment); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("classifierTokens() = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	t.Run("limit", func(t *testing.T) {
+		words := make([]string, maxClassifierTokens+50)
+		for i := range words {
+			words[i] = "word" + strconv.Itoa(i)
+		}
+		comment := models.Comment{Content: strings.Join(words, " ")}
+		if got := classifierTokens(&comment); len(got) != maxClassifierTokens {
+			t.Errorf("classifierTokens() returned %d tokens, want %d", len(got), maxClassifierTokens)
+		}
+	})
+}
+
+func TestSpamClassifierLearn(t *testing.T) {
+	s := newClassifierTestService(t, nil)
+	comment := createTrainingComments(t, s, SpamLabelSpam, "cheap pills")[0]
+
+	steps := []struct {
+		name              string
+		label             string
+		wantSpam, wantHam int64
+		wantLabel         string
+	}{
+		{"learned as spam", "", 1, 0, SpamLabelSpam},
+		{"same label again", SpamLabelSpam, 1, 0, SpamLabelSpam},
+		{"relearned as ham", SpamLabelHam, 0, 1, SpamLabelHam},
+		{"unlearned", "", 0, 0, ""},
+		{"unlearned again", "", 0, 0, ""},
+		{"learned as spam again", SpamLabelSpam, 1, 0, SpamLabelSpam},
+	}
+	for i, step := range steps {
+		if i > 0 {
+			if err := s.Learn(&comment, step.label); err != nil {
+				t.Fatalf("%s: Learn() error: %v", step.name, err)
+			}
+		}
+		for _, token := range []string{"cheap", "pills", "name:reader"} {
+			if spam, ham := tokenCounts(t, s, token); spam != step.wantSpam || ham != step.wantHam {
+				t.Errorf("%s: token %q counts spam %d, ham %d, want %d and %d", step.name, token, spam, ham, step.wantSpam, step.wantHam)
+			}
+		}
+		var labels []string
+		s.db.Model(&models.SpamTrainingLabel{}).Pluck("label", &labels)
+		if got := strings.Join(labels, ","); got != step.wantLabel {
+			t.Errorf("%s: stored labels %q, want %q", step.name, got, step.wantLabel)
+		}
+	}
+
+	// Replies from the blog author are never learned
+	author := models.Comment{PostID: 1, Name: "Admin", Content: "cheap", IsAuthor: true}
+	s.db.Create(&author)
+	if err := s.Learn(&author, SpamLabelHam); err != nil {
+		t.Fatalf("Learn() error: %v", err)
+	}
+	if spam, ham := tokenCounts(t, s, "cheap"); spam != 1 || ham != 0 {
+		t.Errorf("author reply changed token counts to spam %d, ham %d", spam, ham)
+	}
+}
+
+func TestSpamClassifierLearnComments(t *testing.T) {
+	s := newClassifierTestService(t, nil)
+	comments := createTrainingComments(t, s, SpamLabelHam, "free money", "free time")
+	third := models.Comment{PostID: 1, Content: "free lunch"}
+	s.db.Create(&third)
+	batch := []*models.Comment{&comments[0], &comments[1], &third}
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		return s.LearnComments(tx, batch, SpamLabelSpam)
+	}); err != nil {
+		t.Fatalf("LearnComments() error: %v", err)
+	}
+	if spam, ham := tokenCounts(t, s, "free"); spam != 3 || ham != 0 {
+		t.Errorf("token \"free\" counts spam %d, ham %d, want 3 and 0", spam, ham)
+	}
+	if spam, ham := tokenCounts(t, s, "lunch"); spam != 1 || ham != 0 {
+		t.Errorf("token \"lunch\" counts spam %d, ham %d, want 1 and 0", spam, ham)
+	}
+	if spamDocs, hamDocs, _ := s.documentCounts(); spamDocs != 3 || hamDocs != 0 {
+		t.Errorf("document counts spam %d, ham %d, want 3 and 0", spamDocs, hamDocs)
+	}
+
+	// A failing transaction leaves the counts as they were
+	s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.LearnComments(tx, batch, ""); err != nil {
+			t.Fatalf("LearnComments() error: %v", err)
+		}
+		return gorm.ErrInvalidTransaction
+	})
+	if spam, _ := tokenCounts(t, s, "free"); spam != 3 {
+		t.Errorf("token \"free\" spam count %d after a rollback, want 3", spam)
+	}
+}
+
+func TestSpamClassifierScore(t *testing.T) {
+	s := newClassifierTestService(t, map[string]string{"spam_min_training": "2"})
+	createTrainingComments(t, s, SpamLabelSpam, "viagra", "viagra")
+	createTrainingComments(t, s, SpamLabelHam, "thanks")
+
+	if _, ok, err := s.Score(&models.Comment{Content: "viagra"}); err != nil || ok {
+		t.Fatalf("Score() before enough ham = ok %v, %v, want not ready", ok, err)
+	}
+	createTrainingComments(t, s, SpamLabelHam, "thanks")
+
+	tests := []struct {
+		content string
+		want    float64
+	}{
+		// "viagra" is in both spam comments: (3/4) / (3/4 + 1/4) with Laplace smoothing
+		{"viagra", 0.75},
+		{"thanks", 0.25},
+		{"viagra thanks", 0.5},
+		// Unknown tokens leave the prior
+		{"unknown", 0.5},
+	}
+	for _, test := range tests {
+		score, ok, err := s.Score(&models.Comment{Content: test.content})
+		if err != nil || !ok {
+			t.Fatalf("Score(%q) = ok %v, %v", test.content, ok, err)
+		}
+		if math.Abs(score-test.want) > 1e-9 {
+			t.Errorf("Score(%q) = %v, want %v", test.content, score, test.want)
+		}
+	}
+}
+
+func TestSpamClassifierClassify(t *testing.T) {
+	tests := []struct {
+		name                  string
+		hide, approve, status string
+		content               string
+		want                  string
+	}{
+		{"spam over the hide threshold", "70", "30", "pending", "viagra", "hidden"},
+		{"spam just over the hide threshold", "74", "30", "pending", "viagra", "hidden"},
+		{"spam under the hide threshold", "80", "30", "pending", "viagra", "pending"},
+		{"ham under the approve threshold", "70", "30", "pending", "thanks", "approved"},
+		{"ham just under the approve threshold", "70", "26", "pending", "thanks", "approved"},
+		{"ham over the approve threshold", "70", "20", "pending", "thanks", "pending"},
+		{"thresholds disabled", "0", "0", "pending", "viagra", "pending"},
+		{"undecided", "70", "30", "pending", "unknown", "pending"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newClassifierTestService(t, map[string]string{
+				"spam_min_training":      "2",
+				"spam_hide_threshold":    test.hide,
+				"spam_approve_threshold": test.approve,
+			})
+			createTrainingComments(t, s, SpamLabelSpam, "viagra", "viagra")
+			createTrainingComments(t, s, SpamLabelHam, "thanks", "thanks")
+
+			comment := models.Comment{Content: test.content, Status: test.status}
+			s.Classify(&comment)
+			if comment.Status != test.want {
+				t.Errorf("Status = %q, want %q", comment.Status, test.want)
+			}
+			if comment.SpamScore == nil {
+				t.Error("SpamScore not set")
+			}
+		})
+	}
+
+	t.Run("untrained", func(t *testing.T) {
+		s := newClassifierTestService(t, map[string]string{"spam_hide_threshold": "1"})
+		comment := models.Comment{Content: "viagra", Status: "pending"}
+		s.Classify(&comment)
+		if comment.Status != "pending" || comment.SpamScore != nil {
+			t.Errorf("untrained classifier set status %q, score %v", comment.Status, comment.SpamScore)
+		}
+	})
+}
+
+func TestCommentDeletesUnlearn(t *testing.T) {
+	s := newClassifierTestService(t, nil)
+	comments := NewCommentService(s.db, s, nil)
+	learned := createTrainingComments(t, s, SpamLabelSpam, "spam one", "spam two", "spam three")
+
+	if err := comments.DeleteComment(learned[0].ID); err != nil {
+		t.Fatalf("DeleteComment() error: %v", err)
+	}
+	if err := comments.DeleteComment(learned[0].ID); err == nil {
+		t.Error("DeleteComment() of a deleted comment succeeded")
+	}
+	if _, err := comments.BulkModerate(models.BulkCommentRequest{Action: "delete", IDs: []uint{learned[1].ID}}); err != nil {
+		t.Fatalf("BulkModerate() error: %v", err)
+	}
+
+	if spam, _ := tokenCounts(t, s, "spam"); spam != 1 {
+		t.Errorf("token \"spam\" spam count %d after deleting two comments, want 1", spam)
+	}
+	var labels []models.SpamTrainingLabel
+	s.db.Find(&labels)
+	if len(labels) != 1 || labels[0].CommentID != learned[2].ID {
+		t.Errorf("labels left %+v, want only comment %d", labels, learned[2].ID)
+	}
+
+	// Retraining from the remaining comments gives the same counts
+	s.db.Model(&models.Comment{}).Where("id = ?", learned[2].ID).Update("status", "hidden")
+	if _, err := s.Retrain(); err != nil {
+		t.Fatalf("Retrain() error: %v", err)
+	}
+	if spam, _ := tokenCounts(t, s, "spam"); spam != 1 {
+		t.Errorf("token \"spam\" spam count %d after retraining, want 1", spam)
+	}
+}
+
+func TestBulkModerateLearnsDecisions(t *testing.T) {
+	s := newClassifierTestService(t, nil)
+	comments := NewCommentService(s.db, s, nil)
+	learned := createTrainingComments(t, s, SpamLabelHam, "buy now", "buy later")
+	pending := models.Comment{PostID: 1, Content: "buy today", Status: "pending"}
+	s.db.Create(&pending)
+
+	response, err := comments.BulkModerate(models.BulkCommentRequest{
+		Action: "hide",
+		IDs:    []uint{learned[0].ID, learned[1].ID, pending.ID},
+	})
+	if err != nil {
+		t.Fatalf("BulkModerate() error: %v", err)
+	}
+	if response.Affected != 3 {
+		t.Errorf("Affected = %d, want 3", response.Affected)
+	}
+	if spam, ham := tokenCounts(t, s, "buy"); spam != 3 || ham != 0 {
+		t.Errorf("token \"buy\" counts spam %d, ham %d, want 3 and 0", spam, ham)
+	}
+	if spamDocs, hamDocs, _ := s.documentCounts(); spamDocs != 3 || hamDocs != 0 {
+		t.Errorf("document counts spam %d, ham %d, want 3 and 0", spamDocs, hamDocs)
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/bytetopia/BlankoBlog/backend/internal/models"
+	"github.com/bytetopia/BlankoBlog/backend/internal/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DedupeUploads hashes the files uploaded before blobs were keyed by hash and merges files with
+// the same content into one blob. Duplicates are deleted from disk, their records point at the
+// kept copy and links to them in posts, revisions and settings are rewritten.
+// The reference counts of all blobs are recomputed, so it is safe to run more than once.
+func (s *FileService) DedupeUploads() (*models.UploadDedupeReport, error) {
+	report := &models.UploadDedupeReport{}
+
+	var legacy []models.File
+	if err := s.db.Where("sha256 = '' OR sha256 IS NULL").Order("id").Find(&legacy).Error; err != nil {
+		return nil, err
+	}
+
+	for _, file := range legacy {
+		hash, err := s.hashUpload(file.ServerPath)
+		if errors.Is(err, storage.ErrNotExist) {
+			log.Printf("Warning: upload %s is missing from disk", file.ServerPath)
+			report.Missing++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Resized copies were named after the original and are made again for the blob
+		if _, ok := imageFormats[file.MimeType]; ok {
+			s.removeLegacyVariants(file.ServerPath)
+		}
+
+		if err := s.db.Model(&file).Update("sha256", hash).Error; err != nil {
+			return nil, err
+		}
+		report.Hashed++
+	}
+
+	var files []models.File
+	if err := s.db.Where("sha256 <> ''").Order("id").Find(&files).Error; err != nil {
+		return nil, err
+	}
+
+	var hashes []string
+	groups := make(map[string][]models.File)
+	for _, file := range files {
+		if _, ok := groups[file.SHA256]; !ok {
+			hashes = append(hashes, file.SHA256)
+		}
+		groups[file.SHA256] = append(groups[file.SHA256], file)
+	}
+
+	for _, hash := range hashes {
+		group := groups[hash]
+
+		// An existing blob keeps its place, otherwise the earliest upload becomes the blob
+		var blob models.Blob
+		err := s.db.First(&blob, "hash = ?", hash).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			blob = models.Blob{
+				Hash:       hash,
+				ServerPath: group[0].ServerPath,
+				FileSize:   group[0].FileSize,
+				MimeType:   group[0].MimeType,
+			}
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, file := range group {
+			if file.ServerPath == blob.ServerPath {
+				continue
+			}
+			freed, err := s.mergeDuplicate(file, blob.ServerPath)
+			if err != nil {
+				return nil, err
+			}
+			report.Duplicates++
+			report.BytesFreed += freed
+		}
+
+		blob.RefCount = len(group)
+		err = s.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "hash"}},
+			DoUpdates: clause.AssignmentColumns([]string{"ref_count", "updated_at"}),
+		}).Create(&blob).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// mergeDuplicate points a file and the links to it at the blob holding the same content and
+// deletes its own copy from disk. It returns the number of bytes freed.
+func (s *FileService) mergeDuplicate(file models.File, blobPath string) (int64, error) {
+	oldPath := file.ServerPath
+	oldURL := "/uploads/" + oldPath
+	newURL := "/uploads/" + blobPath
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&file).Update("server_path", blobPath).Error; err != nil {
+			return err
+		}
+		for _, column := range []struct{ table, name string }{
+			{"posts", "content"},
+			{"post_revisions", "content"},
+			{"configs", "value"},
+		} {
+			query := fmt.Sprintf("UPDATE %s SET %s = REPLACE(%s, ?, ?) WHERE %s LIKE ?", column.table, column.name, column.name, column.name)
+			if err := tx.Exec(query, oldURL, newURL, "%"+oldURL+"%").Error; err != nil {
+				return fmt.Errorf("failed to rewrite links in %s: %w", column.table, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Another record may still use the copy, such as one restored from a backup
+	var users int64
+	if err := s.db.Model(&models.File{}).Where("server_path = ?", oldPath).Count(&users).Error; err != nil {
+		return 0, err
+	}
+	if users > 0 {
+		return 0, nil
+	}
+
+	if err := s.storage.Delete(oldPath); err != nil {
+		log.Printf("Warning: failed to delete duplicate %s: %v", oldPath, err)
+		return 0, nil
+	}
+	return file.FileSize, nil
+}
+
+// removeLegacyVariants deletes the resized copies made next to an image before they belonged to blobs
+func (s *FileService) removeLegacyVariants(serverPath string) {
+	base := strings.TrimSuffix(serverPath, filepath.Ext(serverPath))
+	for _, name := range []string{ImageVariantThumbnail, ImageVariantMedium, ImageVariantLarge} {
+		for _, format := range imageFormatTypes {
+			s.removeUpload(base + "-" + name + format.ext)
+		}
+	}
+}
+
+// hashUpload returns the hex encoded SHA-256 hash of an uploaded file's content
+func (s *FileService) hashUpload(serverPath string) (string, error) {
+	object, _, err := s.storage.Get(serverPath)
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, object); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultUploadAllowedTypes lists the file types that can be uploaded with their size limits in megabytes
+const defaultUploadAllowedTypes = "image/jpeg:20, image/png:20, image/gif:20, image/webp:20, image/avif:20, image/svg+xml:2, " +
+	"application/pdf:50, application/zip:100, text/plain:5, audio/mpeg:100, video/mp4:500, video/webm:500"
+
+// ErrUploadTypeNotAllowed is returned for uploads whose content is not of an allowed type
+var ErrUploadTypeNotAllowed = errors.New("file type is not allowed")
+
+// ErrUploadTooLarge is returned for uploads over the size limit of their type
+var ErrUploadTooLarge = errors.New("file is too large")
+
+// uploadExtensions are the extensions given to uploads whose own extension doesn't match their content
+var uploadExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/avif":      ".avif",
+	"image/heic":      ".heic",
+	"image/bmp":       ".bmp",
+	"image/x-icon":    ".ico",
+	"image/svg+xml":   ".svg",
+	"application/pdf": ".pdf",
+	"application/zip": ".zip",
+	"text/plain":      ".txt",
+	"text/html":       ".html",
+	"text/xml":        ".xml",
+	"audio/mpeg":      ".mp3",
+	"audio/wave":      ".wav",
+	"application/ogg": ".ogg",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+}
+
+// inlineTypes can be shown by the browser. Other uploads, such as HTML and SVG which can
+// run script, are served as downloads so they never run with the blog's origin.
+var inlineTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/avif":      true,
+	"image/bmp":       true,
+	"image/x-icon":    true,
+	"application/pdf": true,
+	"text/plain":      true,
+	"audio/mpeg":      true,
+	"audio/wave":      true,
+	"application/ogg": true,
+	"video/mp4":       true,
+	"video/webm":      true,
+}
+
+// IsInlineType reports whether files of a MIME type may be displayed by the browser
+// rather than downloaded
+func IsInlineType(mimeType string) bool {
+	return inlineTypes[baseMIMEType(mimeType)]
+}
+
+// DetectContentType returns the MIME type of a file from its first bytes, ignoring its name.
+// It adds SVG and the AVIF and HEIC image formats to what the standard library recognizes.
+func DetectContentType(head []byte) string {
+	mimeType := baseMIMEType(http.DetectContentType(head))
+
+	switch mimeType {
+	case "text/xml", "text/plain":
+		if bytes.Contains(bytes.ToLower(head), []byte("<svg")) {
+			return "image/svg+xml"
+		}
+	case "application/octet-stream":
+		// ISO media files start with an ftyp box naming their major brand
+		if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+			switch string(head[8:12]) {
+			case "avif", "avis":
+				return "image/avif"
+			case "heic", "heix", "mif1", "msf1":
+				return "image/heic"
+			}
+		}
+	}
+	return mimeType
+}
+
+// uploadExtension keeps the extension of an uploaded file when it matches the detected type.
+// Otherwise the file gets the usual extension of that type, so it is never served as another type.
+func uploadExtension(filename, mimeType string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext != "" && baseMIMEType(mime.TypeByExtension(ext)) == mimeType {
+		return ext
+	}
+	if ext, ok := uploadExtensions[mimeType]; ok {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(mimeType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
+
+// parseUploadLimits parses a list of "type:megabytes" entries separated by commas or new lines.
+// A type such as image/* allows all its subtypes. Entries without a valid size are ignored.
+func parseUploadLimits(value string) map[string]int64 {
+	limits := make(map[string]int64)
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		mimeType, size, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			continue
+		}
+		megabytes, err := strconv.ParseFloat(strings.TrimSpace(size), 64)
+		if err != nil || megabytes <= 0 {
+			continue
+		}
+		limits[strings.ToLower(strings.TrimSpace(mimeType))] = int64(megabytes * (1 << 20))
+	}
+	return limits
+}
+
+// baseMIMEType strips parameters such as the charset from a MIME type
+func baseMIMEType(mimeType string) string {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
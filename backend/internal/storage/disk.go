@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// Disk stores objects as files in a directory, named by their keys
+type Disk struct {
+	root string
+}
+
+func NewDisk(root string) *Disk {
+	return &Disk{root: root}
+}
+
+// Root returns the directory holding the objects
+func (d *Disk) Root() string {
+	return d.root
+}
+
+func (d *Disk) Put(key string, r io.Reader, size int64, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	fullPath := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// Write to a temporary file first, so readers never see a partly written object
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fullPath)
+}
+
+func (d *Disk) Get(key string) (Object, *ObjectInfo, error) {
+	if err := checkKey(key); err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Open(d.path(key))
+	if err != nil {
+		return nil, nil, notExist(err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if stat.IsDir() {
+		file.Close()
+		return nil, nil, ErrNotExist
+	}
+	return file, fileInfo(key, stat), nil
+}
+
+func (d *Disk) Stat(key string) (*ObjectInfo, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(d.path(key))
+	if err != nil {
+		return nil, notExist(err)
+	}
+	if stat.IsDir() {
+		return nil, ErrNotExist
+	}
+	return fileInfo(key, stat), nil
+}
+
+func (d *Disk) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if err := os.Remove(d.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// SignedURL is not supported, as files on disk are only reachable through the blog itself
+func (d *Disk) SignedURL(key string, expiry time.Duration, options URLOptions) (string, error) {
+	return "", ErrSignedURLUnsupported
+}
+
+func (d *Disk) path(key string) string {
+	return filepath.Join(d.root, filepath.FromSlash(key))
+}
+
+// fileInfo describes a file, whose type is given by its extension
+func fileInfo(key string, stat fs.FileInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Size:        stat.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ModTime:     stat.ModTime(),
+	}
+}
+
+func notExist(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotExist
+	}
+	return err
+}
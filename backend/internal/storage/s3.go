@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config configures an S3-compatible object store such as AWS S3, MinIO or Cloudflare R2
+type S3Config struct {
+	Endpoint        string // Host and port, or a URL whose scheme picks HTTP or HTTPS (the default)
+	Region          string
+	Bucket          string
+	Prefix          string // Added in front of every key, to share a bucket
+	AccessKeyID     string
+	SecretAccessKey string
+	PathStyle       bool // Puts the bucket in the path rather than the host name, as MinIO usually needs
+}
+
+// S3 stores objects in a bucket of an S3-compatible object store
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func NewS3(config S3Config) (*S3, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, errors.New("S3 storage needs an endpoint and a bucket")
+	}
+
+	endpoint, secure := config.Endpoint, true
+	if strings.Contains(endpoint, "://") {
+		parsed, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+		}
+		endpoint, secure = parsed.Host, parsed.Scheme != "http"
+	}
+
+	lookup := minio.BucketLookupAuto
+	if config.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, ""),
+		Secure:       secure,
+		Region:       config.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	prefix := strings.Trim(config.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3{client: client, bucket: config.Bucket, prefix: prefix}, nil
+}
+
+func (s *S3) Put(key string, r io.Reader, size int64, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	_, err := s.client.PutObject(context.Background(), s.bucket, s.prefix+key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	return err
+}
+
+func (s *S3) Get(key string) (Object, *ObjectInfo, error) {
+	if err := checkKey(key); err != nil {
+		return nil, nil, err
+	}
+	object, err := s.client.GetObject(context.Background(), s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, s3Error(err)
+	}
+
+	// The request is only made on first use, which tells whether the object exists
+	stat, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, nil, s3Error(err)
+	}
+	return object, objectInfo(stat), nil
+}
+
+func (s *S3) Stat(key string) (*ObjectInfo, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	stat, err := s.client.StatObject(context.Background(), s.bucket, s.prefix+key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	return objectInfo(stat), nil
+}
+
+func (s *S3) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return s.client.RemoveObject(context.Background(), s.bucket, s.prefix+key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3) SignedURL(key string, expiry time.Duration, options URLOptions) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	if options.ContentType != "" {
+		params.Set("response-content-type", options.ContentType)
+	}
+	if options.ContentDisposition != "" {
+		params.Set("response-content-disposition", options.ContentDisposition)
+	}
+
+	signed, err := s.client.PresignedGetObject(context.Background(), s.bucket, s.prefix+key, expiry, params)
+	if err != nil {
+		return "", err
+	}
+	return signed.String(), nil
+}
+
+func objectInfo(stat minio.ObjectInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Size:        stat.Size,
+		ContentType: stat.ContentType,
+		ModTime:     stat.LastModified,
+	}
+}
+
+// s3Error maps missing objects to ErrNotExist, but not a missing bucket
+func s3Error(err error) error {
+	response := minio.ToErrorResponse(err)
+	if response.Code == "NoSuchKey" || (response.StatusCode == http.StatusNotFound && response.Code != "NoSuchBucket") {
+		return ErrNotExist
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestS3 connects to the store set by the S3_* variables, as FromEnv does, with keys under a
+// prefix of their own. The tests are skipped without S3_ENDPOINT, e.g. run them against MinIO with
+// S3_ENDPOINT=http://localhost:9000 S3_BUCKET=blog S3_PATH_STYLE=true and its credentials.
+func newTestS3(t *testing.T) *S3 {
+	t.Helper()
+	if os.Getenv("S3_ENDPOINT") == "" {
+		t.Skip("S3_ENDPOINT is not set")
+	}
+
+	store, err := NewS3(S3Config{
+		Endpoint:        os.Getenv("S3_ENDPOINT"),
+		Region:          os.Getenv("S3_REGION"),
+		Bucket:          os.Getenv("S3_BUCKET"),
+		Prefix:          path.Join(os.Getenv("S3_PREFIX"), "storage-test-"+strconv.FormatInt(time.Now().UnixNano(), 36)),
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		PathStyle:       strings.EqualFold(os.Getenv("S3_PATH_STYLE"), "true"),
+	})
+	if err != nil {
+		t.Fatalf("NewS3() error: %v", err)
+	}
+	return store
+}
+
+func TestS3(t *testing.T) {
+	testStorage(t, newTestS3(t))
+}
+
+func TestS3SignedURL(t *testing.T) {
+	store := newTestS3(t)
+	key := "test/signed.txt"
+	content := []byte("signed content")
+	if err := store.Put(key, bytes.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	t.Cleanup(func() { store.Delete(key) })
+
+	signed, err := store.SignedURL(key, time.Minute, URLOptions{ContentType: "text/plain", ContentDisposition: "attachment"})
+	if err != nil {
+		t.Fatalf("SignedURL() error: %v", err)
+	}
+
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatalf("failed to fetch the signed URL: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(data, content) {
+		t.Fatalf("signed URL returned %d %q, want 200 %q", resp.StatusCode, data, content)
+	}
+	if disposition := resp.Header.Get("Content-Disposition"); disposition != "attachment" {
+		t.Errorf("Content-Disposition = %q, want attachment", disposition)
+	}
+}
@@ -0,0 +1,89 @@
+// Package storage keeps uploaded files on the local disk or in an S3-compatible object store,
+// so several instances of the blog can share their uploads.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotExist is returned for keys with no object stored
+var ErrNotExist = errors.New("object does not exist")
+
+// ErrInvalidKey is returned for keys that are empty, absolute or contain ".." elements
+var ErrInvalidKey = errors.New("invalid object key")
+
+// ErrSignedURLUnsupported is returned by stores that can't give out URLs of their own
+var ErrSignedURLUnsupported = errors.New("signed URLs are not supported by this storage")
+
+// Object is the content of a stored object. Seeking allows range requests to be served.
+type Object interface {
+	io.ReadSeekCloser
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// URLOptions overrides headers of the response to a signed URL
+type URLOptions struct {
+	ContentType        string
+	ContentDisposition string
+}
+
+// Storage stores uploaded files under keys such as blobs/0a/0a91...jpg, which are the server
+// paths of the files
+type Storage interface {
+	// Put stores an object, replacing any stored under the same key
+	Put(key string, r io.Reader, size int64, contentType string) error
+	// Get opens an object for reading, returning ErrNotExist when there is none
+	Get(key string) (Object, *ObjectInfo, error)
+	// Stat describes an object, returning ErrNotExist when there is none
+	Stat(key string) (*ObjectInfo, error)
+	// Delete removes an object. Deleting a key with no object is not an error.
+	Delete(key string) error
+	// SignedURL returns a URL giving access to an object until it expires
+	SignedURL(key string, expiry time.Duration, options URLOptions) (string, error)
+}
+
+// FromEnv returns the storage set by UPLOAD_STORAGE: disk (the default), which keeps uploads
+// next to the database, or s3, configured by the S3_* variables
+func FromEnv() (Storage, error) {
+	switch backend := strings.ToLower(os.Getenv("UPLOAD_STORAGE")); backend {
+	case "", "disk":
+		dbPath := os.Getenv("DB_PATH")
+		if dbPath == "" {
+			dbPath = "./data/blog.db"
+		}
+		return NewDisk(filepath.Join(filepath.Dir(dbPath), "uploads")), nil
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			Prefix:          os.Getenv("S3_PREFIX"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       strings.EqualFold(os.Getenv("S3_PATH_STYLE"), "true"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown UPLOAD_STORAGE %q (available: disk, s3)", backend)
+	}
+}
+
+// checkKey rejects keys that could reach outside the store
+func checkKey(key string) error {
+	if key == "" || !fs.ValidPath(key) || key == "." {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return nil
+}
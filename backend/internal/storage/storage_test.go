@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckKey(t *testing.T) {
+	valid := []string{"a.txt", "blobs/0a/0a91.jpg", "dir/sub/file-name_1.png"}
+	for _, key := range valid {
+		if err := checkKey(key); err != nil {
+			t.Errorf("checkKey(%q) = %v, want nil", key, err)
+		}
+	}
+
+	invalid := []string{"", ".", "..", "../secret", "a/../../secret", "a/..", "./a", "/etc/passwd", "a//b", "a/"}
+	for _, key := range invalid {
+		if err := checkKey(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("checkKey(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestDisk(t *testing.T) {
+	testStorage(t, NewDisk(t.TempDir()))
+}
+
+func TestDiskStaysInRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "uploads")
+	outside := filepath.Join(dir, "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	disk := NewDisk(root)
+
+	for _, key := range []string{"../secret.txt", "a/../../secret.txt", outside} {
+		if _, _, err := disk.Get(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := disk.Stat(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Stat(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if err := disk.Put(key, strings.NewReader("x"), 1, "text/plain"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if err := disk.Delete(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+
+	if data, err := os.ReadFile(outside); err != nil || string(data) != "secret" {
+		t.Errorf("file outside the root was changed: %q, %v", data, err)
+	}
+}
+
+func TestDiskSignedURLUnsupported(t *testing.T) {
+	if _, err := NewDisk(t.TempDir()).SignedURL("a.txt", 0, URLOptions{}); !errors.Is(err, ErrSignedURLUnsupported) {
+		t.Errorf("SignedURL() = %v, want ErrSignedURLUnsupported", err)
+	}
+}
+
+// testStorage checks the behavior every Storage shares, using keys under test/
+func testStorage(t *testing.T, store Storage) {
+	t.Helper()
+	key := "test/blobs/ab/abcdef.txt"
+	content := []byte("hello, storage")
+
+	if _, err := store.Stat(key); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("Stat() of a missing key = %v, want ErrNotExist", err)
+	}
+	if _, _, err := store.Get(key); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("Get() of a missing key = %v, want ErrNotExist", err)
+	}
+
+	if err := store.Put(key, bytes.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	t.Cleanup(func() { store.Delete(key) })
+
+	info, err := store.Stat(key)
+	if err != nil {
+		t.Fatalf("Stat() error: %v", err)
+	}
+	if info.Size != int64(len(content)) || !strings.HasPrefix(info.ContentType, "text/plain") {
+		t.Errorf("Stat() = size %d, type %q, want %d and text/plain", info.Size, info.ContentType, len(content))
+	}
+
+	object, info, err := store.Get(key)
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if info.Size != int64(len(content)) {
+		t.Errorf("Get() size = %d, want %d", info.Size, len(content))
+	}
+	// Range requests seek into the object
+	if _, err := object.Seek(7, io.SeekStart); err != nil {
+		t.Errorf("Seek() error: %v", err)
+	}
+	data, err := io.ReadAll(object)
+	object.Close()
+	if err != nil || string(data) != string(content[7:]) {
+		t.Errorf("read %q, %v after seeking, want %q", data, err, content[7:])
+	}
+
+	// Put replaces the object
+	replaced := []byte("replaced")
+	if err := store.Put(key, bytes.NewReader(replaced), int64(len(replaced)), "text/plain"); err != nil {
+		t.Fatalf("Put() of an existing key error: %v", err)
+	}
+	if info, err := store.Stat(key); err != nil || info.Size != int64(len(replaced)) {
+		t.Errorf("Stat() after replacing = %v, %v, want size %d", info, err, len(replaced))
+	}
+
+	// A directory holding objects is not an object itself
+	if _, err := store.Stat("test/blobs/ab"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat() of a directory = %v, want ErrNotExist", err)
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if _, err := store.Stat(key); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat() after Delete() = %v, want ErrNotExist", err)
+	}
+	if err := store.Delete(key); err != nil {
+		t.Errorf("Delete() of a missing key = %v, want nil", err)
+	}
+
+	for _, invalid := range []string{"", "../escape.txt", "test/../../escape.txt", "/escape.txt"} {
+		if err := store.Put(invalid, strings.NewReader("x"), 1, "text/plain"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) = %v, want ErrInvalidKey", invalid, err)
+		}
+		if _, err := store.SignedURL(invalid, 0, URLOptions{}); !errors.Is(err, ErrInvalidKey) && !errors.Is(err, ErrSignedURLUnsupported) {
+			t.Errorf("SignedURL(%q) = %v, want ErrInvalidKey", invalid, err)
+		}
+	}
+}
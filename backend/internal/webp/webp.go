@@ -0,0 +1,723 @@
+// Package webp encodes images in the lossless WebP (VP8L) format.
+//
+// The encoder uses the subtract-green and predictor transforms, LZ77 backward references
+// and one set of prefix codes for the whole image. It trades some compression for a small
+// amount of code: files are typically around 10% larger than those of libwebp at its default
+// settings, but still smaller than PNG.
+package webp
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+)
+
+// MaxDimension is the largest width or height a WebP image can have
+const MaxDimension = 16384
+
+const (
+	predictorBits = 4 // Predictor modes are chosen per 16x16 block
+
+	numLiteralCodes   = 256
+	numLengthCodes    = 24
+	numDistanceCodes  = 40
+	numCodeLengthCode = 19
+
+	maxCodeLength           = 15
+	maxCodeLengthCodeLength = 7
+
+	minMatchLength = 3
+	maxMatchLength = 4096
+	maxDistance    = 1<<20 - 120
+	hashBits       = 16
+	maxChainLength = 8
+)
+
+// codeLengthCodeOrder is the order in which the code length code lengths are written
+var codeLengthCodeOrder = [numCodeLengthCode]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// Encode writes img to w as a lossless WebP image
+func Encode(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > MaxDimension || height > MaxDimension {
+		return errors.New("webp: invalid image size")
+	}
+
+	argb, hasAlpha := toARGB(img)
+
+	bw := &bitWriter{}
+	bw.writeBits(0x2f, 8)
+	bw.writeBits(uint32(width-1), 14)
+	bw.writeBits(uint32(height-1), 14)
+	if hasAlpha {
+		bw.writeBits(1, 1)
+	} else {
+		bw.writeBits(0, 1)
+	}
+	bw.writeBits(0, 3)
+
+	// Subtract green transform
+	bw.writeBits(1, 1)
+	bw.writeBits(2, 2)
+	subtractGreen(argb)
+
+	// Predictor transform with its sub-image of modes
+	bw.writeBits(1, 1)
+	bw.writeBits(0, 2)
+	bw.writeBits(predictorBits-2, 3)
+	modes, modesWidth := predict(argb, width, height)
+	writeImageData(bw, modes, modesWidth, false)
+
+	bw.writeBits(0, 1) // No more transforms
+	writeImageData(bw, argb, width, true)
+
+	data := bw.bytes()
+	padding := len(data) & 1
+
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+len(data)+padding))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if padding == 1 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// toARGB converts an image to non-premultiplied ARGB pixels and reports whether any are translucent
+func toARGB(img image.Image) ([]uint32, bool) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	argb := make([]uint32, width*height)
+	alpha := uint32(0xff)
+
+	switch src := img.(type) {
+	case *image.NRGBA:
+		for y := 0; y < height; y++ {
+			row := src.Pix[(y+bounds.Min.Y-src.Rect.Min.Y)*src.Stride+(bounds.Min.X-src.Rect.Min.X)*4:]
+			for x := 0; x < width; x++ {
+				p := row[x*4 : x*4+4]
+				argb[y*width+x] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+				alpha &= uint32(p[3])
+			}
+		}
+	default:
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+				argb[y*width+x] = uint32(c.A)<<24 | uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+				alpha &= uint32(c.A)
+			}
+		}
+	}
+	return argb, alpha != 0xff
+}
+
+// subtractGreen subtracts the green channel from red and blue, which are usually correlated
+func subtractGreen(argb []uint32) {
+	for i, p := range argb {
+		green := (p >> 8) & 0xff
+		redBlue := (p & 0x00ff00ff) + 0x01000100 - (green<<16 | green)
+		argb[i] = p&0xff00ff00 | redBlue&0x00ff00ff
+	}
+}
+
+// predict replaces the pixels by their residuals against the best of the 14 predictors for each block.
+// It returns the sub-image of chosen modes and its width.
+func predict(argb []uint32, width, height int) ([]uint32, int) {
+	blockSize := 1 << predictorBits
+	modesWidth := (width + blockSize - 1) >> predictorBits
+	modesHeight := (height + blockSize - 1) >> predictorBits
+	modes := make([]uint32, modesWidth*modesHeight)
+
+	// Choose modes against the original pixels before any are replaced
+	for by := 0; by < modesHeight; by++ {
+		for bx := 0; bx < modesWidth; bx++ {
+			bestMode, bestCost := 0, -1
+			for mode := 0; mode < 14; mode++ {
+				cost := 0
+				for y := by * blockSize; y < min(height, (by+1)*blockSize); y++ {
+					if y == 0 {
+						continue
+					}
+					for x := bx * blockSize; x < min(width, (bx+1)*blockSize); x++ {
+						if x == 0 {
+							continue
+						}
+						cost += residualCost(subPixels(argb[y*width+x], predictPixel(mode, argb, y*width+x, width)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					bestMode, bestCost = mode, cost
+				}
+			}
+			modes[by*modesWidth+bx] = 0xff000000 | uint32(bestMode)<<8
+		}
+	}
+
+	// Residuals are computed from the end so each prediction still sees original pixels
+	for i := len(argb) - 1; i >= 0; i-- {
+		x, y := i%width, i/width
+		var prediction uint32
+		switch {
+		case i == 0:
+			prediction = 0xff000000
+		case y == 0:
+			prediction = argb[i-1]
+		case x == 0:
+			prediction = argb[i-width]
+		default:
+			mode := int(modes[(y>>predictorBits)*modesWidth+(x>>predictorBits)]>>8) & 0xff
+			prediction = predictPixel(mode, argb, i, width)
+		}
+		argb[i] = subPixels(argb[i], prediction)
+	}
+	return modes, modesWidth
+}
+
+// predictPixel predicts the pixel at index i, which is neither in the top row nor the left column
+func predictPixel(mode int, argb []uint32, i, width int) uint32 {
+	left := argb[i-1]
+	top := argb[i-width]
+	topLeft := argb[i-width-1]
+	// The top-right pixel of the last column is the leftmost pixel of the current row
+	topRight := argb[i-width+1]
+
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return left
+	case 2:
+		return top
+	case 3:
+		return topRight
+	case 4:
+		return topLeft
+	case 5:
+		return average2(average2(left, topRight), top)
+	case 6:
+		return average2(left, topLeft)
+	case 7:
+		return average2(left, top)
+	case 8:
+		return average2(topLeft, top)
+	case 9:
+		return average2(top, topRight)
+	case 10:
+		return average2(average2(left, topLeft), average2(top, topRight))
+	case 11:
+		return selectPixel(left, top, topLeft)
+	case 12:
+		return clampAddSubtractFull(left, top, topLeft)
+	default:
+		return clampAddSubtractHalf(average2(left, top), topLeft)
+	}
+}
+
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+func selectPixel(left, top, topLeft uint32) uint32 {
+	predictLeft, predictTop := 0, 0
+	for shift := 0; shift < 32; shift += 8 {
+		l, t, tl := int(left>>shift&0xff), int(top>>shift&0xff), int(topLeft>>shift&0xff)
+		predictLeft += abs(t - tl)
+		predictTop += abs(l - tl)
+	}
+	if predictLeft < predictTop {
+		return left
+	}
+	return top
+}
+
+func clampAddSubtractFull(a, b, c uint32) uint32 {
+	var result uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(a>>shift&0xff) + int(b>>shift&0xff) - int(c>>shift&0xff)
+		result |= uint32(clamp255(v)) << shift
+	}
+	return result
+}
+
+func clampAddSubtractHalf(a, b uint32) uint32 {
+	var result uint32
+	for shift := 0; shift < 32; shift += 8 {
+		av, bv := int(a>>shift&0xff), int(b>>shift&0xff)
+		result |= uint32(clamp255(av+(av-bv)/2)) << shift
+	}
+	return result
+}
+
+// subPixels subtracts b from a per channel, modulo 256
+func subPixels(a, b uint32) uint32 {
+	alphaGreen := 0x00ff00ff + (a & 0xff00ff00) - (b & 0xff00ff00)
+	redBlue := 0xff00ff00 + (a & 0x00ff00ff) - (b & 0x00ff00ff)
+	return alphaGreen&0xff00ff00 | redBlue&0x00ff00ff
+}
+
+// residualCost estimates how well a residual compresses, small values in either direction being cheap
+func residualCost(p uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(p >> shift & 0xff)
+		cost += min(v, 256-v)
+	}
+	return cost
+}
+
+func clamp255(v int) int {
+	return max(0, min(255, v))
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// token is a literal pixel or, when length is set, a backward reference
+type token struct {
+	pixel    uint32
+	length   int
+	distance int
+}
+
+// findMatches splits the pixels into literals and backward references using a hash chain.
+// The pixel above and the one to the left are always tried, as they match most often.
+func findMatches(argb []uint32, width int) []token {
+	n := len(argb)
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+
+	// Positions are hashed by the minimum match length of pixels
+	hash := func(i int) uint32 {
+		return (argb[i]*0x1e35a7bd ^ argb[i+1]*0x9e3779b1 ^ argb[i+2]*0x85ebca6b) >> (32 - hashBits)
+	}
+	insert := func(i int) {
+		if i+minMatchLength > n {
+			return
+		}
+		h := hash(i)
+		prev[i] = head[h]
+		head[h] = int32(i)
+	}
+	matchLength := func(i, distance int) int {
+		limit := min(maxMatchLength, n-i)
+		length := 0
+		for length < limit && argb[i+length] == argb[i+length-distance] {
+			length++
+		}
+		return length
+	}
+
+	tokens := make([]token, 0, n/2)
+	for i := 0; i < n; {
+		bestLength, bestDistance := 0, 0
+		try := func(distance int) {
+			if distance < 1 || distance > i || distance > maxDistance {
+				return
+			}
+			// A longer match has to agree on the pixel just past the current best
+			if i+bestLength < n && argb[i+bestLength] != argb[i+bestLength-distance] {
+				return
+			}
+			if length := matchLength(i, distance); length > bestLength {
+				bestLength, bestDistance = length, distance
+			}
+		}
+
+		try(1)
+		try(width)
+		if i+minMatchLength <= n && bestLength < maxMatchLength {
+			for candidate, tries := head[hash(i)], 0; candidate >= 0 && tries < maxChainLength; candidate, tries = prev[candidate], tries+1 {
+				try(i - int(candidate))
+				if i-int(candidate) > maxDistance || bestLength == maxMatchLength {
+					break
+				}
+			}
+		}
+
+		if bestLength >= minMatchLength {
+			tokens = append(tokens, token{length: bestLength, distance: bestDistance})
+			for j := i; j < i+bestLength; j++ {
+				insert(j)
+			}
+			i += bestLength
+		} else {
+			tokens = append(tokens, token{pixel: argb[i]})
+			insert(i)
+			i++
+		}
+	}
+	return tokens
+}
+
+// prefixEncode splits a length or distance into its prefix symbol and extra bits
+func prefixEncode(value int) (symbol int, extraBits uint, extra uint32) {
+	if value <= 4 {
+		return value - 1, 0, 0
+	}
+	d := value - 1
+	highBit := bits.Len(uint(d)) - 1
+	second := (d >> (highBit - 1)) & 1
+	extraBits = uint(highBit - 1)
+	return 2*highBit + second, extraBits, uint32(d) & (1<<extraBits - 1)
+}
+
+// distanceCode maps a distance to a distance code. The codes for the 120 nearest
+// two-dimensional neighbours are not used, so every distance is offset past them.
+func distanceCode(distance int) int {
+	return distance + 120
+}
+
+// writeImageData writes entropy-coded pixels without a color cache, using a single group of prefix codes
+func writeImageData(bw *bitWriter, argb []uint32, width int, isMain bool) {
+	bw.writeBits(0, 1) // No color cache
+	if isMain {
+		bw.writeBits(0, 1) // No meta prefix codes
+	}
+
+	tokens := findMatches(argb, width)
+
+	green := make([]int, numLiteralCodes+numLengthCodes)
+	red := make([]int, numLiteralCodes)
+	blue := make([]int, numLiteralCodes)
+	alpha := make([]int, numLiteralCodes)
+	distance := make([]int, numDistanceCodes)
+	for _, t := range tokens {
+		if t.length > 0 {
+			lengthSymbol, _, _ := prefixEncode(t.length)
+			distanceSymbol, _, _ := prefixEncode(distanceCode(t.distance))
+			green[numLiteralCodes+lengthSymbol]++
+			distance[distanceSymbol]++
+			continue
+		}
+		alpha[t.pixel>>24]++
+		red[t.pixel>>16&0xff]++
+		green[t.pixel>>8&0xff]++
+		blue[t.pixel&0xff]++
+	}
+
+	var codes [5]prefixCode
+	for i, histogram := range [][]int{green, red, blue, alpha, distance} {
+		codes[i] = writePrefixCode(bw, histogram)
+	}
+
+	for _, t := range tokens {
+		if t.length > 0 {
+			symbol, extraBits, extra := prefixEncode(t.length)
+			codes[0].write(bw, numLiteralCodes+symbol)
+			bw.writeBits(extra, extraBits)
+			symbol, extraBits, extra = prefixEncode(distanceCode(t.distance))
+			codes[4].write(bw, symbol)
+			bw.writeBits(extra, extraBits)
+			continue
+		}
+		codes[0].write(bw, int(t.pixel>>8&0xff))
+		codes[1].write(bw, int(t.pixel>>16&0xff))
+		codes[2].write(bw, int(t.pixel&0xff))
+		codes[3].write(bw, int(t.pixel>>24))
+	}
+}
+
+// prefixCode holds the bit-reversed canonical codes of an alphabet, ready to be written LSB first
+type prefixCode struct {
+	lengths []int
+	codes   []uint32
+}
+
+func (c prefixCode) write(bw *bitWriter, symbol int) {
+	bw.writeBits(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+// writePrefixCode writes the code for a histogram and returns it.
+// One or two small symbols use the simple code, where a single symbol takes no bits at all.
+func writePrefixCode(bw *bitWriter, histogram []int) prefixCode {
+	var used []int
+	for symbol, count := range histogram {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < numLiteralCodes) {
+		code := prefixCode{lengths: make([]int, len(histogram)), codes: make([]uint32, len(histogram))}
+		bw.writeBits(1, 1) // Simple code
+		switch len(used) {
+		case 0:
+			bw.writeBits(0, 1)
+			bw.writeBits(0, 1)
+			bw.writeBits(0, 1)
+		case 1:
+			bw.writeBits(0, 1)
+			writeSimpleSymbol(bw, used[0])
+		case 2:
+			bw.writeBits(1, 1)
+			writeSimpleSymbol(bw, used[0])
+			bw.writeBits(uint32(used[1]), 8)
+			code.lengths[used[0]], code.lengths[used[1]] = 1, 1
+			code.codes[used[1]] = 1
+		}
+		return code
+	}
+
+	// A normal code needs at least two symbols
+	if len(used) == 1 {
+		histogram = append([]int(nil), histogram...)
+		histogram[(used[0]+1)%len(histogram)] = 1
+	}
+
+	lengths := codeLengths(histogram, maxCodeLength)
+	bw.writeBits(0, 1) // Normal code
+	writeCodeLengths(bw, lengths)
+	return prefixCode{lengths: lengths, codes: canonicalCodes(lengths)}
+}
+
+func writeSimpleSymbol(bw *bitWriter, symbol int) {
+	if symbol < 2 {
+		bw.writeBits(0, 1)
+		bw.writeBits(uint32(symbol), 1)
+		return
+	}
+	bw.writeBits(1, 1)
+	bw.writeBits(uint32(symbol), 8)
+}
+
+// codeLength is one symbol of the run-length encoded code lengths
+type codeLength struct {
+	symbol    int
+	extraBits uint
+	extra     uint32
+}
+
+// writeCodeLengths writes the code lengths of a normal code, run-length encoded and themselves prefix coded
+func writeCodeLengths(bw *bitWriter, lengths []int) {
+	var encoded []codeLength
+	for i := 0; i < len(lengths); {
+		value := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == value {
+			run++
+		}
+		i += run
+
+		if value == 0 {
+			for run >= 3 {
+				if run >= 11 {
+					n := min(run, 138)
+					encoded = append(encoded, codeLength{18, 7, uint32(n - 11)})
+					run -= n
+				} else {
+					n := min(run, 10)
+					encoded = append(encoded, codeLength{17, 3, uint32(n - 3)})
+					run -= n
+				}
+			}
+			for ; run > 0; run-- {
+				encoded = append(encoded, codeLength{symbol: 0})
+			}
+			continue
+		}
+
+		// Code 16 repeats the last non-zero length, which is this one once it has been written
+		encoded = append(encoded, codeLength{symbol: value})
+		run--
+		for run >= 3 {
+			n := min(run, 6)
+			encoded = append(encoded, codeLength{16, 2, uint32(n - 3)})
+			run -= n
+		}
+		for ; run > 0; run-- {
+			encoded = append(encoded, codeLength{symbol: value})
+		}
+	}
+
+	histogram := make([]int, numCodeLengthCode)
+	for _, e := range encoded {
+		histogram[e.symbol]++
+	}
+	if nonZero(histogram) == 1 {
+		for i := range histogram {
+			if histogram[i] == 0 {
+				histogram[i] = 1
+				break
+			}
+		}
+	}
+	codeLengthLengths := codeLengths(histogram, maxCodeLengthCodeLength)
+	codeLengthCodes := canonicalCodes(codeLengthLengths)
+
+	count := numCodeLengthCode
+	for count > 4 && codeLengthLengths[codeLengthCodeOrder[count-1]] == 0 {
+		count--
+	}
+	bw.writeBits(uint32(count-4), 4)
+	for _, symbol := range codeLengthCodeOrder[:count] {
+		bw.writeBits(uint32(codeLengthLengths[symbol]), 3)
+	}
+
+	bw.writeBits(0, 1) // Lengths are given for the whole alphabet
+	for _, e := range encoded {
+		bw.writeBits(codeLengthCodes[e.symbol], uint(codeLengthLengths[e.symbol]))
+		bw.writeBits(e.extra, e.extraBits)
+	}
+}
+
+func nonZero(histogram []int) int {
+	n := 0
+	for _, count := range histogram {
+		if count > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// codeLengths builds Huffman code lengths for a histogram with at least two used symbols.
+// When the tree is too deep, the counts are halved until it fits.
+func codeLengths(histogram []int, maxLength int) []int {
+	counts := append([]int(nil), histogram...)
+	for {
+		lengths := huffmanLengths(counts)
+		longest := 0
+		for _, length := range lengths {
+			longest = max(longest, length)
+		}
+		if longest <= maxLength {
+			return lengths
+		}
+		for i, count := range counts {
+			if count > 0 {
+				counts[i] = max(1, count/2)
+			}
+		}
+	}
+}
+
+type huffmanNode struct {
+	count       int
+	symbol      int // -1 for internal nodes
+	left, right *huffmanNode
+	order       int
+}
+
+type huffmanHeap []*huffmanNode
+
+func (h huffmanHeap) Len() int { return len(h) }
+func (h huffmanHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].order < h[j].order
+}
+func (h huffmanHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *huffmanHeap) Push(x any)   { *h = append(*h, x.(*huffmanNode)) }
+func (h *huffmanHeap) Pop() any {
+	old := *h
+	node := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return node
+}
+
+func huffmanLengths(counts []int) []int {
+	nodes := &huffmanHeap{}
+	for symbol, count := range counts {
+		if count > 0 {
+			*nodes = append(*nodes, &huffmanNode{count: count, symbol: symbol, order: symbol})
+		}
+	}
+	heap.Init(nodes)
+
+	order := len(counts)
+	for nodes.Len() > 1 {
+		a := heap.Pop(nodes).(*huffmanNode)
+		b := heap.Pop(nodes).(*huffmanNode)
+		heap.Push(nodes, &huffmanNode{count: a.count + b.count, symbol: -1, left: a, right: b, order: order})
+		order++
+	}
+
+	lengths := make([]int, len(counts))
+	var walk func(node *huffmanNode, depth int)
+	walk = func(node *huffmanNode, depth int) {
+		if node.symbol >= 0 {
+			lengths[node.symbol] = depth
+			return
+		}
+		walk(node.left, depth+1)
+		walk(node.right, depth+1)
+	}
+	if nodes.Len() == 1 {
+		walk((*nodes)[0], 0)
+	}
+	return lengths
+}
+
+// canonicalCodes assigns canonical Huffman codes to the lengths, bit-reversed for LSB-first writing
+func canonicalCodes(lengths []int) []uint32 {
+	var lengthCounts [maxCodeLength + 1]uint32
+	for _, length := range lengths {
+		if length > 0 {
+			lengthCounts[length]++
+		}
+	}
+
+	var next [maxCodeLength + 2]uint32
+	for length := 1; length <= maxCodeLength; length++ {
+		next[length+1] = (next[length] + lengthCounts[length]) << 1
+	}
+
+	codes := make([]uint32, len(lengths))
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		code := next[length]
+		next[length]++
+		codes[symbol] = bits.Reverse32(code) >> (32 - length)
+	}
+	return codes
+}
+
+// bitWriter packs values least significant bit first, as VP8L reads them
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) writeBits(value uint32, n uint) {
+	w.acc |= uint64(value) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf
+}
@@ -0,0 +1,101 @@
+package webp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	xwebp "golang.org/x/image/webp"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"single pixel", fillNRGBA(1, 1, func(x, y int) color.NRGBA {
+			return color.NRGBA{200, 100, 50, 255}
+		})},
+		{"solid color", fillNRGBA(64, 48, func(x, y int) color.NRGBA {
+			return color.NRGBA{30, 144, 255, 255}
+		})},
+		{"gradient", fillNRGBA(300, 200, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x), uint8(y), uint8(x + y), 255}
+		})},
+		{"odd size with alpha", fillNRGBA(37, 19, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 7), uint8(y * 13), 90, uint8(x * y)}
+		})},
+		{"repeated pattern", fillNRGBA(128, 128, func(x, y int) color.NRGBA {
+			if (x/8+y/8)%2 == 0 {
+				return color.NRGBA{0, 0, 0, 255}
+			}
+			return color.NRGBA{255, 255, 255, 255}
+		})},
+		{"noise", fillNRGBA(97, 61, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(random.Intn(256)), uint8(random.Intn(256)), uint8(random.Intn(256)), uint8(random.Intn(256))}
+		})},
+		{"few colors", fillNRGBA(80, 80, func(x, y int) color.NRGBA {
+			palette := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}}
+			return palette[random.Intn(len(palette))]
+		})},
+		{"gray", func() image.Image {
+			img := image.NewGray(image.Rect(0, 0, 50, 30))
+			for i := range img.Pix {
+				img.Pix[i] = uint8(i * 3)
+			}
+			return img
+		}()},
+		{"offset bounds", fillNRGBA(40, 40, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 5), 0, uint8(y * 5), 255}
+		}).SubImage(image.Rect(10, 5, 33, 29))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, test.img); err != nil {
+				t.Fatalf("Encode() error: %v", err)
+			}
+
+			decoded, err := xwebp.Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("failed to decode the encoded image: %v", err)
+			}
+
+			bounds := test.img.Bounds()
+			if decoded.Bounds().Dx() != bounds.Dx() || decoded.Bounds().Dy() != bounds.Dy() {
+				t.Fatalf("decoded size %v, want %v", decoded.Bounds().Size(), bounds.Size())
+			}
+			for y := 0; y < bounds.Dy(); y++ {
+				for x := 0; x < bounds.Dx(); x++ {
+					want := color.NRGBAModel.Convert(test.img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+					got := color.NRGBAModel.Convert(decoded.At(decoded.Bounds().Min.X+x, decoded.Bounds().Min.Y+y)).(color.NRGBA)
+					if got != want {
+						t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeRejectsOversizedImages(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, MaxDimension+1, 1))
+	if err := Encode(&bytes.Buffer{}, img); err == nil {
+		t.Error("Encode() of an image wider than MaxDimension succeeded, want an error")
+	}
+}
+
+func fillNRGBA(width, height int, pixel func(x, y int) color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, pixel(x, y))
+		}
+	}
+	return img
+}
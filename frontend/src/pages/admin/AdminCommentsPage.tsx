@@ -418,6 +418,19 @@ const AdminCommentsPage: React.FC = () => {
                   </Typography>
                 </Box>
 
+                <Box mb={2}>
+                  <Typography variant="subtitle2" color="text.secondary">
+                    Preview
+                  </Typography>
+                  {/* Rendered and sanitized by the server, as shown on the post */}
+                  <Typography
+                    component="div"
+                    variant="body1"
+                    sx={{ '& pre': { overflowX: 'auto' }, '& p': { my: 1 } }}
+                    dangerouslySetInnerHTML={{ __html: selectedComment.content_html }}
+                  />
+                </Box>
+
                 <Box mb={2}>
                   <Typography variant="subtitle2" color="text.secondary">
                     IP Address
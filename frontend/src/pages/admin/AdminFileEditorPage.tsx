@@ -39,6 +39,7 @@ const AdminFileEditorPage: React.FC = () => {
   // Form fields
   const [displayName, setDisplayName] = useState('');
   const [description, setDescription] = useState('');
+  const [folder, setFolder] = useState('');
   
   // Delete confirmation
   const [deleteConfirmOpen, setDeleteConfirmOpen] = useState(false);
@@ -76,6 +77,7 @@ const AdminFileEditorPage: React.FC = () => {
       setFile(fileData);
       setDisplayName(fileData.display_name);
       setDescription(fileData.description);
+      setFolder(fileData.folder);
     } catch (err) {
       setError('Failed to load file');
     } finally {
@@ -97,6 +99,9 @@ const AdminFileEditorPage: React.FC = () => {
       if (description !== file.description) {
         updates.description = description;
       }
+      if (folder !== file.folder) {
+        updates.folder = folder;
+      }
 
       if (Object.keys(updates).length > 0) {
         await filesAPI.updateFile(file.id, updates);
@@ -241,6 +246,20 @@ const AdminFileEditorPage: React.FC = () => {
                   </Box>
                 </Box>
               )}
+              <Box>
+                <Typography variant="caption" color="text.secondary">
+                  Used In
+                </Typography>
+                <Box sx={{ mt: 0.5, display: 'flex', gap: 0.5, flexWrap: 'wrap' }}>
+                  {file.used_in.length === 0 ? (
+                    <Typography variant="body2">Not used in any post</Typography>
+                  ) : (
+                    file.used_in.map((usage) => (
+                      <Chip key={usage.post_id} label={usage.title} size="small" />
+                    ))
+                  )}
+                </Box>
+              </Box>
               <Box>
                 <Typography variant="caption" color="text.secondary">
                   Uploaded
@@ -290,6 +309,14 @@ const AdminFileEditorPage: React.FC = () => {
                 helperText="Optional description or notes about the file"
               />
 
+              <TextField
+                label="Folder"
+                value={folder}
+                onChange={(e) => setFolder(e.target.value)}
+                fullWidth
+                helperText="Optional media library folder, such as logos or diagrams/2024"
+              />
+
               <Box sx={{ display: 'flex', gap: 2, justifyContent: 'space-between' }}>
                 <Button
                   variant="outlined"
@@ -19,13 +19,18 @@ import {
   Alert,
   IconButton,
   Chip,
+  FormControl,
+  InputLabel,
+  Select,
+  MenuItem,
+  TextField,
 } from '@mui/material';
 import { Edit, Delete, InsertDriveFile } from '@mui/icons-material';
 import { useNavigate } from 'react-router-dom';
 import { useAuth } from '../../contexts/AuthContext';
 import { useDocumentTitle } from '../../hooks/useDocumentTitle';
 import { filesAPI } from '../../services/api';
-import type { UploadedFile } from '../../services/api';
+import type { UploadedFile, FileFilters, FileFolder } from '../../services/api';
 import AdminNavbar from '../../components/AdminNavbar';
 
 const AdminFilesPage: React.FC = () => {
@@ -43,6 +48,13 @@ const AdminFilesPage: React.FC = () => {
   const [rowsPerPage, setRowsPerPage] = useState(20);
   const [totalFiles, setTotalFiles] = useState(0);
   
+  // Filters
+  const [typeFilter, setTypeFilter] = useState('all');
+  const [usageFilter, setUsageFilter] = useState('all');
+  const [folderFilter, setFolderFilter] = useState('all');
+  const [search, setSearch] = useState('');
+  const [folders, setFolders] = useState<FileFolder[]>([]);
+  
   // Delete confirmation
   const [deleteConfirmFile, setDeleteConfirmFile] = useState<UploadedFile | null>(null);
 
@@ -67,12 +79,23 @@ const AdminFilesPage: React.FC = () => {
 
   useEffect(() => {
     loadFiles();
-  }, [page, rowsPerPage]);
+  }, [page, rowsPerPage, typeFilter, usageFilter, folderFilter, search]);
+
+  useEffect(() => {
+    filesAPI.getFolders()
+      .then((response) => setFolders(response.data.folders))
+      .catch(() => setFolders([]));
+  }, []);
 
   const loadFiles = async () => {
     try {
       setLoading(true);
-      const response = await filesAPI.getFiles(page + 1, rowsPerPage);
+      const filters: FileFilters = {};
+      if (typeFilter !== 'all') filters.type = typeFilter;
+      if (usageFilter === 'used' || usageFilter === 'unused') filters.usage = usageFilter;
+      if (folderFilter !== 'all') filters.folder = folderFilter;
+      if (search.trim()) filters.q = search.trim();
+      const response = await filesAPI.getFiles(page + 1, rowsPerPage, filters);
       setFiles(response.data.files);
       setTotalFiles(response.data.pagination.total);
     } catch (err) {
@@ -125,6 +148,71 @@ const AdminFilesPage: React.FC = () => {
           </Typography>
         </Box>
 
+        {/* Filters */}
+        <Box sx={{ mb: 3, display: 'flex', gap: 2, flexWrap: 'wrap' }}>
+          <TextField
+            size="small"
+            label="Search"
+            value={search}
+            onChange={(e) => {
+              setSearch(e.target.value);
+              setPage(0);
+            }}
+          />
+          <FormControl size="small" sx={{ minWidth: 150 }}>
+            <InputLabel>Type</InputLabel>
+            <Select
+              value={typeFilter}
+              label="Type"
+              onChange={(e) => {
+                setTypeFilter(e.target.value);
+                setPage(0);
+              }}
+            >
+              <MenuItem value="all">All Types</MenuItem>
+              <MenuItem value="image">Images</MenuItem>
+              <MenuItem value="video">Videos</MenuItem>
+              <MenuItem value="audio">Audio</MenuItem>
+              <MenuItem value="application">Documents</MenuItem>
+              <MenuItem value="text">Text</MenuItem>
+            </Select>
+          </FormControl>
+          <FormControl size="small" sx={{ minWidth: 150 }}>
+            <InputLabel>Usage</InputLabel>
+            <Select
+              value={usageFilter}
+              label="Usage"
+              onChange={(e) => {
+                setUsageFilter(e.target.value);
+                setPage(0);
+              }}
+            >
+              <MenuItem value="all">All Files</MenuItem>
+              <MenuItem value="used">Used in Posts</MenuItem>
+              <MenuItem value="unused">Unused</MenuItem>
+            </Select>
+          </FormControl>
+          <FormControl size="small" sx={{ minWidth: 150 }}>
+            <InputLabel>Folder</InputLabel>
+            <Select
+              value={folderFilter}
+              label="Folder"
+              onChange={(e) => {
+                setFolderFilter(e.target.value);
+                setPage(0);
+              }}
+            >
+              <MenuItem value="all">All Folders</MenuItem>
+              <MenuItem value="">Top Level</MenuItem>
+              {folders.map((folder) => (
+                <MenuItem key={folder.name} value={folder.name}>
+                  {folder.name} ({folder.count})
+                </MenuItem>
+              ))}
+            </Select>
+          </FormControl>
+        </Box>
+
         {error && (
           <Alert severity="error" sx={{ mb: 2 }} onClose={() => setError('')}>
             {error}
@@ -150,7 +238,7 @@ const AdminFilesPage: React.FC = () => {
                     <TableCell width="50px">Preview</TableCell>
                     <TableCell>Display Name</TableCell>
                     <TableCell>Original Filename</TableCell>
-                    <TableCell>Post</TableCell>
+                    <TableCell>Used In</TableCell>
                     <TableCell>Type</TableCell>
                     <TableCell>Size</TableCell>
                     <TableCell>Uploaded</TableCell>
@@ -162,7 +250,7 @@ const AdminFilesPage: React.FC = () => {
                     <TableRow>
                       <TableCell colSpan={8} align="center">
                         <Typography color="text.secondary" sx={{ py: 4 }}>
-                          No files uploaded yet
+                          No files found
                         </Typography>
                       </TableCell>
                     </TableRow>
@@ -173,7 +261,9 @@ const AdminFilesPage: React.FC = () => {
                           {isImage(file.mime_type) ? (
                             <Box
                               component="img"
-                              src={filesAPI.getFileUrl(file.server_path)}
+                              src={filesAPI.getFileUrl(
+                                file.variants?.find((variant) => variant.name === 'thumbnail')?.server_path ?? file.server_path
+                              )}
                               alt={file.display_name}
                               sx={{
                                 width: 40,
@@ -195,6 +285,11 @@ const AdminFilesPage: React.FC = () => {
                               {file.description}
                             </Typography>
                           )}
+                          {file.folder && (
+                            <Typography variant="caption" color="text.secondary" display="block">
+                              {file.folder}/
+                            </Typography>
+                          )}
                         </TableCell>
                         <TableCell>
                           <Typography variant="body2" color="text.secondary">
@@ -202,9 +297,9 @@ const AdminFilesPage: React.FC = () => {
                           </Typography>
                         </TableCell>
                         <TableCell>
-                          {file.post_title && (
-                            <Chip label={file.post_title} size="small" variant="outlined" />
-                          )}
+                          {file.used_in.map((usage) => (
+                            <Chip key={usage.post_id} label={usage.title} size="small" variant="outlined" sx={{ mr: 0.5, mb: 0.5 }} />
+                          ))}
                         </TableCell>
                         <TableCell>
                           <Typography variant="caption" color="text.secondary">
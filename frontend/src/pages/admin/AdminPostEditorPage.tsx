@@ -88,6 +88,7 @@ const PostEditorPage: React.FC = () => {
     summary: '',
     slug: '',
     published: false,
+    publish_at: '',
     tags: [] as Tag[],
     created_at: '',
   })
@@ -135,6 +136,7 @@ const PostEditorPage: React.FC = () => {
             summary: postData.summary,
             slug: postData.slug,
             published: postData.published,
+            publish_at: postData.publish_at ? utcToLocalDatetime(postData.publish_at) : '',
             tags: postData.tags || [],
             created_at: createdAtLocal,
           }
@@ -178,6 +180,7 @@ const PostEditorPage: React.FC = () => {
 
       // Convert datetime-local format (in browser's local timezone) to UTC ISO 8601 for backend
       let createdAtForBackend = post.created_at ? localDatetimeToUTC(post.created_at) : undefined
+      let publishAtForBackend = post.publish_at ? localDatetimeToUTC(post.publish_at) : undefined
 
       if (postId) {
         // Update existing post
@@ -187,6 +190,7 @@ const PostEditorPage: React.FC = () => {
           summary: post.summary,
           slug: post.slug || undefined,
           published: post.published,
+          publish_at: publishAtForBackend ?? null,
           tag_ids: post.tags.map(tag => tag.id),
           created_at: createdAtForBackend,
         }
@@ -199,6 +203,7 @@ const PostEditorPage: React.FC = () => {
           summary: post.summary,
           slug: post.slug || undefined,
           published: post.published,
+          publish_at: publishAtForBackend,
           tag_ids: post.tags.map(tag => tag.id),
           created_at: createdAtForBackend,
         }
@@ -246,6 +251,7 @@ const PostEditorPage: React.FC = () => {
 
       // Convert datetime-local format (in browser's local timezone) to UTC ISO 8601 for backend
       let createdAtForBackend = post.created_at ? localDatetimeToUTC(post.created_at) : undefined
+      let publishAtForBackend = post.publish_at ? localDatetimeToUTC(post.publish_at) : undefined
 
       if (postId) {
         // Update existing post
@@ -255,6 +261,7 @@ const PostEditorPage: React.FC = () => {
           summary: post.summary,
           slug: post.slug || undefined,
           published: post.published,
+          publish_at: publishAtForBackend ?? null,
           tag_ids: post.tags.map(tag => tag.id),
           created_at: createdAtForBackend,
         }
@@ -270,6 +277,7 @@ const PostEditorPage: React.FC = () => {
           summary: post.summary,
           slug: post.slug || undefined,
           published: post.published,
+          publish_at: publishAtForBackend,
           tag_ids: post.tags.map(tag => tag.id),
           created_at: createdAtForBackend,
         }
@@ -473,7 +481,11 @@ const PostEditorPage: React.FC = () => {
                       control={
                         <Switch
                           checked={post.published}
-                          onChange={(e) => handleFieldChange('published', e.target.checked)}
+                          onChange={(e) => {
+                            // Publishing now replaces any schedule
+                            const published = e.target.checked
+                            setPost(prev => ({ ...prev, published, publish_at: published ? '' : prev.publish_at }))
+                          }}
                           color="primary"
                         />
                       }
@@ -483,15 +495,47 @@ const PostEditorPage: React.FC = () => {
                             {post.published ? 'Published' : 'Draft'}
                           </Typography>
                           <Chip 
-                            label={post.published ? 'Live' : 'Draft'} 
+                            label={post.published ? 'Live' : (post.publish_at ? 'Scheduled' : 'Draft')} 
                             size="small" 
-                            color={post.published ? 'success' : 'default'}
+                            color={post.published ? 'success' : (post.publish_at ? 'info' : 'default')}
                           />
                         </Box>
                       }
                     />
                   </Box>
 
+                  {/* Schedule */}
+                  {!post.published && (
+                    <Box sx={{ mb: 2 }}>
+                      <Typography variant="subtitle2" sx={{ mb: 1, fontWeight: 600 }}>
+                        Schedule
+                      </Typography>
+                      <TextField
+                        fullWidth
+                        size="small"
+                        type="datetime-local"
+                        value={post.publish_at}
+                        onChange={(e) => handleFieldChange('publish_at', e.target.value)}
+                        variant="outlined"
+                        helperText="Publish the post automatically at this time, in your local time."
+                        InputLabelProps={{
+                          shrink: true,
+                        }}
+                      />
+                      {post.publish_at && (
+                        <Button
+                          size="small"
+                          onClick={() => handleFieldChange('publish_at', '')}
+                          sx={{ mt: 1 }}
+                          fullWidth
+                          variant="outlined"
+                        >
+                          Cancel Schedule
+                        </Button>
+                      )}
+                    </Box>
+                  )}
+
                   <Divider sx={{ my: 1.5 }} />
 
                   {/* URL Slug */}
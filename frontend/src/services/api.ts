@@ -40,6 +40,8 @@ export interface BlogPost {
   summary: string
   slug: string
   published: boolean
+  scheduled?: boolean
+  publish_at?: string
   view_count: number
   tags: Tag[]
   created_at: string
@@ -66,9 +68,13 @@ export interface TagWithPostCount {
 export interface Comment {
   id: number
   post_id: number
+  parent_id?: number
+  is_author: boolean
   name: string
   email?: string
+  avatar_url: string
   content: string
+  content_html: string
   status: string
   created_at: string
 }
@@ -80,6 +86,7 @@ export interface CommentAdmin {
   name: string
   email: string
   content: string
+  content_html: string
   status: string
   ip_address: string
   referer: string
@@ -88,10 +95,19 @@ export interface CommentAdmin {
 }
 
 export interface CreateCommentRequest {
-  post_id: number
+  parent_id?: number
   name: string
   email?: string
   content: string
+  notify_replies?: boolean
+  form_token: string
+  pow_nonce?: string
+}
+
+export interface CommentForm {
+  token: string
+  pow_difficulty: number
+  notify_replies: boolean
 }
 
 export interface UpdateCommentStatusRequest {
@@ -107,21 +123,60 @@ export interface CommentStats {
 
 export interface UploadedFile {
   id: number
-  post_id: number
+  post_id?: number
   post_title?: string
   original_file_name: string
   display_name: string
   description: string
+  folder: string
   server_path: string
   file_size: number
   mime_type: string
+  sha256?: string
+  width?: number
+  height?: number
+  variants?: FileVariant[]
+  used_in: FileUsage[]
   created_at: string
   updated_at: string
 }
 
+export interface FileUsage {
+  post_id: number
+  title: string
+  slug: string
+}
+
+export interface FileFilters {
+  type?: string
+  folder?: string
+  usage?: 'used' | 'unused'
+  post_id?: number
+  q?: string
+}
+
+export interface FileFolder {
+  name: string
+  count: number
+}
+
+export interface FileVariant {
+  id: number
+  blob_hash: string
+  name: 'thumbnail' | 'medium' | 'large'
+  format: 'jpeg' | 'png' | 'webp'
+  server_path: string
+  width: number
+  height: number
+  file_size: number
+  mime_type: string
+  created_at: string
+}
+
 export interface UpdateFileRequest {
   display_name?: string
   description?: string
+  folder?: string
 }
 
 export interface PaginatedFilesResponse {
@@ -170,6 +225,7 @@ export interface CreatePostRequest {
   summary?: string
   slug?: string
   published: boolean
+  publish_at?: string
   tag_ids?: number[]
   created_at?: string
 }
@@ -180,6 +236,7 @@ export interface UpdatePostRequest {
   summary?: string
   slug?: string
   published?: boolean
+  publish_at?: string | null // null cancels the schedule
   tag_ids?: number[]
   created_at?: string
 }
@@ -259,6 +316,13 @@ export const tagsAPI = {
 
 // Comments API
 export const commentsAPI = {
+  // Public endpoints
+  getPostComments: (slug: string) =>
+    api.get<{ comments: Comment[]; form: CommentForm }>(`/posts/${slug}/comments`),
+
+  createPostComment: (slug: string, data: CreateCommentRequest) =>
+    api.post<{ comment: Comment }>(`/posts/${slug}/comments`, data),
+
   // Admin endpoints
   getAllCommentsForAdmin: (page = 1, limit = 20, status?: string) =>
     api.get<{ 
@@ -288,10 +352,15 @@ export const commentsAPI = {
 
 // Files API
 export const filesAPI = {
-  uploadFile: (postId: number, file: File, displayName?: string, description?: string) => {
+  uploadFile: (postId: number | null, file: File, displayName?: string, description?: string, folder?: string) => {
     const formData = new FormData()
     formData.append('file', file)
-    formData.append('post_id', postId.toString())
+    if (postId) {
+      formData.append('post_id', postId.toString())
+    }
+    if (folder) {
+      formData.append('folder', folder)
+    }
     if (displayName) {
       formData.append('display_name', displayName)
     }
@@ -305,11 +374,14 @@ export const filesAPI = {
     })
   },
 
-  getFiles: (page = 1, limit = 20) =>
+  getFiles: (page = 1, limit = 20, filters: FileFilters = {}) =>
     api.get<PaginatedFilesResponse>('/admin/files', {
-      params: { page, limit },
+      params: { page, limit, ...filters },
     }),
 
+  getFolders: () =>
+    api.get<{ folders: FileFolder[] }>('/admin/files/folders'),
+
   getFile: (id: number) =>
     api.get<UploadedFile>(`/admin/files/${id}`),
 